@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// SegmentCache stores the TextSegments extracted from a file on disk, keyed by the file's
+// content hash, so unchanged files don't need to be downloaded and parsed again.
+type SegmentCache struct {
+	Dir string
+}
+
+func NewSegmentCache(dir string) (*SegmentCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating segment cache directory: %w", err)
+	}
+	return &SegmentCache{Dir: dir}, nil
+}
+
+// Get returns the cached segments for key. ok is false when nothing is cached.
+func (c *SegmentCache) Get(key string) ([]parser.TextSegment, bool, error) {
+	f, err := os.Open(c.entryPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("reading cache entry %s: %w", key, err)
+	}
+	defer gz.Close()
+
+	var segs []parser.TextSegment
+	decoder := json.NewDecoder(gz)
+	for {
+		var seg parser.TextSegment
+		err := decoder.Decode(&seg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("decoding cache entry %s: %w", key, err)
+		}
+		segs = append(segs, seg)
+	}
+
+	return segs, true, nil
+}
+
+// NewWriter starts a cache entry for key. Segments become visible to Get only after Commit.
+func (c *SegmentCache) NewWriter(key string) (*EntryWriter, error) {
+	tmp, err := os.CreateTemp(c.Dir, "entry*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("creating cache entry: %w", err)
+	}
+
+	gz := gzip.NewWriter(tmp)
+	return &EntryWriter{
+		tmp:     tmp,
+		gz:      gz,
+		encoder: json.NewEncoder(gz),
+		dest:    c.entryPath(key),
+	}, nil
+}
+
+func (c *SegmentCache) entryPath(key string) string {
+	return c.versionedEntryPath(parser.ExtractorVersion, key)
+}
+
+// versionedEntryPath includes the extractor version, so entries written by older parsers are never read
+func (c *SegmentCache) versionedEntryPath(version, key string) string {
+	sum := sha256.Sum256([]byte(version + "|" + key))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".jsonl.gz")
+}
+
+type EntryWriter struct {
+	tmp     *os.File
+	gz      *gzip.Writer
+	encoder *json.Encoder
+	dest    string
+}
+
+func (w *EntryWriter) Write(seg parser.TextSegment) error {
+	return w.encoder.Encode(seg)
+}
+
+func (w *EntryWriter) Commit() error {
+	if err := w.gz.Close(); err != nil {
+		w.Abort()
+		return err
+	}
+	if err := w.tmp.Close(); err != nil {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+	if err := os.Rename(w.tmp.Name(), w.dest); err != nil {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (w *EntryWriter) Abort() {
+	w.gz.Close()
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
@@ -0,0 +1,168 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+var testSegments = []parser.TextSegment{
+	{Text: "Evaluation Criteria", Location: "page 1", Type: parser.SegmentHeading, Section: "Evaluation Criteria"},
+	{Text: "The contractor shall provide 24/7 support.", Location: "page 1", Type: parser.SegmentParagraph, Section: "Evaluation Criteria", Language: "en"},
+	{Text: "Le fournisseur doit être certifié ISO 14001.", Location: "Sheet1!A2", Type: parser.SegmentTableCell, Language: "fr"},
+}
+
+func newTestCache(t *testing.T) *SegmentCache {
+	t.Helper()
+	c, err := NewSegmentCache(filepath.Join(t.TempDir(), "segments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func putSegments(t *testing.T, c *SegmentCache, key string, segs []parser.TextSegment) {
+	t.Helper()
+	w, err := c.NewWriter(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, seg := range segs {
+		if err := w.Write(seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSegmentCacheRoundTrip(t *testing.T) {
+	c := newTestCache(t)
+	putSegments(t, c, "quickXorHash:abc", testSegments)
+
+	segs, ok, err := c.Get("quickXorHash:abc")
+	if err != nil || !ok {
+		t.Fatalf("Get = ok %t, error %v, want a hit", ok, err)
+	}
+	if !reflect.DeepEqual(segs, testSegments) {
+		t.Errorf("Get = %+v, want %+v", segs, testSegments)
+	}
+
+	//other keys miss
+	if _, ok, err := c.Get("quickXorHash:def"); ok || err != nil {
+		t.Errorf("Get of another key = ok %t, error %v, want a miss", ok, err)
+	}
+}
+
+func TestSegmentCacheEmptyEntry(t *testing.T) {
+	c := newTestCache(t)
+	putSegments(t, c, "cTag:empty", nil)
+
+	//a file without text is still cached
+	segs, ok, err := c.Get("cTag:empty")
+	if err != nil || !ok || len(segs) != 0 {
+		t.Errorf("Get = %v, ok %t, error %v, want an empty hit", segs, ok, err)
+	}
+}
+
+func TestSegmentCacheOverwrite(t *testing.T) {
+	c := newTestCache(t)
+	putSegments(t, c, "sha256:abc", testSegments)
+	putSegments(t, c, "sha256:abc", testSegments[:1])
+
+	segs, ok, err := c.Get("sha256:abc")
+	if err != nil || !ok || !reflect.DeepEqual(segs, testSegments[:1]) {
+		t.Errorf("Get = %+v, ok %t, error %v, want the second entry", segs, ok, err)
+	}
+}
+
+func TestSegmentCacheAbort(t *testing.T) {
+	c := newTestCache(t)
+
+	w, err := c.NewWriter("sha256:abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(testSegments[0])
+	w.Abort()
+
+	if _, ok, err := c.Get("sha256:abc"); ok || err != nil {
+		t.Errorf("Get after Abort = ok %t, error %v, want a miss", ok, err)
+	}
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Abort left %d files in the cache directory", len(entries))
+	}
+}
+
+func TestSegmentCacheMissAfterExtractorVersionChange(t *testing.T) {
+	c := newTestCache(t)
+	putSegments(t, c, "sha256:abc", testSegments)
+
+	//an entry written by the previous extractor version is not read
+	current := c.entryPath("sha256:abc")
+	if err := os.Rename(current, c.versionedEntryPath("previous", "sha256:abc")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := c.Get("sha256:abc"); ok || err != nil {
+		t.Errorf("Get = ok %t, error %v, want a miss for the current version", ok, err)
+	}
+
+	if c.versionedEntryPath("previous", "sha256:abc") == current {
+		t.Error("entry paths do not depend on the extractor version")
+	}
+}
+
+func TestSegmentCacheCorruptEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(entry []byte) []byte
+	}{
+		{
+			name:    "not gzip",
+			corrupt: func([]byte) []byte { return []byte(`{"text": "plain json"}`) },
+		},
+		{
+			name:    "truncated",
+			corrupt: func(entry []byte) []byte { return entry[:len(entry)/2] },
+		},
+		{
+			name:    "empty",
+			corrupt: func([]byte) []byte { return nil },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCache(t)
+			putSegments(t, c, "sha256:abc", testSegments)
+
+			path := c.entryPath("sha256:abc")
+			entry, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.corrupt(entry), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			segs, ok, err := c.Get("sha256:abc")
+			if ok || err == nil {
+				t.Errorf("Get = %d segments, ok %t, error %v, want a miss with an error", len(segs), ok, err)
+			}
+
+			//the corrupt entry is overwritten by the next extraction
+			putSegments(t, c, "sha256:abc", testSegments)
+			if _, ok, err := c.Get("sha256:abc"); !ok || err != nil {
+				t.Errorf("Get after rewrite = ok %t, error %v, want a hit", ok, err)
+			}
+		})
+	}
+}
@@ -1,82 +1,744 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/JA50N14/rfp_parser/internal/auth"
+	"github.com/JA50N14/rfp_parser/internal/cron"
 )
 
 type ApiConfig struct {
+	ConfigFile            string //CONFIG_FILE, empty when configured from the environment only
 	BearerTokenSmartsheet string
 	SmartsheetUrl         string
-	AccessToken           string
-	AccessTokenExpiresAt  time.Time
+	GraphAuthMode         string
+	GraphCredentials      auth.Credentials     //for AuthModeCertificate
+	GraphIdentity         auth.ManagedIdentity //for AuthModeManagedIdentity
 	GraphSiteID           string
 	GraphLibraryName      string
 	GraphDriveID          string
-	ExtMap                map[string]string
-	Logger                *slog.Logger
-	Client                *http.Client
+	GraphBaseURL          string          //e.g. https://graph.microsoft.com/v1.0, or a local fake Graph server
+	EnabledParsers        map[string]bool //by file extension, e.g. ".pdf"
+	HTTPTimeout           time.Duration
+	TokenTimeout          time.Duration
+	MaxRetries            int //retries after the first attempt of a Graph or Smartsheet request
+	PackageConcurrency    int //packages processed at once
+	SegmentCacheDir       string
+	KPIStatePath          string
+	RunMode               string
+	KPIDefSource          string
+	KPIDefPath            string //local path, or document library path for KPIDefSourceDrive
+	KPIDefList            string //list ID or display name for KPIDefSourceList
+	ExtractEntities       bool
+	HierarchyLevels       []HierarchyLevel //folder levels above the packages, outermost first
+	//failure thresholds that fail the run, -1 when unlimited
+	MaxFailedPackages       int
+	MaxFailedPackagePercent float64
+	MaxFailedFiles          int
+	FileFailurePolicy       string
+	DryRun                  bool //walk and parse, but record status changes and Smartsheet rows to DryRunReportPath instead
+	DryRunReportPath        string
+	DryRunAllPackages       bool //dry run every package regardless of ProcessStatus
+	Filter                  PackageFilter
+	PackageColumns          []PackageColumn  //metadata written to the package folder's list columns with its final ProcessStatus
+	SmartsheetColumns       map[string]int64 //Smartsheet column ID by ResultField, only mapped fields
+	ServeAddr               string           //listen address of the serve command
+	ServeSchedule           *cron.Schedule   //runs started by the serve command, nil for API-triggered runs only
+	ServeAPIKey             string           //bearer token required by the serve command's API, empty for none
+	WebhookURL              string           //public URL of the serve command's Graph webhook, empty to not subscribe to changes
+	WebhookClientState      string           //secret sent with each change notification
+	WebhookDebounce         time.Duration    //quiet period after a package's last change before it is processed
+	Logger                  *slog.Logger
+	Client                  *http.Client
+
+	token    *graphToken //shared by the copies made with ForRun
+	redactor *redactor
+}
+
+// graphToken is the current Graph access token, refreshed concurrently by package workers
+type graphToken struct {
+	mu        sync.Mutex
+	value     string
+	expiresAt time.Time
+}
+
+const (
+	RunModeProcess  = "process"
+	RunModeBackfill = "backfill"
+)
+
+// How the parser authenticates to Graph
+const (
+	AuthModeCertificate     = "certificate"      //client assertion signed with GRAPH_PRIVATE_KEY
+	AuthModeManagedIdentity = "managed_identity" //the managed identity Azure exposes to the app
+)
+
+// supportedParsers are the file extensions with a parser
+var supportedParsers = []string{".docx", ".xlsx", ".pdf"}
+
+// What happens to a package when some of its files cannot be downloaded or parsed
+const (
+	FileFailureComplete           = "complete"             //mark the package Complete
+	FileFailureCompleteWithErrors = "complete-with-errors" //post its results and mark it CompleteWithErrors
+	FileFailureFail               = "fail"                 //post nothing and mark it Failed so it is retried
+)
+
+// PackageColumn maps a package metadata field to the internal name of the list column it is written to
+type PackageColumn struct {
+	Field  string
+	Column string
+}
+
+// Package metadata fields that can be written to list columns
+const (
+	PackageFieldLastProcessedAt = "LastProcessedAt" //date and time
+	PackageFieldRunID           = "RunID"           //text
+	PackageFieldKPICount        = "KPICount"        //number
+	PackageFieldTopKPIs         = "TopKPIs"         //text, highest scoring KPI names one per line
+	PackageFieldFailedFiles     = "FailedFiles"     //text, files that could not be parsed one per line
+	PackageFieldErrorMessage    = "ErrorMessage"    //text, why the package Failed
+	PackageFieldCategoryScores  = "CategoryScores"  //text, "Category: score" per KPI category one per line
+)
+
+var packageFields = []string{
+	PackageFieldLastProcessedAt,
+	PackageFieldRunID,
+	PackageFieldKPICount,
+	PackageFieldTopKPIs,
+	PackageFieldFailedFiles,
+	PackageFieldErrorMessage,
+	PackageFieldCategoryScores,
+}
+
+const defaultPackageColumns = PackageFieldFailedFiles
+
+// Result fields written to the Smartsheet columns set with SMARTSHEET_COLUMNS
+const (
+	ResultFieldDateParsed          = "DateParsed"
+	ResultFieldRFPPackageName      = "RFPPackageName"
+	ResultFieldKPIName             = "KPIName"
+	ResultFieldKPICategory         = "KPICategory"
+	ResultFieldKPIContext          = "KPIContext"
+	ResultFieldKPIID               = "KPIID"
+	ResultFieldRequirementStrength = "RequirementStrength"
+	ResultFieldKPIScore            = "KPIScore"
+	ResultFieldCategoryScore       = "CategoryScore" //the package's total score for the KPI's category
+	ResultFieldKPISection          = "KPISection"    //section path of the reported sentence
+	ResultFieldLanguage            = "Language"      //detected document language, e.g. "en" or "fr"
+	ResultFieldKPIDefsHash         = "KPIDefsHash"   //hash of the KPI definitions the package was scanned with
+)
+
+// resultFields are the fields that can be written to Smartsheet. Required fields must have a
+// column; the original sheet's column IDs are the defaults.
+var resultFields = []struct {
+	field     string
+	required  bool
+	defaultID int64
+}{
+	{ResultFieldDateParsed, true, 5732040604077956},
+	{ResultFieldRFPPackageName, true, 3480240790392708},
+	{ResultFieldKPIName, true, 7983840417763204},
+	{ResultFieldKPICategory, true, 665491023286148},
+	{ResultFieldKPIContext, true, 4756959379804036},
+	{ResultFieldKPIID, false, 0},
+	{ResultFieldRequirementStrength, true, 0},
+	{ResultFieldKPIScore, true, 0},
+	{ResultFieldCategoryScore, true, 0},
+	{ResultFieldKPISection, false, 0},
+	{ResultFieldLanguage, false, 0},
+	{ResultFieldKPIDefsHash, false, 0},
 }
 
+// HierarchyLevel is one folder level of the document library, e.g. Year. Validator names a check
+// folder names must pass to be walked: "year", or "regex:<pattern>". Empty accepts every folder.
+// Column is the Smartsheet column the level's folder name is written to, 0 for none.
+type HierarchyLevel struct {
+	Name      string `yaml:"name"`
+	Validator string `yaml:"validator"`
+	Column    int64  `yaml:"column"`
+	Numeric   bool   `yaml:"numeric"` //sent as a number, else Smartsheet inserts e.g. the year like this: '2026
+}
+
+// defaultHierarchyLevels is the Year/Business Unit/Division layout with the original sheet's columns
+const defaultHierarchyLevels = "Year[6705789409120132,number]:year;Business Unit[4453989595434884];Division[336189612314500]"
+
+// levelNumeric marks a numeric level column in LIBRARY_LEVELS, e.g. "Year[6705789409120132,number]"
+const levelNumeric = "number"
+
+// Where the KPI definitions are loaded from
+const (
+	KPIDefSourceFile  = "file"
+	KPIDefSourceDrive = "drive"
+	KPIDefSourceList  = "list"
+)
+
+const (
+	defaultKPIStatePath     = "./kpiState.json"
+	defaultKPIDefPath       = "./parser/kpiDefinitions.json"
+	defaultDryRunReportPath = "./dryRunReport.json"
+	defaultEnabledParsers   = "docx,xlsx,pdf"
+	defaultHTTPTimeout      = 5 * time.Minute
+	defaultTokenTimeout     = 2 * time.Minute
+	defaultMaxRetries       = 5
+	defaultServeAddr        = ":8080"
+	defaultGraphBaseURL     = "https://graph.microsoft.com/v1.0"
+	defaultAuthorityURL     = "https://login.microsoftonline.com"
+	defaultWebhookDebounce  = 5 * time.Minute
+)
+
+// maxClientStateLength is Graph's limit on a subscription's clientState
+const maxClientStateLength = 128
+
 func NewApiConfig(logger *slog.Logger) (*ApiConfig, error) {
+	configFile := os.Getenv("CONFIG_FILE")
 
-	bearerTokenSmartsheet := os.Getenv("SMARTSHEET_TOKEN")
-	if bearerTokenSmartsheet == "" {
-		return nil, fmt.Errorf("SMARTSHEET_TOKEN environment variable not set")
+	s, problems := loadSettings(configFile)
+	vaultSecrets, more := s.resolveKeyVaultRefs()
+	problems = append(problems, more...)
+	cfg, more := buildApiConfig(s)
+	problems = append(problems, more...)
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
 	}
 
-	smartsheetUrl := os.Getenv("SMARTSHEET_URL")
-	if smartsheetUrl == "" {
-		return nil, fmt.Errorf("SMARTSHEET_URL environment variable not set")
+	cfg.redactor = &redactor{}
+	cfg.redactor.add(s.secrets()...)
+	cfg.redactor.add(vaultSecrets...)
+
+	cfg.ConfigFile = configFile
+	cfg.Logger = slog.New(newRedactingHandler(logger.Handler(), cfg.redactor))
+	cfg.Client = &http.Client{
+		Timeout: cfg.HTTPTimeout,
 	}
 
-	graphSiteID := os.Getenv("GRAPH_SITE_ID")
-	if graphSiteID == "" {
-		return nil, fmt.Errorf("SHAREPOINT_SITE_ID environment variable not set")
+	if err := cfg.EnsureGraphToken(0); err != nil {
+		return nil, err
 	}
 
-	graphLibraryName := os.Getenv("GRAPH_LIBRARY_NAME")
-	if graphLibraryName == "" {
-		return nil, fmt.Errorf("GRAPH_LIBRARY_NAME environment variable not set")
+	if configFile != "" {
+		logger.Info("Configuration loaded", "file", configFile)
 	}
+	return cfg, nil
+}
 
-	graphDriveID := os.Getenv("GRAPH_DRIVE_ID")
-	if graphDriveID == "" {
-		return nil, fmt.Errorf("GRAPH_DRIVE_ID environment variable not set")
+// LocalKPIDefPath returns the KPI definitions file configured with KPI_DEFINITIONS_PATH, from
+// CONFIG_FILE or the environment, for commands that work on a local file. It is the default path
+// unless KPI_DEFINITIONS_SOURCE is "file". The rest of the configuration is not validated.
+func LocalKPIDefPath() string {
+	s, _ := loadSettings(os.Getenv("CONFIG_FILE"))
+	if source := s.get("KPI_DEFINITIONS_SOURCE"); source != "" && source != KPIDefSourceFile {
+		return defaultKPIDefPath
 	}
+	if path := s.get("KPI_DEFINITIONS_PATH"); path != "" {
+		return path
+	}
+	return defaultKPIDefPath
+}
 
-	extMap := map[string]string{
-		".docx": ".docx",
-		".xlsx": ".xlsx",
-		".pdf":  ".pdf",
+// buildApiConfig validates every setting, returning all the problems found
+func buildApiConfig(s settings) (*ApiConfig, []error) {
+	v := &validator{s: s}
+
+	cfg := &ApiConfig{
+		token:                 &graphToken{},
+		BearerTokenSmartsheet: v.required("SMARTSHEET_TOKEN"),
+		SmartsheetUrl:         v.required("SMARTSHEET_URL"),
+		GraphSiteID:           v.required("GRAPH_SITE_ID"),
+		GraphLibraryName:      v.required("GRAPH_LIBRARY_NAME"),
+		GraphDriveID:          v.required("GRAPH_DRIVE_ID"),
+		GraphBaseURL:          strings.TrimSuffix(v.url("GRAPH_BASE_URL", defaultGraphBaseURL), "/"),
+		//optional - extracted text is not cached when unset
+		SegmentCacheDir:  s.get("SEGMENT_CACHE_DIR"),
+		KPIStatePath:     v.withDefault("KPI_STATE_PATH", defaultKPIStatePath),
+		DryRunReportPath: v.withDefault("DRY_RUN_REPORT", defaultDryRunReportPath),
 	}
 
-	client := &http.Client{
-		Timeout: 5 * time.Minute,
+	cfg.GraphAuthMode = v.oneOf("GRAPH_AUTH_MODE", AuthModeCertificate, AuthModeCertificate, AuthModeManagedIdentity)
+	switch cfg.GraphAuthMode {
+	case AuthModeManagedIdentity:
+		//GRAPH_CLIENT_ID or AZURE_CLIENT_ID selects a user-assigned identity, the system-assigned one is used otherwise
+		clientID := s.get("GRAPH_CLIENT_ID")
+		if clientID == "" {
+			clientID = os.Getenv("AZURE_CLIENT_ID")
+		}
+		cfg.GraphIdentity = auth.ManagedIdentityFromEnv(clientID)
+		if !cfg.GraphIdentity.Available() {
+			v.addf("GRAPH_AUTH_MODE %s requires a managed identity: IDENTITY_ENDPOINT and IDENTITY_HEADER not set", AuthModeManagedIdentity)
+		}
+
+	case AuthModeCertificate:
+		cfg.GraphCredentials = auth.Credentials{
+			AuthorityURL:   v.url("GRAPH_AUTHORITY_URL", defaultAuthorityURL),
+			Scope:          graphScope(cfg.GraphBaseURL),
+			TenantID:       v.required("GRAPH_TENANT_ID"),
+			ClientID:       v.required("GRAPH_CLIENT_ID"),
+			PrivateKeyPEM:  v.required("GRAPH_PRIVATE_KEY"),
+			CertificatePEM: v.required("GRAPH_CERTIFICATE"),
+		}
+		if cfg.GraphCredentials.PrivateKeyPEM != "" && cfg.GraphCredentials.CertificatePEM != "" {
+			if err := cfg.GraphCredentials.Validate(); err != nil {
+				v.problems = append(v.problems, err)
+			}
+		}
 	}
 
-	tokenResp, err := auth.GetGraphAccessToken(client)
+	cfg.RunMode = v.oneOf("RUN_MODE", RunModeProcess, RunModeProcess, RunModeBackfill)
+
+	cfg.KPIDefSource = v.oneOf("KPI_DEFINITIONS_SOURCE", KPIDefSourceFile, KPIDefSourceFile, KPIDefSourceDrive, KPIDefSourceList)
+	cfg.KPIDefPath = s.get("KPI_DEFINITIONS_PATH")
+	cfg.KPIDefList = s.get("KPI_DEFINITIONS_LIST")
+	switch cfg.KPIDefSource {
+	case KPIDefSourceFile:
+		if cfg.KPIDefPath == "" {
+			cfg.KPIDefPath = defaultKPIDefPath
+		}
+	case KPIDefSourceDrive:
+		if cfg.KPIDefPath == "" {
+			v.addf("%s not set - required when KPI_DEFINITIONS_SOURCE is %q", v.describeUnset("KPI_DEFINITIONS_PATH"), KPIDefSourceDrive)
+		}
+	case KPIDefSourceList:
+		if cfg.KPIDefList == "" {
+			v.addf("%s not set - required when KPI_DEFINITIONS_SOURCE is %q", v.describeUnset("KPI_DEFINITIONS_LIST"), KPIDefSourceList)
+		}
+	}
+
+	//off unless explicitly enabled
+	cfg.ExtractEntities = v.boolean("EXTRACT_ENTITIES", false)
+
+	cfg.DryRun = v.boolean("DRY_RUN", false)
+	cfg.DryRunAllPackages = v.boolean("DRY_RUN_ALL_PACKAGES", false)
+	if cfg.DryRunAllPackages && !cfg.DryRun {
+		v.addf("DRY_RUN_ALL_PACKAGES requires DRY_RUN=true")
+	}
+
+	hierarchyLevels, err := parseHierarchyLevels(v.withDefault("LIBRARY_LEVELS", defaultHierarchyLevels))
 	if err != nil {
-		return nil, err
+		v.addf("%s: %v", s.name("LIBRARY_LEVELS"), err)
 	}
-	tokenExpiresAt := time.Now().UTC().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	cfg.HierarchyLevels = hierarchyLevels
 
-	cfg := &ApiConfig{
-		BearerTokenSmartsheet: bearerTokenSmartsheet,
-		SmartsheetUrl:         smartsheetUrl,
-		ExtMap:                extMap,
-		Logger:                logger,
-		Client:                client,
-		AccessToken:           tokenResp.AccessToken,
-		AccessTokenExpiresAt:  tokenExpiresAt,
-		GraphSiteID:           graphSiteID,
-		GraphLibraryName:      graphLibraryName,
-		GraphDriveID:          graphDriveID,
+	cfg.MaxFailedPackages = v.threshold("MAX_FAILED_PACKAGES")
+	cfg.MaxFailedPackagePercent = -1
+	if raw := s.get("MAX_FAILED_PACKAGE_PERCENT"); raw != "" {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed < 0 || parsed > 100 {
+			v.addf("%s must be a number from 0 to 100, got %q", s.name("MAX_FAILED_PACKAGE_PERCENT"), raw)
+		}
+		cfg.MaxFailedPackagePercent = parsed
 	}
-	return cfg, nil
+	cfg.MaxFailedFiles = v.threshold("MAX_FAILED_FILES")
+
+	cfg.FileFailurePolicy = v.oneOf("FILE_FAILURE_POLICY", FileFailureCompleteWithErrors, FileFailureComplete, FileFailureCompleteWithErrors, FileFailureFail)
+
+	//"none" writes only ProcessStatus
+	packageColumnSpec := v.withDefault("PACKAGE_COLUMNS", defaultPackageColumns)
+	if packageColumnSpec != "none" {
+		cfg.PackageColumns, err = parsePackageColumns(packageColumnSpec)
+		if err != nil {
+			v.addf("%s: %v", s.name("PACKAGE_COLUMNS"), err)
+		}
+	}
+
+	cfg.SmartsheetColumns, err = parseSmartsheetColumns(s.get("SMARTSHEET_COLUMNS"))
+	if err != nil {
+		v.addf("%s: %v", s.name("SMARTSHEET_COLUMNS"), err)
+	}
+	for _, rf := range resultFields {
+		if rf.required && cfg.SmartsheetColumns[rf.field] == 0 {
+			v.addf("%s: no Smartsheet column for %s, add \"%s:<column ID>\"", v.describeUnset("SMARTSHEET_COLUMNS"), rf.field, rf.field)
+		}
+	}
+
+	cfg.EnabledParsers = make(map[string]bool)
+	for _, ext := range strings.Split(v.withDefault("ENABLED_PARSERS", defaultEnabledParsers), ",") {
+		ext = "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+		if !slices.Contains(supportedParsers, ext) {
+			v.addf("%s: unknown parser %q, expected one of %s", s.name("ENABLED_PARSERS"), ext, strings.Join(supportedParsers, ", "))
+			continue
+		}
+		cfg.EnabledParsers[ext] = true
+	}
+
+	cfg.HTTPTimeout = v.duration("HTTP_TIMEOUT", defaultHTTPTimeout)
+	cfg.TokenTimeout = v.duration("TOKEN_TIMEOUT", defaultTokenTimeout)
+	cfg.MaxRetries = v.integer("MAX_RETRIES", defaultMaxRetries, 0)
+	cfg.PackageConcurrency = v.integer("PACKAGE_CONCURRENCY", 1, 1)
+
+	cfg.ServeAddr = v.withDefault("SERVE_ADDR", defaultServeAddr)
+	if spec := s.get("SERVE_SCHEDULE"); spec != "" {
+		cfg.ServeSchedule, err = cron.Parse(spec)
+		if err != nil {
+			v.addf("%s: %v", s.name("SERVE_SCHEDULE"), err)
+		}
+	}
+	cfg.ServeAPIKey = s.get("SERVE_API_KEY")
+
+	cfg.WebhookURL = v.url("WEBHOOK_URL", "")
+	cfg.WebhookClientState = s.get("WEBHOOK_CLIENT_STATE")
+	cfg.WebhookDebounce = v.duration("WEBHOOK_DEBOUNCE", defaultWebhookDebounce)
+	if cfg.WebhookURL != "" && cfg.WebhookClientState == "" {
+		v.addf("%s not set - required with WEBHOOK_URL", v.describeUnset("WEBHOOK_CLIENT_STATE"))
+	}
+	if len(cfg.WebhookClientState) > maxClientStateLength {
+		v.addf("%s must be at most %d characters", s.name("WEBHOOK_CLIENT_STATE"), maxClientStateLength)
+	}
+
+	return cfg, v.problems
+}
+
+// graphScope is the token scope of the Graph API at baseURL, e.g. https://graph.microsoft.com/.default
+func graphScope(baseURL string) string {
+	resource := graphResource(baseURL)
+	if resource == "" {
+		return ""
+	}
+	return resource + "/.default"
+}
+
+// graphResource is the resource managed identity tokens are requested for, e.g. https://graph.microsoft.com
+func graphResource(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// validator reads settings, collecting a problem for each invalid value instead of stopping at the first
+type validator struct {
+	s        settings
+	problems []error
+}
+
+func (v *validator) addf(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Errorf(format, args...))
+}
+
+// describeUnset names a setting that has no value, e.g. "GRAPH_SITE_ID environment variable (sharepoint.siteId in the config file)".
+// Secrets also name their _FILE variant.
+func (v *validator) describeUnset(env string) string {
+	envs := []string{env}
+	if slices.Contains(secretSettings, env) {
+		envs = append(envs, env+secretFileSuffix)
+	}
+
+	var keys []string
+	for _, e := range envs {
+		for key, fk := range fileKeys {
+			if fk.env == e {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return strings.Join(envs, " or ") + " environment variable"
+	}
+	return fmt.Sprintf("%s environment variable (%s in the config file)", strings.Join(envs, " or "), strings.Join(keys, " or "))
+}
+
+func (v *validator) required(env string) string {
+	value := v.s.get(env)
+	if value == "" {
+		v.addf("%s not set", v.describeUnset(env))
+	}
+	return value
+}
+
+func (v *validator) withDefault(env, def string) string {
+	if value := v.s.get(env); value != "" {
+		return value
+	}
+	return def
+}
+
+// oneOf returns the setting, def when unset, and reports values not in allowed
+func (v *validator) oneOf(env, def string, allowed ...string) string {
+	value := v.withDefault(env, def)
+	if !slices.Contains(allowed, value) {
+		quoted := make([]string, len(allowed))
+		for i, a := range allowed {
+			quoted[i] = strconv.Quote(a)
+		}
+		v.addf("%s must be one of %s, got %q", v.s.name(env), strings.Join(quoted, ", "), value)
+	}
+	return value
+}
+
+func (v *validator) boolean(env string, def bool) bool {
+	raw := v.s.get(env)
+	if raw == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(raw)
+	if err != nil {
+		v.addf("%s must be true or false, got %q", v.s.name(env), raw)
+	}
+	return b
+}
+
+// integer returns the setting, def when unset, and reports values below min
+func (v *validator) integer(env string, def, min int) int {
+	raw := v.s.get(env)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < min {
+		v.addf("%s must be an integer of at least %d, got %q", v.s.name(env), min, raw)
+	}
+	return n
+}
+
+// threshold reads an optional non-negative failure threshold, -1 when unset
+func (v *validator) threshold(env string) int {
+	if v.s.get(env) == "" {
+		return -1
+	}
+	return v.integer(env, -1, 0)
+}
+
+// url returns the setting, def when unset, and reports values that are not absolute http(s) URLs
+func (v *validator) url(env, def string) string {
+	raw := v.withDefault(env, def)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		v.addf("%s must be an absolute http or https URL, got %q", v.s.name(env), raw)
+	}
+	return raw
+}
+
+func (v *validator) duration(env string, def time.Duration) time.Duration {
+	raw := v.s.get(env)
+	if raw == "" {
+		return def
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		v.addf("%s must be a positive duration such as 90s or 5m, got %q", v.s.name(env), raw)
+	}
+	return d
+}
+
+// GraphToken returns the current Graph access token
+func (c *ApiConfig) GraphToken() string {
+	c.token.mu.Lock()
+	defer c.token.mu.Unlock()
+	return c.token.value
+}
+
+// EnsureGraphToken fetches a new Graph access token when the current one expires within window.
+// It is safe to call from concurrent package workers.
+func (c *ApiConfig) EnsureGraphToken(window time.Duration) error {
+	c.token.mu.Lock()
+	defer c.token.mu.Unlock()
+
+	if c.token.value != "" && time.Until(c.token.expiresAt) > window {
+		return nil
+	}
+
+	var tokenResp auth.AccessTokenResponse
+	var err error
+	if c.GraphAuthMode == AuthModeManagedIdentity {
+		tokenResp, err = auth.GetManagedIdentityToken(c.Client, c.GraphIdentity, graphResource(c.GraphBaseURL), c.TokenTimeout)
+	} else {
+		tokenResp, err = auth.GetGraphAccessToken(c.Client, c.GraphCredentials, c.TokenTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	c.token.value = tokenResp.AccessToken
+	if c.redactor != nil {
+		c.redactor.setToken(tokenResp.AccessToken)
+	}
+	c.token.expiresAt = time.Now().UTC().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	return nil
+}
+
+// ForRun returns a copy of the configuration for one run with its own mode, dry run setting and
+// filter. The copy shares the Graph token, logger and HTTP client, so runs never change the
+// configuration other goroutines read.
+func (c *ApiConfig) ForRun(mode string, dryRun bool, filter PackageFilter) *ApiConfig {
+	run := *c
+	run.RunMode = mode
+	run.DryRun = dryRun
+	run.Filter = filter
+	return &run
+}
+
+// parsePackageColumns parses fields separated by ";", each "Field" when the column's internal name
+// is the field name, or "Field:Column", e.g. "LastProcessedAt;KPICount:KPIsFound"
+func parsePackageColumns(spec string) ([]PackageColumn, error) {
+	var columns []PackageColumn
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field, column, _ := strings.Cut(part, ":")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+		if column == "" {
+			column = field
+		}
+
+		if !slices.Contains(packageFields, field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(packageFields, ", "))
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field %q listed more than once", field)
+		}
+		seen[field] = true
+
+		columns = append(columns, PackageColumn{Field: field, Column: column})
+	}
+	return columns, nil
+}
+
+// parseSmartsheetColumns parses "Field:ColumnID" entries separated by ";" on top of the default
+// columns, e.g. "RequirementStrength:1234567890123456;KPIID:2345678901234567"
+func parseSmartsheetColumns(spec string) (map[string]int64, error) {
+	columns := make(map[string]int64, len(resultFields))
+	known := make([]string, 0, len(resultFields))
+	for _, rf := range resultFields {
+		if rf.defaultID != 0 {
+			columns[rf.field] = rf.defaultID
+		}
+		known = append(known, rf.field)
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		field, rawID, ok := strings.Cut(part, ":")
+		field = strings.TrimSpace(field)
+		if !ok {
+			return nil, fmt.Errorf("%q: expected Field:ColumnID", part)
+		}
+		if !slices.Contains(known, field) {
+			return nil, fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(known, ", "))
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("field %q listed more than once", field)
+		}
+		seen[field] = true
+
+		id, err := strconv.ParseInt(strings.TrimSpace(rawID), 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("field %q: invalid column ID %q", field, strings.TrimSpace(rawID))
+		}
+		columns[field] = id
+	}
+	return columns, nil
+}
+
+// parseHierarchyLevels parses levels separated by ";", each "Name" or "Name:validator", optionally
+// with its Smartsheet column after the name, e.g.
+// "Region[1001]:regex:^(East|West)$;Year[1002,number]:year;Client"
+func parseHierarchyLevels(spec string) ([]HierarchyLevel, error) {
+	var levels []HierarchyLevel
+	seen := make(map[string]bool)
+	seenColumns := make(map[int64]string)
+
+	for _, entry := range strings.Split(spec, ";") {
+		head, validator, _ := strings.Cut(entry, ":")
+		validator = strings.TrimSpace(validator)
+
+		level, err := parseLevelColumn(strings.TrimSpace(head))
+		if err != nil {
+			return nil, err
+		}
+		level.Validator = validator
+
+		if level.Name == "" {
+			return nil, fmt.Errorf("level name is empty in %q", spec)
+		}
+		if seen[level.Name] {
+			return nil, fmt.Errorf("level %q is listed more than once", level.Name)
+		}
+		seen[level.Name] = true
+		if other, ok := seenColumns[level.Column]; ok && level.Column != 0 {
+			return nil, fmt.Errorf("levels %q and %q have the same column %d", other, level.Name, level.Column)
+		}
+		seenColumns[level.Column] = level.Name
+
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// parseLevelColumn parses "Name", "Name[ColumnID]" or "Name[ColumnID,number]"
+func parseLevelColumn(head string) (HierarchyLevel, error) {
+	name, attrs, ok := strings.Cut(head, "[")
+	level := HierarchyLevel{Name: strings.TrimSpace(name)}
+	if !ok {
+		return level, nil
+	}
+
+	attrs, ok = strings.CutSuffix(attrs, "]")
+	if !ok {
+		return HierarchyLevel{}, fmt.Errorf("level %q: expected Name[ColumnID] or Name[ColumnID,%s]", head, levelNumeric)
+	}
+	id, kind, hasKind := strings.Cut(attrs, ",")
+
+	column, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64)
+	if err != nil || column <= 0 {
+		return HierarchyLevel{}, fmt.Errorf("level %q: invalid column ID %q", level.Name, strings.TrimSpace(id))
+	}
+	level.Column = column
+
+	if hasKind {
+		if strings.TrimSpace(kind) != levelNumeric {
+			return HierarchyLevel{}, fmt.Errorf("level %q: unknown column type %q, expected %q", level.Name, strings.TrimSpace(kind), levelNumeric)
+		}
+		level.Numeric = true
+	}
+	return level, nil
+}
+
+// String formats the level as in LIBRARY_LEVELS
+func (l HierarchyLevel) String() string {
+	s := l.Name
+	if l.Column != 0 {
+		attrs := strconv.FormatInt(l.Column, 10)
+		if l.Numeric {
+			attrs += "," + levelNumeric
+		}
+		s += "[" + attrs + "]"
+	}
+	if l.Validator != "" {
+		s += ":" + l.Validator
+	}
+	return s
+}
+
+// PackageFilter limits a run to some of the library's packages. It is set from the command line.
+type PackageFilter struct {
+	Levels  map[string]string //folder name required at each named level, e.g. "Year": "2026"
+	Package string            //path.Match pattern on the package name, e.g. "City of*"
+}
+
+// IsEmpty reports whether f selects every package
+func (f PackageFilter) IsEmpty() bool {
+	return len(f.Levels) == 0 && f.Package == ""
 }
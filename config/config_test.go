@@ -0,0 +1,201 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testSettings returns settings for a valid configuration, without Graph credentials checks
+func testSettings(overrides map[string]string) settings {
+	s := settings{
+		values: map[string]string{
+			"SMARTSHEET_TOKEN":   "smartsheet-token",
+			"SMARTSHEET_URL":     "https://api.smartsheet.com/2.0/sheets/1/rows",
+			"SMARTSHEET_COLUMNS": "RequirementStrength:1001;KPIScore:1003;CategoryScore:1004",
+			"GRAPH_SITE_ID":      "site",
+			"GRAPH_LIBRARY_NAME": "Documents",
+			"GRAPH_DRIVE_ID":     "drive",
+			"GRAPH_TENANT_ID":    "tenant",
+			"GRAPH_CLIENT_ID":    "client",
+		},
+		sources: map[string]string{},
+	}
+	for env, value := range overrides {
+		if value == "" {
+			s.unset(env)
+			continue
+		}
+		s.values[env] = value
+	}
+	return s
+}
+
+// problemsMatching returns the problems that mention substr
+func problemsMatching(problems []error, substr string) []error {
+	var matching []error
+	for _, p := range problems {
+		if strings.Contains(p.Error(), substr) {
+			matching = append(matching, p)
+		}
+	}
+	return matching
+}
+
+func TestSmartsheetColumns(t *testing.T) {
+	cfg, problems := buildApiConfig(testSettings(map[string]string{
+		"SMARTSHEET_COLUMNS": "RequirementStrength:1001; KPIID:1002;KPIScore:1003;CategoryScore:1004",
+	}))
+	if p := problemsMatching(problems, "SMARTSHEET_COLUMNS"); len(p) > 0 {
+		t.Fatalf("unexpected problems: %v", errors.Join(p...))
+	}
+
+	want := map[string]int64{
+		ResultFieldRequirementStrength: 1001,
+		ResultFieldKPIID:               1002,
+		ResultFieldCategoryScore:       1004,
+		ResultFieldKPIName:             7983840417763204, //default
+	}
+	for field, id := range want {
+		if got := cfg.SmartsheetColumns[field]; got != id {
+			t.Errorf("column for %s = %d, want %d", field, got, id)
+		}
+	}
+}
+
+func TestSmartsheetColumnsRequired(t *testing.T) {
+	_, problems := buildApiConfig(testSettings(map[string]string{"SMARTSHEET_COLUMNS": ""}))
+
+	for _, field := range []string{ResultFieldRequirementStrength, ResultFieldKPIScore, ResultFieldCategoryScore} {
+		if p := problemsMatching(problems, "no Smartsheet column for "+field+","); len(p) != 1 {
+			t.Errorf("expected a problem for the unmapped required column %s, got %v", field, problems)
+		}
+	}
+}
+
+func TestSmartsheetColumnsInvalid(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"RequirementStrength", "expected Field:ColumnID"},
+		{"Strength:1001", "unknown field"},
+		{"RequirementStrength:abc", "invalid column ID"},
+		{"RequirementStrength:0", "invalid column ID"},
+		{"RequirementStrength:1001;RequirementStrength:1002", "more than once"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseSmartsheetColumns(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseSmartsheetColumns(%q) error = %v, want one containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestExtractEntitiesDefaultsOff(t *testing.T) {
+	cfg, _ := buildApiConfig(testSettings(nil))
+	if cfg.ExtractEntities {
+		t.Error("EXTRACT_ENTITIES should default to false")
+	}
+
+	cfg, _ = buildApiConfig(testSettings(map[string]string{"EXTRACT_ENTITIES": "true"}))
+	if !cfg.ExtractEntities {
+		t.Error("EXTRACT_ENTITIES=true should turn the extractor on")
+	}
+}
+
+func TestParseHierarchyLevels(t *testing.T) {
+	levels, err := parseHierarchyLevels("Region[1001]:regex:^(East|West)$; Year[1002,number]:year;Client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []HierarchyLevel{
+		{Name: "Region", Validator: "regex:^(East|West)$", Column: 1001},
+		{Name: "Year", Validator: "year", Column: 1002, Numeric: true},
+		{Name: "Client"},
+	}
+	if !slices.Equal(levels, want) {
+		t.Errorf("levels = %+v, want %+v", levels, want)
+	}
+}
+
+func TestParseHierarchyLevelsInvalid(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"Year[1002", "expected Name[ColumnID]"},
+		{"Year[abc]", "invalid column ID"},
+		{"Year[1002,date]", "unknown column type"},
+		{"Year[1002];Division[1002]", "same column"},
+		{"Year;Year", "more than once"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseHierarchyLevels(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseHierarchyLevels(%q) error = %v, want one containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestHierarchyLevelsFromConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `sharepoint:
+  levels:
+    - name: Year
+      validator: year
+      column: 1002
+      numeric: true
+    - Division[1003]
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := settings{values: map[string]string{}, sources: map[string]string{}}
+	if problems := s.loadFile(path); len(problems) > 0 {
+		t.Fatal(errors.Join(problems...))
+	}
+
+	if got, want := s.get("LIBRARY_LEVELS"), "Year[1002,number]:year;Division[1003]"; got != want {
+		t.Errorf("LIBRARY_LEVELS = %q, want %q", got, want)
+	}
+}
+
+func TestManagedIdentityAuthMode(t *testing.T) {
+	t.Setenv("IDENTITY_ENDPOINT", "http://localhost:42356/msi/token")
+	t.Setenv("IDENTITY_HEADER", "identity-header")
+
+	cfg, problems := buildApiConfig(testSettings(map[string]string{
+		"GRAPH_AUTH_MODE": AuthModeManagedIdentity,
+		"GRAPH_TENANT_ID": "",
+		"GRAPH_CLIENT_ID": "",
+	}))
+	for _, env := range []string{"GRAPH_AUTH_MODE", "GRAPH_TENANT_ID", "GRAPH_CLIENT_ID", "GRAPH_PRIVATE_KEY", "GRAPH_CERTIFICATE"} {
+		if p := problemsMatching(problems, env); len(p) > 0 {
+			t.Errorf("unexpected problems: %v", errors.Join(p...))
+		}
+	}
+	if !cfg.GraphIdentity.Available() {
+		t.Errorf("identity = %+v, want the IDENTITY_ENDPOINT one", cfg.GraphIdentity)
+	}
+	if got := graphResource(cfg.GraphBaseURL); got != "https://graph.microsoft.com" {
+		t.Errorf("resource = %q, want https://graph.microsoft.com", got)
+	}
+}
+
+func TestManagedIdentityAuthModeUnavailable(t *testing.T) {
+	t.Setenv("IDENTITY_ENDPOINT", "")
+	t.Setenv("IDENTITY_HEADER", "")
+
+	_, problems := buildApiConfig(testSettings(map[string]string{"GRAPH_AUTH_MODE": AuthModeManagedIdentity}))
+	if p := problemsMatching(problems, "requires a managed identity"); len(p) != 1 {
+		t.Errorf("expected a problem for the missing managed identity, got %v", problems)
+	}
+}
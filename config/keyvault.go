@@ -0,0 +1,172 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/internal/auth"
+)
+
+// keyVaultRefPrefix starts a Key Vault secret reference, in the App Service syntax:
+// @Microsoft.KeyVault(SecretUri=https://myvault.vault.azure.net/secrets/name/version) or
+// @Microsoft.KeyVault(VaultName=myvault;SecretName=name;SecretVersion=version), the version optional
+const keyVaultRefPrefix = "@Microsoft.KeyVault("
+
+const keyVaultAPIVersion = "7.4"
+
+// keyVaultTimeout bounds each managed identity and Key Vault request
+const keyVaultTimeout = 30 * time.Second
+
+func isKeyVaultRef(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), keyVaultRefPrefix)
+}
+
+// parseKeyVaultRef returns the secret URI of a Key Vault reference
+func parseKeyVaultRef(ref string) (*url.URL, error) {
+	ref = strings.TrimSpace(ref)
+	if !strings.HasSuffix(ref, ")") {
+		return nil, fmt.Errorf("Key Vault reference must end with \")\"")
+	}
+	body := strings.TrimSuffix(strings.TrimPrefix(ref, keyVaultRefPrefix), ")")
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(body, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("Key Vault reference: expected Name=value, got %q", part)
+		}
+		params[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	raw := params["secreturi"]
+	if raw == "" {
+		if params["vaultname"] == "" || params["secretname"] == "" {
+			return nil, fmt.Errorf("Key Vault reference needs SecretUri, or VaultName and SecretName")
+		}
+		raw = fmt.Sprintf("https://%s.vault.azure.net/secrets/%s", params["vaultname"], params["secretname"])
+		if params["secretversion"] != "" {
+			raw += "/" + params["secretversion"]
+		}
+	}
+
+	uri, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Key Vault reference: %w", err)
+	}
+	if uri.Scheme != "https" || !strings.Contains(uri.Host, ".") || !strings.HasPrefix(uri.Path, "/secrets/") {
+		return nil, fmt.Errorf("Key Vault reference: %q is not a secret URI such as https://myvault.vault.azure.net/secrets/name", raw)
+	}
+	return uri, nil
+}
+
+// keyVaultResolver fetches referenced secrets with a token of the app's managed identity
+type keyVaultResolver struct {
+	client   *http.Client
+	identity auth.ManagedIdentity
+	tokens   map[string]string //by resource
+}
+
+func newKeyVaultResolver() *keyVaultResolver {
+	return &keyVaultResolver{
+		client:   &http.Client{Timeout: keyVaultTimeout},
+		identity: auth.ManagedIdentityFromEnv(os.Getenv("AZURE_CLIENT_ID")),
+		tokens:   make(map[string]string),
+	}
+}
+
+func (r *keyVaultResolver) resolve(ref string) (string, error) {
+	uri, err := parseKeyVaultRef(ref)
+	if err != nil {
+		return "", err
+	}
+
+	//the token's resource is the vault's DNS suffix, e.g. https://vault.azure.net
+	_, suffix, _ := strings.Cut(uri.Hostname(), ".")
+	resource := "https://" + suffix
+	token, ok := r.tokens[resource]
+	if !ok {
+		tokenResp, err := auth.GetManagedIdentityToken(r.client, r.identity, resource, keyVaultTimeout)
+		if err != nil {
+			return "", fmt.Errorf("getting Key Vault token: %w", err)
+		}
+		token = tokenResp.AccessToken
+		r.tokens[resource] = token
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyVaultTimeout)
+	defer cancel()
+
+	query := uri.Query()
+	query.Set("api-version", keyVaultAPIVersion)
+	uri.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("fetching Key Vault secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := io.ReadAll(resp.Body)
+		json.Unmarshal(body, &errResp)
+		return "", fmt.Errorf("Key Vault returned %s for %s: %s %s", resp.Status, uri.Path, errResp.Error.Code, errResp.Error.Message)
+	}
+
+	var secret struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("decoding Key Vault secret: %w", err)
+	}
+	return secret.Value, nil
+}
+
+// resolveKeyVaultRefs replaces the Key Vault references among the settings with the secrets they
+// name and returns the secrets, so they can be redacted
+func (s settings) resolveKeyVaultRefs() ([]string, []error) {
+	var resolver *keyVaultResolver
+	var secrets []string
+	var problems []error
+
+	envs := slices.Sorted(maps.Keys(s.values))
+	for _, env := range envs {
+		value := s.values[env]
+		if !isKeyVaultRef(value) {
+			continue
+		}
+		if resolver == nil {
+			resolver = newKeyVaultResolver()
+		}
+
+		secret, err := resolver.resolve(value)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", s.name(env), err))
+			continue
+		}
+		s.values[env] = secret
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, problems
+}
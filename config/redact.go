@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+const redacted = "[REDACTED]"
+
+// minSecretLength keeps short values, which could match ordinary text, from being redacted
+const minSecretLength = 8
+
+// redactor replaces known secret values in text
+type redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+	token   string //the current Graph access token
+}
+
+func (r *redactor) add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		secret = strings.TrimSpace(secret)
+		if len(secret) < minSecretLength {
+			continue
+		}
+		r.secrets = append(r.secrets, secret)
+		//PEM values are also redacted line by line, e.g. when a body echoes part of a key
+		if strings.HasPrefix(secret, "-----BEGIN") {
+			for _, line := range strings.Split(secret, "\n") {
+				line = strings.TrimSpace(line)
+				if len(line) >= minSecretLength && !strings.HasPrefix(line, "-----") {
+					r.secrets = append(r.secrets, line)
+				}
+			}
+		}
+	}
+}
+
+// setToken replaces the redacted access token when it is refreshed
+func (r *redactor) setToken(token string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.token = token
+}
+
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	if r.token != "" {
+		s = strings.ReplaceAll(s, r.token, redacted)
+	}
+	return s
+}
+
+// Redact replaces the configured secrets and the current Graph access token in s. Use it on text
+// from outside the parser, such as error response bodies, before logging it or returning it in an error.
+func (c *ApiConfig) Redact(s string) string {
+	if c.redactor == nil {
+		return s
+	}
+	return c.redactor.redact(s)
+}
+
+// redactingHandler redacts secrets from the message and attributes of every log record
+type redactingHandler struct {
+	next     slog.Handler
+	redactor *redactor
+}
+
+func newRedactingHandler(next slog.Handler, r *redactor) *redactingHandler {
+	return &redactingHandler{next: next, redactor: r}
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	out := slog.NewRecord(record.Time, record.Level, h.redactor.redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		out.AddAttrs(h.redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redactedAttrs[i] = h.redactAttr(attr)
+	}
+	return newRedactingHandler(h.next.WithAttrs(redactedAttrs), h.redactor)
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return newRedactingHandler(h.next.WithGroup(name), h.redactor)
+}
+
+func (h *redactingHandler) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redactedGroup := make([]slog.Attr, len(group))
+		for i, a := range group {
+			redactedGroup[i] = h.redactAttr(a)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redactedGroup...)}
+	case slog.KindAny:
+		//errors are logged as text. Other values (structs, Stringers, slices, maps) keep their
+		//structure unless their text holds a secret, when they are logged as redacted text.
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, h.redactor.redact(err.Error()))
+		}
+		text := fmt.Sprint(value.Any())
+		if redactedText := h.redactor.redact(text); redactedText != text {
+			return slog.String(attr.Key, redactedText)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
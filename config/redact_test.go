@@ -0,0 +1,60 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+type credentials struct {
+	User  string
+	Token string
+}
+
+type tokenStringer string
+
+func (t tokenStringer) String() string {
+	return "token " + string(t)
+}
+
+func TestRedactingHandlerRedactsAnyValue(t *testing.T) {
+	const secret = "s3cr3t-smartsheet-token"
+	r := &redactor{}
+	r.add(secret)
+
+	var buf bytes.Buffer
+	logger := slog.New(newRedactingHandler(slog.NewJSONHandler(&buf, nil), r))
+
+	logger.Info("request failed",
+		"error", errors.New("401 for "+secret),
+		"struct", credentials{User: "parser", Token: secret},
+		"pointer", &credentials{Token: secret},
+		"stringer", tokenStringer(secret),
+		"slice", []string{"a", secret},
+		"map", map[string]string{"authorization": "Bearer " + secret},
+		slog.Group("request", "header", secret),
+	)
+
+	out := buf.String()
+	if strings.Contains(out, secret) {
+		t.Errorf("secret logged: %s", out)
+	}
+	if n := strings.Count(out, redacted); n != 7 {
+		t.Errorf("got %d redactions, want 7: %s", n, out)
+	}
+}
+
+func TestRedactingHandlerKeepsStructuredValues(t *testing.T) {
+	r := &redactor{}
+	r.add("s3cr3t-smartsheet-token")
+
+	var buf bytes.Buffer
+	logger := slog.New(newRedactingHandler(slog.NewJSONHandler(&buf, nil), r))
+	logger.Info("run summary", "filesParsed", map[string]int{".pdf": 3})
+
+	if !strings.Contains(buf.String(), `"filesParsed":{".pdf":3}`) {
+		t.Errorf("map without secrets should be logged as is: %s", buf.String())
+	}
+}
@@ -0,0 +1,296 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// settings holds the raw configuration values keyed by environment variable name. Values come
+// from the config file and are overridden by environment variables that are set.
+type settings struct {
+	values  map[string]string
+	sources map[string]string //where each file value came from, e.g. "sharepoint.siteId in config.yaml"
+}
+
+// fileKey maps a config file key to the environment variable it sets. Lists are joined with sep.
+type fileKey struct {
+	env string
+	sep string
+}
+
+// fileKeys are the keys accepted in the config file, as dotted paths
+var fileKeys = map[string]fileKey{
+	"sharepoint.siteId":         {env: "GRAPH_SITE_ID"},
+	"sharepoint.libraryName":    {env: "GRAPH_LIBRARY_NAME"},
+	"sharepoint.driveId":        {env: "GRAPH_DRIVE_ID"},
+	"sharepoint.graphBaseUrl":   {env: "GRAPH_BASE_URL"},
+	"sharepoint.levels":         {env: "LIBRARY_LEVELS", sep: ";"},
+	"sharepoint.packageColumns": {env: "PACKAGE_COLUMNS", sep: ";"},
+
+	"smartsheet.url":       {env: "SMARTSHEET_URL"},
+	"smartsheet.token":     {env: "SMARTSHEET_TOKEN"},
+	"smartsheet.tokenFile": {env: "SMARTSHEET_TOKEN_FILE"},
+	"smartsheet.columns":   {env: "SMARTSHEET_COLUMNS", sep: ";"},
+
+	"auth.mode":            {env: "GRAPH_AUTH_MODE"},
+	"auth.authorityUrl":    {env: "GRAPH_AUTHORITY_URL"},
+	"auth.tenantId":        {env: "GRAPH_TENANT_ID"},
+	"auth.clientId":        {env: "GRAPH_CLIENT_ID"},
+	"auth.privateKey":      {env: "GRAPH_PRIVATE_KEY"},
+	"auth.privateKeyFile":  {env: "GRAPH_PRIVATE_KEY_FILE"},
+	"auth.certificate":     {env: "GRAPH_CERTIFICATE"},
+	"auth.certificateFile": {env: "GRAPH_CERTIFICATE_FILE"},
+
+	"kpiDefinitions.source": {env: "KPI_DEFINITIONS_SOURCE"},
+	"kpiDefinitions.path":   {env: "KPI_DEFINITIONS_PATH"},
+	"kpiDefinitions.list":   {env: "KPI_DEFINITIONS_LIST"},
+
+	"parsers.enabled": {env: "ENABLED_PARSERS", sep: ","},
+
+	"timeouts.http":  {env: "HTTP_TIMEOUT"},
+	"timeouts.token": {env: "TOKEN_TIMEOUT"},
+
+	"retry.maxRetries": {env: "MAX_RETRIES"},
+
+	"concurrency.packages": {env: "PACKAGE_CONCURRENCY"},
+
+	"run.mode":              {env: "RUN_MODE"},
+	"run.kpiStatePath":      {env: "KPI_STATE_PATH"},
+	"run.segmentCacheDir":   {env: "SEGMENT_CACHE_DIR"},
+	"run.extractEntities":   {env: "EXTRACT_ENTITIES"},
+	"run.fileFailurePolicy": {env: "FILE_FAILURE_POLICY"},
+	"run.dryRun":            {env: "DRY_RUN"},
+	"run.dryRunReport":      {env: "DRY_RUN_REPORT"},
+	"run.dryRunAllPackages": {env: "DRY_RUN_ALL_PACKAGES"},
+
+	"serve.addr":       {env: "SERVE_ADDR"},
+	"serve.schedule":   {env: "SERVE_SCHEDULE"},
+	"serve.apiKey":     {env: "SERVE_API_KEY"},
+	"serve.apiKeyFile": {env: "SERVE_API_KEY_FILE"},
+
+	"webhook.url":             {env: "WEBHOOK_URL"},
+	"webhook.clientState":     {env: "WEBHOOK_CLIENT_STATE"},
+	"webhook.clientStateFile": {env: "WEBHOOK_CLIENT_STATE_FILE"},
+	"webhook.debounce":        {env: "WEBHOOK_DEBOUNCE"},
+
+	"thresholds.maxFailedPackages":       {env: "MAX_FAILED_PACKAGES"},
+	"thresholds.maxFailedPackagePercent": {env: "MAX_FAILED_PACKAGE_PERCENT"},
+	"thresholds.maxFailedFiles":          {env: "MAX_FAILED_FILES"},
+}
+
+// secretSettings can also be read from a file named by the setting's _FILE variant, e.g.
+// GRAPH_PRIVATE_KEY_FILE, such as a mounted Container Apps or Kubernetes secret
+var secretSettings = []string{"GRAPH_PRIVATE_KEY", "GRAPH_CERTIFICATE", "SMARTSHEET_TOKEN", "SERVE_API_KEY", "WEBHOOK_CLIENT_STATE"}
+
+const secretFileSuffix = "_FILE"
+
+// loadSettings reads the config file at path, if any, applies the environment on top of it and
+// reads the secret files. Every problem found is returned.
+func loadSettings(path string) (settings, []error) {
+	s := settings{
+		values:  make(map[string]string),
+		sources: make(map[string]string),
+	}
+
+	var problems []error
+	if path != "" {
+		problems = s.loadFile(path)
+	}
+
+	//a secret set in the environment, directly or as a file, replaces both forms in the config file
+	for _, env := range secretSettings {
+		if os.Getenv(env) != "" || os.Getenv(env+secretFileSuffix) != "" {
+			s.unset(env)
+			s.unset(env + secretFileSuffix)
+		}
+	}
+
+	for _, key := range fileKeys {
+		if v := os.Getenv(key.env); v != "" {
+			s.values[key.env] = v
+			delete(s.sources, key.env)
+		}
+	}
+
+	problems = append(problems, s.readSecretFiles()...)
+	return s, problems
+}
+
+// readSecretFiles sets each secret given as a file to the file's contents
+func (s settings) readSecretFiles() []error {
+	var problems []error
+
+	for _, env := range secretSettings {
+		fileEnv := env + secretFileSuffix
+		path := s.get(fileEnv)
+		if path == "" {
+			continue
+		}
+		if s.get(env) != "" {
+			problems = append(problems, fmt.Errorf("%s and %s are both set, set only one", s.name(env), s.name(fileEnv)))
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: reading secret file: %w", s.name(fileEnv), err))
+			continue
+		}
+		//mounted secrets often end with a newline
+		s.values[env] = strings.TrimRight(string(data), "\r\n")
+		s.sources[env] = s.name(fileEnv)
+	}
+
+	return problems
+}
+
+func (s settings) unset(env string) {
+	delete(s.values, env)
+	delete(s.sources, env)
+}
+
+// secrets returns the values of the secret settings, for redaction
+func (s settings) secrets() []string {
+	values := make([]string, 0, len(secretSettings))
+	for _, env := range secretSettings {
+		values = append(values, s.get(env))
+	}
+	return values
+}
+
+// get returns the value of the setting named by its environment variable, "" when unset
+func (s settings) get(env string) string {
+	return s.values[env]
+}
+
+// name describes where a setting came from, for error messages
+func (s settings) name(env string) string {
+	if source, ok := s.sources[env]; ok {
+		return source
+	}
+	return env
+}
+
+func (s settings) loadFile(path string) []error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return []error{fmt.Errorf("reading config file: %w", err)}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return []error{fmt.Errorf("%s: %w", path, err)}
+	}
+	if len(doc.Content) == 0 {
+		//empty file
+		return nil
+	}
+
+	var problems []error
+	s.loadNode(doc.Content[0], "", path, &problems)
+	return problems
+}
+
+// loadNode records the values under node, the value of the dotted key prefix
+func (s settings) loadNode(node *yaml.Node, prefix, path string, problems *[]error) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if prefix != "" {
+				key = prefix + "." + key
+			}
+			s.loadNode(node.Content[i+1], key, path, problems)
+		}
+		return
+	}
+
+	fk, ok := fileKeys[prefix]
+	if !ok {
+		if prefix == "" {
+			*problems = append(*problems, fmt.Errorf("%s: expected a mapping at the top level", path))
+			return
+		}
+		*problems = append(*problems, fmt.Errorf("%s line %d: unknown key %q", path, node.Line, prefix))
+		return
+	}
+
+	value, err := nodeValue(node, fk.sep)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("%s line %d: %s: %w", path, node.Line, prefix, err))
+		return
+	}
+
+	value, err = interpolate(value)
+	if err != nil {
+		*problems = append(*problems, fmt.Errorf("%s line %d: %s: %w", path, node.Line, prefix, err))
+		return
+	}
+
+	s.values[fk.env] = value
+	s.sources[fk.env] = fmt.Sprintf("%s in %s", prefix, path)
+}
+
+// nodeValue returns a scalar as is and a sequence joined with sep. Sequence items that are
+// mappings, as used for sharepoint.levels, are formatted as in LIBRARY_LEVELS, e.g.
+// "Year[6705789409120132,number]:year".
+func nodeValue(node *yaml.Node, sep string) (string, error) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return node.Value, nil
+
+	case yaml.SequenceNode:
+		if sep == "" {
+			return "", errors.New("expected a single value, got a list")
+		}
+
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			switch item.Kind {
+			case yaml.ScalarNode:
+				items = append(items, item.Value)
+			case yaml.MappingNode:
+				var level HierarchyLevel
+				if err := item.Decode(&level); err != nil {
+					return "", err
+				}
+				if level.Numeric && level.Column == 0 {
+					return "", fmt.Errorf("line %d: level %q is numeric but has no column", item.Line, level.Name)
+				}
+				items = append(items, level.String())
+			default:
+				return "", fmt.Errorf("line %d: unexpected list item", item.Line)
+			}
+		}
+		return strings.Join(items, sep), nil
+	}
+
+	return "", errors.New("expected a value or a list")
+}
+
+var interpolationRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolate replaces ${VAR} references with the environment variable's value. "$${" escapes a literal "${".
+func interpolate(value string) (string, error) {
+	const escaped = "\x00"
+	value = strings.ReplaceAll(value, "$${", escaped)
+
+	var missing []string
+	value = interpolationRef.ReplaceAllStringFunc(value, func(ref string) string {
+		name := interpolationRef.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s not set", strings.Join(missing, ", "))
+	}
+
+	return strings.ReplaceAll(value, escaped, "${"), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// levelFlags collects repeated -level Name=Value flags
+type levelFlags map[string]string
+
+func (l levelFlags) String() string {
+	parts := make([]string, 0, len(l))
+	for name, value := range l {
+		parts = append(parts, name+"="+value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l levelFlags) Set(s string) error {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(value) == "" {
+		return fmt.Errorf("expected Name=Value, got %q", s)
+	}
+	l[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	return nil
+}
+
+// filterFlags are the package filter flags shared by the commands that walk the library
+type filterFlags struct {
+	levels       levelFlags
+	year         string
+	businessUnit string
+	division     string
+	pkg          string
+}
+
+// newFilteredFlagSet returns a flag set for the named command with the package filter flags defined
+func newFilteredFlagSet(name string, output io.Writer) (*flag.FlagSet, *filterFlags) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	f := &filterFlags{levels: levelFlags{}}
+	fs.Var(f.levels, "level", `only folders named Value at library level Name, e.g. -level "Division=FM East" (repeatable)`)
+	fs.StringVar(&f.year, "year", "", "shorthand for -level Year=<value>")
+	fs.StringVar(&f.businessUnit, "business-unit", "", `shorthand for -level "Business Unit=<value>"`)
+	fs.StringVar(&f.division, "division", "", "shorthand for -level Division=<value>")
+	fs.StringVar(&f.pkg, "package", "", `only packages whose name matches this pattern, e.g. "City of*"`)
+	return fs, f
+}
+
+func (f *filterFlags) packageFilter() config.PackageFilter {
+	levels := make(map[string]string, len(f.levels)+3)
+	for name, value := range f.levels {
+		levels[name] = value
+	}
+	shorthands := []struct{ name, value string }{
+		{"Year", f.year},
+		{"Business Unit", f.businessUnit},
+		{"Division", f.division},
+	}
+	for _, s := range shorthands {
+		if s.value != "" {
+			levels[s.name] = s.value
+		}
+	}
+
+	return config.PackageFilter{Levels: levels, Package: f.pkg}
+}
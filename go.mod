@@ -4,9 +4,11 @@ go 1.24.1
 
 toolchain go1.24.7
 
-require github.com/joho/godotenv v1.5.1
-
 require (
-	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/google/uuid v1.6.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/text v0.30.0
 )
+
+require gopkg.in/yaml.v3 v3.0.1
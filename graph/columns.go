@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// ColumnDefinition is a column of the document library's list. Only the facet matching the
+// column's type is set.
+type ColumnDefinition struct {
+	Name        string        `json:"name"` //internal name, used as the key when patching fields
+	DisplayName string        `json:"displayName"`
+	ReadOnly    bool          `json:"readOnly"`
+	Text        *struct{}     `json:"text"`
+	Number      *struct{}     `json:"number"`
+	DateTime    *struct{}     `json:"dateTime"`
+	Choice      *ChoiceColumn `json:"choice"`
+}
+
+type ChoiceColumn struct {
+	AllowTextEntry bool     `json:"allowTextEntry"`
+	Choices        []string `json:"choices"`
+}
+
+// Column types returned by ColumnDefinition.Type
+const (
+	ColumnTypeText     = "text"
+	ColumnTypeNumber   = "number"
+	ColumnTypeDateTime = "dateTime"
+	ColumnTypeChoice   = "choice"
+	ColumnTypeOther    = "other"
+)
+
+func (c ColumnDefinition) Type() string {
+	switch {
+	case c.Text != nil:
+		return ColumnTypeText
+	case c.Number != nil:
+		return ColumnTypeNumber
+	case c.DateTime != nil:
+		return ColumnTypeDateTime
+	case c.Choice != nil:
+		return ColumnTypeChoice
+	}
+	return ColumnTypeOther
+}
+
+// GetLibraryColumns returns the column definitions of the document library's list
+func GetLibraryColumns(ctx context.Context, cfg *config.ApiConfig) ([]ColumnDefinition, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		url := fmt.Sprintf("%s/sites/%s/drives/%s/list/columns", cfg.GraphBaseURL, cfg.GraphSiteID, cfg.GraphDriveID)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		return req, nil
+	}
+
+	return listAll[ColumnDefinition](ctx, cfg, buildReq)
+}
@@ -41,7 +41,7 @@ func GetFile(itemID string, ctx context.Context, cfg *config.ApiConfig) (*os.Fil
 
 		resp, err := cfg.Client.Do(req)
 		if err != nil {
-			if retries >= maxRetries {
+			if retries >= cfg.MaxRetries {
 				return nil, fmt.Errorf("maximum retries exceeded")
 			}
 			if ctx.Err() != nil {
@@ -131,8 +131,8 @@ func GetFile(itemID string, ctx context.Context, cfg *config.ApiConfig) (*os.Fil
 				fatal = true
 
 			case http.StatusTooManyRequests:
-				if retries >= maxRetries {
-					err = fmt.Errorf("maximum (%d) retries exceeded", maxRetries)
+				if retries >= cfg.MaxRetries {
+					err = fmt.Errorf("maximum (%d) retries exceeded", cfg.MaxRetries)
 					fatal = true
 					return
 				}
@@ -175,8 +175,8 @@ func GetFile(itemID string, ctx context.Context, cfg *config.ApiConfig) (*os.Fil
 			return tmp, nil
 		}
 
-		if retries >= maxRetries {
-			return nil, fmt.Errorf("download failed after %d retries: %w", maxRetries, err)
+		if retries >= cfg.MaxRetries {
+			return nil, fmt.Errorf("download failed after %d retries: %w", cfg.MaxRetries, err)
 		}
 	}
 }
@@ -187,12 +187,12 @@ func createGetFileRequest(ctx context.Context, cfg *config.ApiConfig, itemID str
 		return nil, err
 	}
 
-	url := fmt.Sprintf("%s/sites/%s/drives/%s/items/%s/content", graphBaseURL, cfg.GraphSiteID, cfg.GraphDriveID, itemID)
+	url := fmt.Sprintf("%s/sites/%s/drives/%s/items/%s/content", cfg.GraphBaseURL, cfg.GraphSiteID, cfg.GraphDriveID, itemID)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
-	req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+	req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
 	if written > 0 {
 		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", written))
 	}
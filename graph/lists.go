@@ -7,12 +7,21 @@ import (
 	"time"
 
 	"github.com/JA50N14/rfp_parser/config"
-	"github.com/JA50N14/rfp_parser/internal/auth"
 )
 
 type Item struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID   string     `json:"id"`
+	Name string     `json:"name"`
+	CTag string     `json:"cTag"`
+	File *FileFacet `json:"file"`
+}
+
+// FileFacet is only present on drive items that are files
+type FileFacet struct {
+	Hashes struct {
+		QuickXorHash string `json:"quickXorHash"`
+		SHA256Hash   string `json:"sha256Hash"`
+	} `json:"hashes"`
 }
 
 type Package struct {
@@ -27,7 +36,6 @@ type Package struct {
 	} `json:"listItem"`
 }
 
-const graphBaseURL = "https://graph.microsoft.com/v1.0"
 const refreshTokenWindow = time.Minute * 5
 
 func GetRootDirs(ctx context.Context, cfg *config.ApiConfig) ([]Item, error) {
@@ -37,13 +45,13 @@ func GetRootDirs(ctx context.Context, cfg *config.ApiConfig) ([]Item, error) {
 	}
 
 	buildReq := func(ctx context.Context) (*http.Request, error) {
-		url := fmt.Sprintf("%s/drives/%s/root/children", graphBaseURL, cfg.GraphDriveID)
+		url := fmt.Sprintf("%s/drives/%s/root/children", cfg.GraphBaseURL, cfg.GraphDriveID)
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
-		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
 		return req, nil
 	}
 
@@ -62,14 +70,14 @@ func GetItemSubDirs(itemID string, ctx context.Context, cfg *config.ApiConfig) (
 	}
 
 	buildReq := func(ctx context.Context) (*http.Request, error) {
-		url := fmt.Sprintf("%s/drives/%s/items/%s/children", graphBaseURL, cfg.GraphDriveID, itemID)
+		url := fmt.Sprintf("%s/drives/%s/items/%s/children", cfg.GraphBaseURL, cfg.GraphDriveID, itemID)
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
 
-		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
 		return req, nil
 	}
 
@@ -89,14 +97,14 @@ func GetItemSubDirsWithMetadata(itemID string, ctx context.Context, cfg *config.
 	}
 
 	buildReq := func(ctx context.Context) (*http.Request, error) {
-		url := fmt.Sprintf("%s/drives/%s/items/%s/children?expand=listItem", graphBaseURL, cfg.GraphDriveID, itemID)
+		url := fmt.Sprintf("%s/drives/%s/items/%s/children?expand=listItem", cfg.GraphBaseURL, cfg.GraphDriveID, itemID)
 
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 		if err != nil {
 			return nil, fmt.Errorf("create request: %w", err)
 		}
 
-		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
 		return req, nil
 	}
 
@@ -109,13 +117,5 @@ func GetItemSubDirsWithMetadata(itemID string, ctx context.Context, cfg *config.
 }
 
 func checkAccessTokenExpiry(cfg *config.ApiConfig) error {
-	if time.Until(cfg.AccessTokenExpiresAt) <= refreshTokenWindow {
-		tokenResp, err := auth.GetGraphAccessToken(cfg.Client)
-		if err != nil {
-			return err
-		}
-		cfg.AccessToken = tokenResp.AccessToken
-		cfg.AccessTokenExpiresAt = time.Now().UTC().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
-	}
-	return nil
+	return cfg.EnsureGraphToken(refreshTokenWindow)
 }
@@ -15,18 +15,27 @@ type ProcessStatus struct {
 }
 
 func PatchProcessStatus(itemID string, patchValue string, ctx context.Context, cfg *config.ApiConfig) (ProcessStatus, error) {
+	return patchFields[ProcessStatus](itemID, map[string]any{"ProcessStatus": patchValue}, ctx, cfg)
+}
+
+// PatchFields sets list columns on the package folder itemID, keyed by column internal name
+func PatchFields(itemID string, fields map[string]any, ctx context.Context, cfg *config.ApiConfig) error {
+	_, err := patchFields[map[string]any](itemID, fields, ctx, cfg)
+	return err
+}
+
+func patchFields[T any](itemID string, fields map[string]any, ctx context.Context, cfg *config.ApiConfig) (T, error) {
+	var zero T
+
 	err := checkAccessTokenExpiry(cfg)
 	if err != nil {
-		return ProcessStatus{}, err
+		return zero, err
 	}
 
 	buildReq := func(ctx context.Context) (*http.Request, error) {
-		url := fmt.Sprintf("%s/sites/%s/drives/%s/items/%s/listItem/fields", graphBaseURL, cfg.GraphSiteID, cfg.GraphDriveID, itemID)
+		url := fmt.Sprintf("%s/sites/%s/drives/%s/items/%s/listItem/fields", cfg.GraphBaseURL, cfg.GraphSiteID, cfg.GraphDriveID, itemID)
 
-		payload := map[string]string{
-			"ProcessStatus": patchValue,
-		}
-		b, err := json.Marshal(payload)
+		b, err := json.Marshal(fields)
 		if err != nil {
 			return nil, err
 		}
@@ -38,16 +47,16 @@ func PatchProcessStatus(itemID string, patchValue string, ctx context.Context, c
 			return nil, fmt.Errorf("create request: %w", err)
 		}
 
-		req.Header.Set("Authorization", "Bearer "+cfg.AccessToken)
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Accept", "application/json")
 
 		return req, nil
 	}
 
-	result, err := do[ProcessStatus](ctx, cfg, buildReq)
+	result, err := do[T](ctx, cfg, buildReq)
 	if err != nil {
-		return ProcessStatus{}, err
+		return zero, err
 	}
 
 	return result, nil
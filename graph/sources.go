@@ -0,0 +1,69 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// ListItem is a SharePoint list item with its column values keyed by internal column name
+type ListItem struct {
+	ID     string         `json:"id"`
+	Fields map[string]any `json:"fields"`
+}
+
+// GetItemByPath looks up a drive item by its path from the root of the document library, e.g. "Config/kpiDefinitions.json"
+func GetItemByPath(itemPath string, ctx context.Context, cfg *config.ApiConfig) (Item, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return Item{}, err
+	}
+
+	segments := strings.Split(strings.Trim(itemPath, "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedPath := strings.Join(segments, "/")
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		url := fmt.Sprintf("%s/drives/%s/root:/%s", cfg.GraphBaseURL, cfg.GraphDriveID, escapedPath)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		return req, nil
+	}
+
+	return do[Item](ctx, cfg, buildReq)
+}
+
+// GetListItems returns every item of a SharePoint list on the site, with its fields. list is the list's ID or display name.
+func GetListItems(list string, ctx context.Context, cfg *config.ApiConfig) ([]ListItem, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	listID := url.PathEscape(list)
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		url := fmt.Sprintf("%s/sites/%s/lists/%s/items?expand=fields", cfg.GraphBaseURL, cfg.GraphSiteID, listID)
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		return req, nil
+	}
+
+	return listAll[ListItem](ctx, cfg, buildReq)
+}
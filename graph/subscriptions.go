@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// Subscription is a Graph change notification subscription
+type Subscription struct {
+	ID                 string    `json:"id,omitempty"`
+	Resource           string    `json:"resource"`
+	ChangeType         string    `json:"changeType"`
+	NotificationURL    string    `json:"notificationUrl"`
+	ClientState        string    `json:"clientState,omitempty"`
+	ExpirationDateTime time.Time `json:"expirationDateTime"`
+}
+
+// CreateDriveSubscription subscribes notificationURL to changes anywhere in the document library.
+// Graph validates notificationURL before it returns, so its handler must already be serving.
+func CreateDriveSubscription(notificationURL, clientState string, expiration time.Time, ctx context.Context, cfg *config.ApiConfig) (Subscription, error) {
+	sub := Subscription{
+		Resource:           fmt.Sprintf("/drives/%s/root", cfg.GraphDriveID),
+		ChangeType:         "updated", //the only change type drive items support
+		NotificationURL:    notificationURL,
+		ClientState:        clientState,
+		ExpirationDateTime: expiration.UTC(),
+	}
+	return sendSubscription(http.MethodPost, "/subscriptions", sub, ctx, cfg)
+}
+
+// RenewSubscription extends the subscription to expiration. A subscription that has already
+// expired fails with an *APIError with StatusCode 404.
+func RenewSubscription(subscriptionID string, expiration time.Time, ctx context.Context, cfg *config.ApiConfig) (Subscription, error) {
+	patch := struct {
+		ExpirationDateTime time.Time `json:"expirationDateTime"`
+	}{ExpirationDateTime: expiration.UTC()}
+	return sendSubscription(http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), patch, ctx, cfg)
+}
+
+func DeleteSubscription(subscriptionID string, ctx context.Context, cfg *config.ApiConfig) error {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return err
+	}
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		url := fmt.Sprintf("%s/subscriptions/%s", cfg.GraphBaseURL, url.PathEscape(subscriptionID))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		return req, nil
+	}
+
+	_, err = do[struct{}](ctx, cfg, buildReq)
+	return err
+}
+
+func sendSubscription(method, path string, body any, ctx context.Context, cfg *config.ApiConfig) (Subscription, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		return Subscription{}, err
+	}
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, cfg.GraphBaseURL+path, bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+
+	return do[Subscription](ctx, cfg, buildReq)
+}
+
+// DriveChange is a drive item reported by a delta query
+type DriveChange struct {
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Folder          *struct{}        `json:"folder"`
+	Deleted         *struct{}        `json:"deleted"`
+	ParentReference *ParentReference `json:"parentReference"`
+}
+
+// ParentReference locates a drive item's parent folder. Path is not set on items from a delta query.
+type ParentReference struct {
+	ID   string `json:"id"`
+	Path string `json:"path"` //e.g. /drives/{drive-id}/root:/2026/FM East
+}
+
+type deltaPage struct {
+	Value     []DriveChange `json:"value"`
+	NextLink  string        `json:"@odata.nextLink"`
+	DeltaLink string        `json:"@odata.deltaLink"`
+}
+
+// GetDriveChanges returns the items of the document library changed since deltaLink and the
+// deltaLink to pass next time. An empty deltaLink returns no changes, only the current deltaLink.
+func GetDriveChanges(deltaLink string, ctx context.Context, cfg *config.ApiConfig) ([]DriveChange, string, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	link := deltaLink
+	if link == "" {
+		link = fmt.Sprintf("%s/drives/%s/root/delta?token=latest", cfg.GraphBaseURL, cfg.GraphDriveID)
+	}
+
+	var changes []DriveChange
+	for {
+		buildReq := func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+			if err != nil {
+				return nil, fmt.Errorf("create request: %w", err)
+			}
+			req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+			return req, nil
+		}
+
+		page, err := do[deltaPage](ctx, cfg, buildReq)
+		if err != nil {
+			return nil, "", fmt.Errorf("sending request: %w", err)
+		}
+		changes = append(changes, page.Value...)
+
+		if page.NextLink == "" {
+			if page.DeltaLink == "" {
+				return nil, "", fmt.Errorf("delta response without a deltaLink")
+			}
+			return changes, page.DeltaLink, nil
+		}
+		link = page.NextLink
+	}
+}
+
+// GetItemPath returns the path of a drive item from the root of the document library, e.g.
+// ["2026", "Facilities Management", "FM East", "City of Ottawa RFP"]
+func GetItemPath(itemID string, ctx context.Context, cfg *config.ApiConfig) ([]string, error) {
+	err := checkAccessTokenExpiry(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	buildReq := func(ctx context.Context) (*http.Request, error) {
+		url := fmt.Sprintf("%s/drives/%s/items/%s?select=id,name,parentReference", cfg.GraphBaseURL, cfg.GraphDriveID, url.PathEscape(itemID))
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+cfg.GraphToken())
+		return req, nil
+	}
+
+	item, err := do[DriveChange](ctx, cfg, buildReq)
+	if err != nil {
+		return nil, err
+	}
+	if item.ParentReference == nil || item.ParentReference.Path == "" {
+		//the root folder
+		return nil, nil
+	}
+
+	_, parentPath, ok := strings.Cut(item.ParentReference.Path, "root:")
+	if !ok {
+		return nil, fmt.Errorf("unexpected parent path %q", item.ParentReference.Path)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parentPath, "/") {
+		if segment == "" {
+			continue
+		}
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			unescaped = segment
+		}
+		segments = append(segments, unescaped)
+	}
+	return append(segments, item.Name), nil
+}
@@ -18,12 +18,20 @@ type GraphListResponse[T any] struct {
 	NextLink string `json:"@odata.nextLink"`
 }
 
-const maxRetries = 5
+// APIError is a non-retryable error response from Graph
+type APIError struct {
+	StatusCode int
+	Body       string //redacted
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("graph api error: status=%d body=%s", e.StatusCode, e.Body)
+}
 
 func do[T any](ctx context.Context, cfg *config.ApiConfig, buildReq func(ctx context.Context) (*http.Request, error)) (T, error) {
 	var zero T
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
 		req, err := buildReq(ctx)
 		if err != nil {
 			return zero, fmt.Errorf("build request: %w", err)
@@ -74,7 +82,12 @@ func doOnce[T any](req *http.Request, cfg *config.ApiConfig) (T, bool, time.Dura
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
-		return zero, false, retryAfter, fmt.Errorf("graph api error: status=%d body=%s", resp.StatusCode, string(body))
+		return zero, false, retryAfter, &APIError{StatusCode: resp.StatusCode, Body: cfg.Redact(string(body))}
+	}
+
+	//e.g. DELETE
+	if resp.StatusCode == http.StatusNoContent {
+		return zero, false, retryAfter, nil
 	}
 
 	var result T
@@ -8,11 +8,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 
@@ -26,34 +26,49 @@ type AccessTokenResponse struct {
 	ExpiresIn   int    `json:"expires_in"`
 }
 
-func GetGraphAccessToken(client *http.Client) (AccessTokenResponse, error) {
-	tenantID := os.Getenv("GRAPH_TENANT_ID")
-	if tenantID == "" {
-		return AccessTokenResponse{}, fmt.Errorf("GRAPH_TENANT_ID environment variable not set")
-	}
+// Credentials identify the app registration and hold the PEM encoded key and certificate it signs
+// its client assertions with
+type Credentials struct {
+	AuthorityURL   string //e.g. https://login.microsoftonline.com
+	Scope          string //e.g. https://graph.microsoft.com/.default
+	TenantID       string
+	ClientID       string
+	PrivateKeyPEM  string
+	CertificatePEM string
+}
+
+func (c Credentials) tokenURL() string {
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(c.AuthorityURL, "/"), c.TenantID)
+}
 
-	clientID := os.Getenv("GRAPH_CLIENT_ID")
-	if clientID == "" {
-		return AccessTokenResponse{}, fmt.Errorf("GRAPH_CLIENT_ID environment variable not set")
+// Validate checks that the private key and certificate can be parsed
+func (c Credentials) Validate() error {
+	var problems []error
+	if _, err := loadPrivateKey(c.PrivateKeyPEM); err != nil {
+		problems = append(problems, fmt.Errorf("GRAPH_PRIVATE_KEY: %w", err))
+	}
+	if _, err := computeX5TFromCert(c.CertificatePEM); err != nil {
+		problems = append(problems, fmt.Errorf("GRAPH_CERTIFICATE: %w", err))
 	}
+	return errors.Join(problems...)
+}
 
-	jwt, err := makeJWT(tenantID, clientID)
+func GetGraphAccessToken(client *http.Client, creds Credentials, timeout time.Duration) (AccessTokenResponse, error) {
+	jwt, err := makeJWT(creds)
 	if err != nil {
 		return AccessTokenResponse{}, fmt.Errorf("make JWT returned: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	return fetchAccessToken(ctx, jwt, tenantID, clientID, client)
+	return fetchAccessToken(ctx, jwt, creds.tokenURL(), creds.ClientID, creds.Scope, client)
 }
 
-func fetchAccessToken(ctx context.Context, jwt, tenantID, clientID string, client *http.Client) (AccessTokenResponse, error) {
-	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID)
-
+func fetchAccessToken(ctx context.Context, jwt, tokenURL, clientID, scope string, client *http.Client) (AccessTokenResponse, error) {
 	data := url.Values{}
 	data.Set("client_id", clientID)
-	data.Set("scope", "https://graph.microsoft.com/.default")
+	data.Set("scope", scope)
 	data.Set("grant_type", "client_credentials")
 	data.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
 	data.Set("client_assertion", jwt)
@@ -91,19 +106,21 @@ func fetchAccessToken(ctx context.Context, jwt, tenantID, clientID string, clien
 	return accessTokenResp, nil
 }
 
-func makeJWT(tenantID, clientID string) (string, error) {
-	thumbprint, err := computeX5TFromCert()
+func makeJWT(creds Credentials) (string, error) {
+	clientID := creds.ClientID
+
+	thumbprint, err := computeX5TFromCert(creds.CertificatePEM)
 	if err != nil {
 		return "", fmt.Errorf("thumbprint returned: %w", err)
 	}
 
-	privateKey, err := loadPrivateKey()
+	privateKey, err := loadPrivateKey(creds.PrivateKeyPEM)
 	if err != nil {
 		return "", fmt.Errorf("privatekey returned: %w", err)
 	}
 
 	claims := jwt.MapClaims{
-		"aud": "https://login.microsoftonline.com/" + tenantID + "/oauth2/v2.0/token",
+		"aud": creds.tokenURL(),
 		"iss": clientID,
 		"sub": clientID,
 		"jti": uuid.NewString(),
@@ -125,8 +142,8 @@ func makeJWT(tenantID, clientID string) (string, error) {
 	return signedJWT, nil
 }
 
-func loadPrivateKey() (*rsa.PrivateKey, error) {
-	keyBytes := []byte(os.Getenv("GRAPH_PRIVATE_KEY"))
+func loadPrivateKey(keyPEM string) (*rsa.PrivateKey, error) {
+	keyBytes := []byte(keyPEM)
 
 	block, _ := pem.Decode(keyBytes)
 	if block == nil {
@@ -151,11 +168,12 @@ func loadPrivateKey() (*rsa.PrivateKey, error) {
 	}
 }
 
-func computeX5TFromCert() (string, error) {
-	certPEM := []byte(os.Getenv("GRAPH_CERTIFICATE"))
-
-	block, _ := pem.Decode(certPEM)
-	if block == nil || block.Type != "CERTIFICATE" {
+func computeX5TFromCert(certPEM string) (string, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return "", fmt.Errorf("invalid PEM file")
+	}
+	if block.Type != "CERTIFICATE" {
 		return "", fmt.Errorf("unsupported certificate PEM %s", block.Type)
 	}
 
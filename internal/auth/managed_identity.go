@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ManagedIdentity is the identity endpoint Azure Container Apps and App Service expose to the app
+// through IDENTITY_ENDPOINT and IDENTITY_HEADER. ClientID selects a user-assigned identity, empty
+// for the system-assigned one.
+type ManagedIdentity struct {
+	Endpoint string
+	Header   string
+	ClientID string
+}
+
+// maxErrorBodyLength is how much of an error response body is kept in the returned error
+const maxErrorBodyLength = 200
+
+// ManagedIdentityFromEnv returns the identity endpoint set by Azure. clientID selects a
+// user-assigned identity, empty for the system-assigned one.
+func ManagedIdentityFromEnv(clientID string) ManagedIdentity {
+	return ManagedIdentity{
+		Endpoint: os.Getenv("IDENTITY_ENDPOINT"),
+		Header:   os.Getenv("IDENTITY_HEADER"),
+		ClientID: clientID,
+	}
+}
+
+// Available reports whether the app runs with a managed identity
+func (m ManagedIdentity) Available() bool {
+	return m.Endpoint != "" && m.Header != ""
+}
+
+// GetManagedIdentityToken returns an access token for resource, e.g. https://vault.azure.net
+func GetManagedIdentityToken(client *http.Client, identity ManagedIdentity, resource string, timeout time.Duration) (AccessTokenResponse, error) {
+	if !identity.Available() {
+		return AccessTokenResponse{}, fmt.Errorf("no managed identity: IDENTITY_ENDPOINT and IDENTITY_HEADER not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("api-version", "2019-08-01")
+	query.Set("resource", resource)
+	if identity.ClientID != "" {
+		query.Set("client_id", identity.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, identity.Endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return AccessTokenResponse{}, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("X-IDENTITY-HEADER", identity.Header)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return AccessTokenResponse{}, fmt.Errorf("sending request to managed identity endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		//only the start of the body, enough for the error message, is kept in case it echoes credentials
+		bodyBytes, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength+1))
+		return AccessTokenResponse{}, fmt.Errorf("managed identity endpoint returned %d: %s", resp.StatusCode, truncateBody(bodyBytes))
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresOn   string `json:"expires_on"` //unix time in seconds
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return AccessTokenResponse{}, fmt.Errorf("decoding managed identity token response: %w", err)
+	}
+	if !strings.EqualFold(tokenResp.TokenType, "Bearer") || tokenResp.AccessToken == "" {
+		return AccessTokenResponse{}, fmt.Errorf("invalid managed identity token response, token_type: %s", tokenResp.TokenType)
+	}
+	expiresOn, err := strconv.ParseInt(tokenResp.ExpiresOn, 10, 64)
+	if err != nil {
+		return AccessTokenResponse{}, fmt.Errorf("invalid managed identity token response, expires_on: %q", tokenResp.ExpiresOn)
+	}
+
+	return AccessTokenResponse{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+		ExpiresIn:   int(time.Until(time.Unix(expiresOn, 0)).Seconds()),
+	}, nil
+}
+
+func truncateBody(body []byte) string {
+	text := strings.ToValidUTF8(string(body), "")
+	if len(body) <= maxErrorBodyLength {
+		return text
+	}
+	return strings.ToValidUTF8(string(body[:maxErrorBodyLength]), "") + "…"
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetManagedIdentityToken(t *testing.T) {
+	expiresOn := time.Now().Add(time.Hour).Unix()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "identity-header" {
+			http.Error(w, "missing identity header", http.StatusUnauthorized)
+			return
+		}
+		if got := r.URL.Query().Get("resource"); got != "https://graph.microsoft.com" {
+			http.Error(w, "unexpected resource "+got, http.StatusBadRequest)
+			return
+		}
+		if got := r.URL.Query().Get("client_id"); got != "user-assigned" {
+			http.Error(w, "unexpected client_id "+got, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token": "mi-token", "token_type": "Bearer", "expires_on": "` + strconv.FormatInt(expiresOn, 10) + `"}`))
+	}))
+	defer srv.Close()
+
+	identity := ManagedIdentity{Endpoint: srv.URL, Header: "identity-header", ClientID: "user-assigned"}
+	tokenResp, err := GetManagedIdentityToken(srv.Client(), identity, "https://graph.microsoft.com", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tokenResp.AccessToken != "mi-token" {
+		t.Errorf("access token = %q, want mi-token", tokenResp.AccessToken)
+	}
+	if tokenResp.ExpiresIn < 3500 || tokenResp.ExpiresIn > 3600 {
+		t.Errorf("expires in = %d, want about an hour", tokenResp.ExpiresIn)
+	}
+}
+
+func TestGetManagedIdentityTokenUnavailable(t *testing.T) {
+	if _, err := GetManagedIdentityToken(http.DefaultClient, ManagedIdentity{}, "https://graph.microsoft.com", time.Second); err == nil {
+		t.Error("expected an error without IDENTITY_ENDPOINT and IDENTITY_HEADER")
+	}
+}
+
+func TestGetManagedIdentityTokenTruncatesErrorBody(t *testing.T) {
+	body := strings.Repeat("x", 2*maxErrorBodyLength)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, body, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	identity := ManagedIdentity{Endpoint: srv.URL, Header: "identity-header"}
+	_, err := GetManagedIdentityToken(srv.Client(), identity, "https://graph.microsoft.com", time.Second)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if strings.Contains(err.Error(), body) || !strings.Contains(err.Error(), "400") {
+		t.Errorf("error = %q, want the status and a truncated body", err)
+	}
+}
@@ -0,0 +1,76 @@
+package cron
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	//a Wednesday
+	from := time.Date(2026, time.October, 14, 10, 30, 45, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 1 * * 0", time.Date(2026, time.October, 18, 1, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.October, 14, 10, 45, 0, 0, time.UTC)},
+		{"0-30/10 11 * * *", time.Date(2026, time.October, 14, 11, 0, 0, 0, time.UTC)},
+		{"0 9 1,15 * *", time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2026, time.October, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		//either day field may match when both are restricted
+		{"0 0 20 * 5", time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.October, 14, 11, 0, 0, 0, time.UTC)},
+		//the next activation is always after from
+		{"30 10 * * *", time.Date(2026, time.October, 15, 10, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Parse(%q).Next = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestNextNeverActivates(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("Next = %v, want the zero time", got)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"0 1 * *", "expected 5 fields"},
+		{"60 * * * *", "minute"},
+		{"0 24 * * *", "hour"},
+		{"0 0 0 * *", "day of month"},
+		{"0 0 * 13 *", "month"},
+		{"0 0 * * 8", "day of week"},
+		{"*/0 * * * *", "invalid step"},
+		{"30-10 * * * *", "invalid range"},
+		{"a * * * *", "not a number"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.expr, err, tt.want)
+		}
+	}
+}
@@ -6,41 +6,124 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"strings"
 
 	"github.com/JA50N14/rfp_parser/config"
 	"github.com/JA50N14/rfp_parser/walk"
 	"github.com/joho/godotenv"
 )
 
+const usage = `usage: parserbinary [command] [flags]
+
+commands:
+  run              process New and Failed packages (the default; RUN_MODE=backfill backfills instead)
+  backfill         re-scan Complete packages for new or changed KPI definitions
+  list-packages    list packages with their ProcessStatus
+  reprocess        reset ProcessStatus so the next run processes the packages again
+  parse-file       parse a local file and print the KPIs and entities found
+  validate         check a KPI definitions file
+  migrate-kpis     convert a legacy KPI definitions file to the current format
+  validate-config  check the configuration, library columns and KPI definitions
+  serve            run as a service with an HTTP API and a run schedule
+
+Run "parserbinary <command> -h" for the command's flags.
+`
+
 func main() {
-	fmt.Println("Starting main()")
-	err := runParser(context.Background())
-	if err != nil {
-		log.Fatal(err)
+	cmd, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	ctx := context.Background()
+
+	switch cmd {
+	case "run", "backfill":
+		fmt.Println("Starting main()")
+		err := runParser(ctx, cmd, args)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "list-packages":
+		os.Exit(runListPackages(ctx, args, os.Stdout))
+	case "reprocess":
+		os.Exit(runReprocess(ctx, args, os.Stdout))
+	case "parse-file":
+		os.Exit(runParseFile(ctx, args, os.Stdout))
+	case "validate":
+		os.Exit(runValidate(args, os.Stdout))
+	case "migrate-kpis":
+		os.Exit(runMigrateKPIs(args, os.Stdout))
+	case "validate-config":
+		os.Exit(runValidateConfig(ctx, args, os.Stdout))
+	case "serve":
+		os.Exit(runServe(ctx, args, os.Stdout))
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
 	}
 }
 
-func runParser(ctx context.Context) error {
+func runParser(ctx context.Context, cmd string, args []string) error {
+	fs, filter := newFilteredFlagSet(cmd, os.Stderr)
+	dryRun := fs.Bool("dry-run", false, "record status changes and Smartsheet rows to DRY_RUN_REPORT instead of writing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
 
 	logger.Info("Starting parser job")
 
-	if os.Getenv("ENV") == "local" {
-		if err := godotenv.Load(".env"); err != nil {
-			return fmt.Errorf("failed to load .env file: %w", err)
-		}
-	}
-
-	cfg, err := config.NewApiConfig(logger)
+	cfg, err := loadConfig(logger)
 	if err != nil {
-		return fmt.Errorf("failed to initialize API config: %w", err)
+		return err
+	}
+	if cmd == "backfill" {
+		cfg.RunMode = config.RunModeBackfill
+	}
+	if *dryRun {
+		cfg.DryRun = true
+	}
+	cfg.Filter = filter.packageFilter()
+	if !cfg.Filter.IsEmpty() {
+		cfg.Logger.Info("Run limited by filter", "levels", cfg.Filter.Levels, "package", cfg.Filter.Package)
 	}
 
-	err = walk.WalkDocLibrary(ctx, cfg)
+	summary, err := walk.WalkDocLibrary(ctx, cfg)
+	if summary != nil {
+		cfg.Logger.Info("Run summary", "summary", summary)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to walk document library: %w", err)
 	}
 
+	if err := summary.CheckThresholds(cfg); err != nil {
+		return err
+	}
+
 	cfg.Logger.Info("RFP Package(s) successfully processed!")
 	return nil
 }
+
+// loadConfig loads .env when running locally and builds the API config from the environment
+func loadConfig(logger *slog.Logger) (*config.ApiConfig, error) {
+	if os.Getenv("ENV") == "local" {
+		if err := godotenv.Load(".env"); err != nil {
+			return nil, fmt.Errorf("failed to load .env file: %w", err)
+		}
+	}
+
+	cfg, err := config.NewApiConfig(logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize API config: %w", err)
+	}
+	return cfg, nil
+}
+
+// commandLogger logs to stderr so a command's output on stdout stays readable
+func commandLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+}
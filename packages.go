@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JA50N14/rfp_parser/walk"
+)
+
+// runListPackages prints the packages selected by the filter flags with their ProcessStatus. It
+// returns the process exit code: 0 on success, 1 on errors, 2 on bad usage.
+func runListPackages(ctx context.Context, args []string, stdout io.Writer) int {
+	fs, filter := newFilteredFlagSet("list-packages", stdout)
+	status := fs.String("status", "", `only packages with this ProcessStatus, e.g. Failed ("New" for never processed)`)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary list-packages [filter flags] [-status status]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(commandLogger())
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+	cfg.Filter = filter.packageFilter()
+
+	pkgs, walkErr := walk.ListPackages(ctx, cfg)
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tPACKAGE\tSTATUS")
+	count := 0
+	for _, pkg := range pkgs {
+		s := displayStatus(pkg.Status)
+		if *status != "" && !strings.EqualFold(*status, s) {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", pkg.Path, pkg.Name, s)
+		count++
+	}
+	tw.Flush()
+	fmt.Fprintf(stdout, "%d packages\n", count)
+
+	if walkErr != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", walkErr)
+		return 1
+	}
+	return 0
+}
+
+// runReprocess clears the ProcessStatus of the packages selected by the filter flags, so the next
+// run processes them again. It returns the process exit code: 0 on success, 1 on errors, 2 on bad usage.
+func runReprocess(ctx context.Context, args []string, stdout io.Writer) int {
+	fs, filter := newFilteredFlagSet("reprocess", stdout)
+	all := fs.Bool("all", false, "reset every package in the library when no filter is given")
+	force := fs.Bool("force", false, "also reset InProgress packages, e.g. after a crashed run")
+	dryRun := fs.Bool("dry-run", false, "print the packages that would be reset without changing them")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary reprocess [filter flags] [-all] [-force] [-dry-run]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	pkgFilter := filter.packageFilter()
+	if pkgFilter.IsEmpty() && !*all {
+		fmt.Fprintln(stdout, "ERROR: no filter given. Pass -all to reset every package")
+		return 2
+	}
+
+	cfg, err := loadConfig(commandLogger())
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+	cfg.Filter = pkgFilter
+	cfg.DryRun = *dryRun
+
+	pkgs, err := walk.ListPackages(ctx, cfg)
+	if err != nil {
+		//nothing is reset from a partial listing
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+
+	reset, resetErr := walk.ResetPackages(ctx, cfg, pkgs, *force)
+	for _, pkg := range reset {
+		fmt.Fprintf(stdout, "reset %s/%s (was %s)\n", pkg.Path, pkg.Name, displayStatus(pkg.Status))
+	}
+
+	verb := "reset"
+	if *dryRun {
+		verb = "would be reset"
+	}
+	fmt.Fprintf(stdout, "%d of %d packages %s\n", len(reset), len(pkgs), verb)
+
+	if resetErr != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", resetErr)
+		return 1
+	}
+	return 0
+}
+
+// runValidateConfig checks the configuration and everything a run depends on. It returns the
+// process exit code: 0 when a run can start, 1 when it cannot, 2 on bad usage.
+func runValidateConfig(ctx context.Context, args []string, stdout io.Writer) int {
+	fs, filter := newFilteredFlagSet("validate-config", stdout)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary validate-config [filter flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := loadConfig(commandLogger())
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+	cfg.Filter = filter.packageFilter()
+
+	if err := walk.CheckSetup(ctx, cfg); err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(stdout, "ERROR: %s\n", line)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "configuration OK")
+	return 0
+}
+
+func displayStatus(status string) string {
+	if status == walk.PkgStatusNew {
+		return "New"
+	}
+	return status
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/parser"
+	"github.com/JA50N14/rfp_parser/walk"
+)
+
+// runParseFile parses a local file with the KPI definitions and prints the KPIs and entities found,
+// without any SharePoint or Smartsheet access. It returns the process exit code: 0 on success,
+// 1 on errors, 2 on bad usage.
+func runParseFile(ctx context.Context, args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("parse-file", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	kpiPath := fs.String("kpis", config.LocalKPIDefPath(), "KPI definitions file")
+	entities := fs.Bool("entities", true, "also report discovered standards, targets and amounts")
+	asJSON := fs.Bool("json", false, "print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary parse-file [-kpis path] [-entities=false] [-json] path/to/file.(docx|xlsx|pdf)")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	filePath := fs.Arg(0)
+
+	//definition issues go to stderr so -json output stays parseable
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	defFile, err := walk.LoadLocalKPIDefinitions(*kpiPath, logger)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+	kpiDefs := parser.ActiveKPIDefinitions(defFile.KPIs, time.Now())
+
+	result, err := walk.ParseLocalFile(ctx, filePath, kpiDefs, *entities)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %s: %v\n", filePath, err)
+		return 1
+	}
+
+	if *asJSON {
+		return printParseFileJSON(result, stdout)
+	}
+
+	for _, kpi := range result.KPIResults {
+		fmt.Fprintf(stdout, "%s (%s) - %s, score %.2f, %d occurrences\n", kpi.KPIDef.Name, kpi.KPIDef.Category, kpi.Strength, kpi.Score, kpi.Occurrences)
+		if kpi.Section != "" {
+			fmt.Fprintf(stdout, "    section: %s\n", kpi.Section)
+		}
+		fmt.Fprintf(stdout, "    %s\n", kpi.Sentence)
+	}
+
+	discovered := 0
+	for _, entity := range result.Entities {
+		if entity.KPIID != "" {
+			continue
+		}
+		fmt.Fprintf(stdout, "Discovered %s: %s\n    %s\n", entity.Kind, entity.ID, entity.Sentence)
+		discovered++
+	}
+
+	fmt.Fprintf(stdout, "%s: %d KPIs found, %d entities discovered\n", filePath, len(result.KPIResults), discovered)
+	return 0
+}
+
+type parseFileKPI struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Category    string  `json:"category"`
+	Strength    string  `json:"strength"`
+	Score       float64 `json:"score"`
+	Occurrences int     `json:"occurrences"`
+	Section     string  `json:"section,omitempty"`
+	Sentence    string  `json:"sentence"`
+	Language    string  `json:"language,omitempty"`
+}
+
+type parseFileEntity struct {
+	Kind        string `json:"kind"`
+	ID          string `json:"id"`
+	Sentence    string `json:"sentence"`
+	Section     string `json:"section,omitempty"`
+	Occurrences int    `json:"occurrences"`
+}
+
+func printParseFileJSON(result walk.PkgResult, stdout io.Writer) int {
+	out := struct {
+		KPIs     []parseFileKPI    `json:"kpis"`
+		Entities []parseFileEntity `json:"entities,omitempty"`
+	}{
+		KPIs: make([]parseFileKPI, 0, len(result.KPIResults)),
+	}
+
+	for _, kpi := range result.KPIResults {
+		out.KPIs = append(out.KPIs, parseFileKPI{
+			ID:          kpi.KPIDef.ID,
+			Name:        kpi.KPIDef.Name,
+			Category:    kpi.KPIDef.Category,
+			Strength:    string(kpi.Strength),
+			Score:       kpi.Score,
+			Occurrences: kpi.Occurrences,
+			Section:     kpi.Section,
+			Sentence:    kpi.Sentence,
+			Language:    kpi.Language,
+		})
+	}
+	for _, entity := range result.Entities {
+		if entity.KPIID == "" {
+			out.Entities = append(out.Entities, parseFileEntity{
+				Kind:        string(entity.Kind),
+				ID:          entity.ID,
+				Sentence:    entity.Sentence,
+				Section:     entity.Section,
+				Occurrences: entity.Occurrences,
+			})
+		}
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(out); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,358 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EntityKind groups the entities found by the built-in extractor
+type EntityKind string
+
+const (
+	EntityStandard EntityKind = "Standard" //e.g. ISO 14001:2015, CSA Z462, 29 CFR 1910.134
+	EntityTarget   EntityKind = "Target"   //e.g. reduce emissions 30% by 2030
+	EntityAmount   EntityKind = "Amount"   //e.g. insurance $5,000,000
+)
+
+// Entity is a standard, numeric target or dollar threshold found in a package, independent of
+// the KPI definitions. ID is normalised so the same entity written differently is reported once.
+type Entity struct {
+	Kind        EntityKind
+	ID          string
+	Text        string //first occurrence as written
+	Sentence    string
+	Section     string
+	File        string
+	Language    string
+	Occurrences int
+	KPIID       string //set by MarkCoveredEntities when a KPI definition already matches Text
+}
+
+// entityRule extracts one kind of entity. normalise returns the entity ID for a submatch, given
+// the sentence it was found in, or "" to skip it.
+type entityRule struct {
+	kind      EntityKind
+	re        *regexp.Regexp
+	normalise func(sentence string, m []string) string
+}
+
+var entityRules = []entityRule{
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\bISO(?:\s?/\s?(IEC|TS|TR|PAS|ASTM))?\s?(\d{3,5})((?:-\d{1,2})*)(?:\s?:\s?((?:19|20)\d{2}))?\b`),
+		normalise: normaliseISO,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\bANSI(?:\s?/\s?([A-Z]{2,6}))?\s([A-Z]{1,3}\s?\d+(?:[.\-]\d+)*)\b`),
+		normalise: normaliseANSI,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\bASTM\s([A-G])\s?(\d{1,4})(?:\s?[-/]\s?(\d{2,4}[a-z]?))?\b`),
+		normalise: normaliseASTM,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\bCSA\s(?:Standard\s)?([A-Z]{1,2})\s?(\d{1,4}(?:\.\d+)*)(?:-(\d{2,4}))?\b`),
+		normalise: normaliseCSA,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\b(?:BS\s)?EN\s(ISO\s)?(\d{3,5})((?:-\d{1,2})*)(?:\s?:\s?((?:19|20)\d{2}))?\b`),
+		normalise: normaliseEN,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\b(\d{1,2})\s?CFR\s?(?:Part\s|§\s?)?(\d{1,4})(?:\.(\d+))?\b`),
+		normalise: normaliseCFR,
+	},
+	{
+		kind:      EntityStandard,
+		re:        regexp.MustCompile(`\bOSHA\s(?:Standard\s|Part\s|§\s?)?(19[0-2]\d)(?:\.(\d+))?\b`),
+		normalise: normaliseOSHA,
+	},
+	{
+		kind:      EntityTarget,
+		re:        regexp.MustCompile(`(?i)\b(reduc|cut|lower|decreas|increas|divert|achiev|improv)\w*\s+((?:[\p{L}\d-]+\s+){0,6}?)(?:by|of|to)\s+(\d{1,3}(?:\.\d+)?)\s?(?:%|percent\b)(?:[^.;]{0,40}?\b(?:by|before|until|no later than)\s+((?:19|20)\d{2}))?`),
+		normalise: normaliseVerbTarget,
+	},
+	{
+		kind:      EntityTarget,
+		re:        regexp.MustCompile(`(?i)\b(\d{1,3}(?:\.\d+)?)\s?(?:%|percent)\s+(reduction|decrease|cut|increase|improvement|diversion)\s+(?:in|of)\s+([\p{L}\d][\p{L}\d\s-]{0,50}?)(?:\s+(?:by|before|until|no later than)\s+((?:19|20)\d{2})\b|\s*(?:[.;,:)]|$)|\s+(?:from|compared|against|relative|across|at|for|over|within|versus|vs)\b)`),
+		normalise: normaliseNounTarget,
+	},
+	{
+		kind:      EntityTarget,
+		re:        regexp.MustCompile(`(?i)\b(net[- ]zero|carbon[- ]neutral(?:ity)?|climate[- ]neutral(?:ity)?|carbon[- ]negative)\b[^.;]{0,60}?\b(?:by|before|no later than)\s+((?:19|20)\d{2})\b`),
+		normalise: normaliseNetZero,
+	},
+	{
+		kind:      EntityAmount,
+		re:        regexp.MustCompile(`(?i)(US\$|USD\s?\$?|CA\$|C\$|CAD\s?\$?|\$)\s?(\d{1,3}(?:,\d{3})+|\d+)(?:\.\d{1,2})?(?:\s?(million|billion|thousand|mm|m|bn|b|k)\b)?`),
+		normalise: normaliseAmount,
+	},
+}
+
+// amountTopics decide which dollar amounts are thresholds worth reporting, checked in order
+// against the sentence around the amount
+var amountTopics = []struct {
+	topic string
+	re    *regexp.Regexp
+}{
+	{"bonding", regexp.MustCompile(`(?i)\b(bond|bonds|bonding|bonded|surety|letter of credit)\b`)},
+	{"insurance", regexp.MustCompile(`(?i)\b(insurance|insured|insurer|liability|coverage|indemnity|per occurrence|aggregate|policy limits?)\b`)},
+}
+
+// targetFillers are dropped from the subject of a numeric target
+var targetFillers = map[string]bool{"its": true, "our": true, "their": true, "the": true, "total": true, "overall": true, "annual": true, "a": true, "an": true, "your": true}
+
+func normaliseISO(_ string, m []string) string {
+	prefix := "ISO"
+	if m[1] != "" {
+		prefix += "/" + strings.ToUpper(m[1])
+	}
+	id := prefix + " " + m[2] + m[3]
+	if m[4] != "" {
+		id += ":" + m[4]
+	}
+	return id
+}
+
+func normaliseANSI(_ string, m []string) string {
+	prefix := "ANSI"
+	if m[1] != "" {
+		prefix += "/" + m[1]
+	}
+	return prefix + " " + strings.ReplaceAll(m[2], " ", "")
+}
+
+func normaliseASTM(_ string, m []string) string {
+	id := "ASTM " + m[1] + m[2]
+	if m[3] != "" {
+		id += "-" + m[3]
+	}
+	return id
+}
+
+func normaliseCSA(_ string, m []string) string {
+	id := "CSA " + m[1] + m[2]
+	if m[3] != "" {
+		id += "-" + m[3]
+	}
+	return id
+}
+
+func normaliseEN(_ string, m []string) string {
+	id := "EN "
+	if m[1] != "" {
+		id += "ISO "
+	}
+	id += m[2] + m[3]
+	if m[4] != "" {
+		id += ":" + m[4]
+	}
+	return id
+}
+
+func normaliseCFR(_ string, m []string) string {
+	id := m[1] + " CFR " + m[2]
+	if m[3] != "" {
+		id += "." + m[3]
+	}
+	return id
+}
+
+// normaliseOSHA maps to title 29 of the CFR, so "OSHA 1910.134" and "29 CFR 1910.134" are one entity
+func normaliseOSHA(_ string, m []string) string {
+	return normaliseCFR("", []string{"", "29", m[1], m[2]})
+}
+
+var targetVerbs = map[string]string{
+	"reduc": "reduce", "cut": "reduce", "lower": "reduce", "decreas": "reduce",
+	"increas": "increase", "improv": "increase", "divert": "divert", "achiev": "achieve",
+	"reduction": "reduce", "decrease": "reduce", "increase": "increase", "improvement": "increase", "diversion": "divert",
+}
+
+func normaliseVerbTarget(_ string, m []string) string {
+	return targetID(targetVerbs[strings.ToLower(m[1])], m[2], m[3], m[4])
+}
+
+func normaliseNounTarget(_ string, m []string) string {
+	return targetID(targetVerbs[strings.ToLower(m[2])], m[3], m[1], m[4])
+}
+
+// targetID builds IDs like "reduce emissions 30% by 2030"
+func targetID(direction, subject, percent, year string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(subject)) {
+		if !targetFillers[word] {
+			words = append(words, word)
+		}
+	}
+
+	parts := []string{direction}
+	if len(words) > 0 {
+		parts = append(parts, strings.Join(words, " "))
+	}
+	parts = append(parts, percent+"%")
+	if year != "" {
+		parts = append(parts, "by "+year)
+	}
+	return strings.Join(parts, " ")
+}
+
+func normaliseNetZero(_ string, m []string) string {
+	term := strings.ToLower(strings.ReplaceAll(m[1], "-", " "))
+	return term + " by " + m[2]
+}
+
+var amountMultipliers = map[string]float64{
+	"thousand": 1e3, "k": 1e3,
+	"million": 1e6, "m": 1e6, "mm": 1e6,
+	"billion": 1e9, "b": 1e9, "bn": 1e9,
+}
+
+// normaliseAmount only keeps insurance and bonding thresholds, e.g. "insurance $5,000,000".
+// The currency is kept when stated: "CAD" for CA$/C$/CAD, "USD" for US$/USD.
+func normaliseAmount(sentence string, m []string) string {
+	topic := ""
+	for _, t := range amountTopics {
+		if t.re.MatchString(sentence) {
+			topic = t.topic
+			break
+		}
+	}
+	if topic == "" {
+		return ""
+	}
+
+	value, err := strconv.ParseFloat(strings.ReplaceAll(m[2], ",", ""), 64)
+	if err != nil {
+		return ""
+	}
+	if mult, ok := amountMultipliers[strings.ToLower(m[3])]; ok {
+		value *= mult
+	}
+	//small amounts are fees and unit prices, not thresholds
+	if value < 10000 {
+		return ""
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[1]), "$")))
+	switch currency {
+	case "CA", "C":
+		currency = "CAD"
+	case "US":
+		currency = "USD"
+	}
+	amount := "$" + groupThousands(int64(value))
+	if currency != "" {
+		amount = currency + " " + amount
+	}
+	return topic + " " + amount
+}
+
+func groupThousands(n int64) string {
+	s := strconv.FormatInt(n, 10)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// EntityCollector accumulates the entities found across a package's segments
+type EntityCollector struct {
+	entities map[string]*Entity
+}
+
+func NewEntityCollector() *EntityCollector {
+	return &EntityCollector{entities: make(map[string]*Entity)}
+}
+
+// Extract is the entity stage: it runs the built-in extractor over a single TextSegment
+func (c *EntityCollector) Extract(seg TextSegment) {
+	c.extractLines(seg, segmentLines(seg))
+}
+
+func (c *EntityCollector) extractLines(seg TextSegment, lines []string) {
+	for _, item := range lines {
+		for _, rule := range entityRules {
+			for _, loc := range rule.re.FindAllStringSubmatchIndex(item, -1) {
+				start, end := sentenceBounds(item, loc[:2])
+				sentence := item[start:end]
+
+				m := make([]string, len(loc)/2)
+				for g := range m {
+					if loc[2*g] >= 0 {
+						m[g] = item[loc[2*g]:loc[2*g+1]]
+					}
+				}
+
+				id := rule.normalise(sentence, m)
+				if id == "" {
+					continue
+				}
+
+				key := string(rule.kind) + "\x00" + strings.ToLower(id)
+				if entity, ok := c.entities[key]; ok {
+					entity.Occurrences++
+					continue
+				}
+				c.entities[key] = &Entity{
+					Kind:        rule.kind,
+					ID:          id,
+					Text:        m[0],
+					Sentence:    trimContext(sentence, loc[0]-start, loc[1]-start, defaultMaxContextLength),
+					Section:     seg.Section,
+					File:        seg.File,
+					Language:    seg.Language,
+					Occurrences: 1,
+				}
+			}
+		}
+	}
+}
+
+// Entities returns the collected entities ordered by kind, then ID
+func (c *EntityCollector) Entities() []Entity {
+	entities := make([]Entity, 0, len(c.entities))
+	for _, entity := range c.entities {
+		entities = append(entities, *entity)
+	}
+	sort.Slice(entities, func(a, b int) bool {
+		if entities[a].Kind != entities[b].Kind {
+			return entities[a].Kind < entities[b].Kind
+		}
+		return entities[a].ID < entities[b].ID
+	})
+	return entities
+}
+
+// MarkCoveredEntities sets KPIID on each entity whose text is already matched by one of kpiDefs,
+// so only requirements not yet defined as KPIs stand out
+func MarkCoveredEntities(entities []Entity, kpiDefs []KPIDefinition) {
+	for i := range entities {
+		for j := range kpiDefs {
+			if _, ok := kpiDefs[j].match(entities[i].Text, entities[i].Language); ok {
+				entities[i].KPIID = kpiDefs[j].ID
+				break
+			}
+		}
+	}
+}
+
+// Key identifies the entity across packages, e.g. "standard:iso-14001-2015"
+func (e Entity) Key() string {
+	slug := strings.Trim(entityKeyRule.ReplaceAllString(strings.ToLower(e.ID), "-"), "-")
+	return fmt.Sprintf("%s:%s", strings.ToLower(string(e.Kind)), slug)
+}
+
+var entityKeyRule = regexp.MustCompile(`[^a-z0-9%]+`)
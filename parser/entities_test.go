@@ -0,0 +1,43 @@
+package parser
+
+import "testing"
+
+func TestScanSegmentMatchesAndExtracts(t *testing.T) {
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["\\bISO 14001\\b"]}
+	]}`)
+	results := CreatePkgResultForRFPPackage(kpiDefs)
+	entities := NewEntityCollector()
+
+	seg := TextSegment{
+		Text: "The Contractor shall maintain ISO 14001 certifi-\ncation.\nSuppliers must hold ISO 9001:2015.",
+		Type: SegmentParagraph,
+	}
+	ScanSegment(seg, results, entities)
+
+	if !results[0].Found || results[0].Strength != StrengthMandatory {
+		t.Errorf("KPI result = %+v, want a Mandatory match", results[0])
+	}
+
+	found := entities.Entities()
+	ids := make([]string, 0, len(found))
+	for _, entity := range found {
+		ids = append(ids, entity.ID)
+	}
+	if len(found) != 2 || found[0].ID != "ISO 14001" || found[1].ID != "ISO 9001:2015" {
+		t.Errorf("entities = %q, want ISO 14001 and ISO 9001:2015", ids)
+	}
+}
+
+func TestScanSegmentWithoutEntities(t *testing.T) {
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["\\bISO 14001\\b"]}
+	]}`)
+	results := CreatePkgResultForRFPPackage(kpiDefs)
+
+	ScanSegment(TextSegment{Text: "ISO 14001 is preferred.", Type: SegmentParagraph}, results, nil)
+
+	if results[0].Strength != StrengthPreferred {
+		t.Errorf("strength = %s, want %s", results[0].Strength, StrengthPreferred)
+	}
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// FuzzyRule matches literal phrases approximately, tolerating up to MaxDistance character
+// edits (insertions, deletions, substitutions), e.g. "ISO 1400l" for "ISO 14001".
+// Matching is case-insensitive and ignores punctuation and spacing between words.
+type FuzzyRule struct {
+	Phrases     []string `json:"phrases"`
+	MaxDistance int      `json:"maxDistance"`
+}
+
+const maxFuzzyDistance = 3
+
+type fuzzyPhrase struct {
+	text  string
+	words int
+}
+
+type fuzzyMatcher struct {
+	phrases     []fuzzyPhrase
+	maxDistance int
+}
+
+func compileFuzzyRule(r FuzzyRule, path string) (ruleMatcher, error) {
+	if len(r.Phrases) == 0 {
+		return nil, fmt.Errorf("%s.phrases: at least one phrase is required", path)
+	}
+	if r.MaxDistance < 1 || r.MaxDistance > maxFuzzyDistance {
+		return nil, fmt.Errorf("%s.maxDistance: must be between 1 and %d", path, maxFuzzyDistance)
+	}
+
+	m := fuzzyMatcher{maxDistance: r.MaxDistance}
+	for i, phrase := range r.Phrases {
+		words := wordRule.FindAllString(strings.ToLower(normalizeText(phrase)), -1)
+		text := strings.Join(words, " ")
+		//a short phrase within a few edits of almost anything would match everywhere
+		if utf8.RuneCountInString(text) <= 3*r.MaxDistance {
+			return nil, fmt.Errorf("%s.phrases[%d]: phrase %q is too short for maxDistance %d", path, i, phrase, r.MaxDistance)
+		}
+		m.phrases = append(m.phrases, fuzzyPhrase{text: text, words: len(words)})
+	}
+	return m, nil
+}
+
+func (m fuzzyMatcher) match(text string) ([]int, bool) {
+	locs := wordRule.FindAllStringIndex(text, -1)
+	if len(locs) == 0 {
+		return nil, false
+	}
+
+	words := make([]string, len(locs))
+	for i, loc := range locs {
+		words[i] = strings.ToLower(text[loc[0]:loc[1]])
+	}
+
+	for start := range words {
+		for _, phrase := range m.phrases {
+			//OCR can split or merge words, so windows one word shorter and longer are tried too
+			for n := max(phrase.words-1, 1); n <= phrase.words+1 && start+n <= len(words); n++ {
+				candidate := strings.Join(words[start:start+n], " ")
+				if levenshteinWithin(candidate, phrase.text, m.maxDistance) {
+					return []int{locs[start][0], locs[start+n-1][1]}, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// levenshteinWithin reports whether the edit distance between a and b is at most limit
+func levenshteinWithin(a, b string, limit int) bool {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return false
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return false
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)] <= limit
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLevenshteinWithin(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  bool
+	}{
+		{"iso 14001", "iso 14001", 0, true},
+		{"iso 1400l", "iso 14001", 1, true},  //substitution
+		{"iso 1401", "iso 14001", 1, true},   //deletion
+		{"iso 140001", "iso 14001", 1, true}, //insertion
+		{"iso14001", "iso 14001", 1, true},   //merged words
+		{"is0 1400l", "iso 14001", 1, false}, //two edits
+		{"is0 1400l", "iso 14001", 2, true},
+		{"iso 9001", "iso 14001", 1, false}, //over the limit
+		{"iso 9001", "iso 14001", 3, true},
+		{"iso", "iso 14001", 3, false}, //length difference alone exceeds the limit
+		{"", "abc", 3, true},
+		{"énergie", "energie", 1, true}, //an accent is one edit, not two bytes
+		{"leed", "lead", 0, false},
+		{"abcdefgh", "hgfedcba", 3, false}, //cut off early once every row exceeds the limit
+	}
+
+	for _, tt := range tests {
+		if got := levenshteinWithin(tt.a, tt.b, tt.limit); got != tt.want {
+			t.Errorf("levenshteinWithin(%q, %q, %d) = %t, want %t", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	m, err := compileFuzzyRule(FuzzyRule{Phrases: []string{"ISO 14001", "Carbon-Neutral Operations"}, MaxDistance: 1}, "fuzzy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		text  string
+		match string //the matched text, "" for no match
+	}{
+		{"exact", "Suppliers must hold ISO 14001.", "ISO 14001"},
+		{"case and punctuation", "certified to iso-14001", "iso-14001"},
+		{"OCR substitution", "Suppliers must hold ISO 1400l.", "ISO 1400l"},
+		{"merged words", "Suppliers must hold ISO14001.", "ISO14001"},
+		{"split word", "Suppliers must hold ISO 140 01.", "ISO 140 01"},
+		{"at the start", "ISO 1401 is mandatory", "ISO 1401"},
+		{"at the end", "mandatory: IS0 14001", "IS0 14001"},
+		{"multi-word phrase", "We run carbon neutral operatons today", "carbon neutral operatons"},
+		{"two edits", "Suppliers must hold IS0 1400l.", ""},
+		{"other standard", "Suppliers must hold ISO 9001.", ""},
+		{"partial phrase at the end", "Suppliers must hold ISO", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, ok := m.match(tt.text)
+			if tt.match == "" {
+				if ok {
+					t.Errorf("matched %q, want no match", tt.text[loc[0]:loc[1]])
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("no match, want %q", tt.match)
+			}
+			if got := tt.text[loc[0]:loc[1]]; got != tt.match {
+				t.Errorf("matched %q, want %q", got, tt.match)
+			}
+		})
+	}
+}
+
+func TestFuzzyMatchAfterNormalization(t *testing.T) {
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "certification", "name": "Certification", "category": "Certifications",
+		 "fuzzy": {"phrases": ["environmental certification"], "maxDistance": 1}}
+	]}`)
+	kpiResults := CreatePkgResultForRFPPackage(kpiDefs)
+
+	//the ligature is expanded before matching, leaving one OCR error
+	MatchSegment(TextSegment{Text: "Proof of environmental certiﬁcatlon is required.", Type: SegmentParagraph}, kpiResults)
+	if !kpiResults[0].Found {
+		t.Error("fuzzy phrase did not match text with a ligature and one OCR error")
+	}
+}
+
+func TestCompileFuzzyRuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule FuzzyRule
+		want string
+	}{
+		{"no phrases", FuzzyRule{MaxDistance: 1}, "at least one phrase"},
+		{"distance too small", FuzzyRule{Phrases: []string{"ISO 14001"}}, "between 1 and 3"},
+		{"distance too large", FuzzyRule{Phrases: []string{"ISO 14001"}, MaxDistance: 4}, "between 1 and 3"},
+		{"phrase too short", FuzzyRule{Phrases: []string{"ISO 14001", "LEED"}, MaxDistance: 2}, "phrases[1]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileFuzzyRule(tt.rule, "fuzzy")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
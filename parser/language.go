@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Language detection uses the Cavnar-Trenkle "out of place" measure over character trigram
+// rank profiles. Profiles are built at start-up from the sample texts below, so detection
+// runs entirely locally.
+
+const (
+	LanguageEnglish = "en"
+	LanguageFrench  = "fr"
+)
+
+const (
+	profileSize = 300
+	//fewer letters than this is too little text to tell languages apart
+	minDetectLetters = 80
+	//text buffered per document before its language is decided
+	detectSampleChars = 4000
+)
+
+var languageSamples = map[string]string{
+	LanguageEnglish: `The proponent shall describe its approach to delivering the services outlined in this
+request for proposal. Proposals will be evaluated on the basis of experience, methodology, price and
+the sustainability commitments of the proponent. The successful vendor must maintain a quality
+management system and provide evidence of certification where requested. All submissions must be
+received by the closing date and time indicated above. Please provide details of your health and
+safety program, your environmental policy and any targets you have set for reducing greenhouse gas
+emissions. The owner reserves the right to accept or reject any proposal and to negotiate with any
+proponent. Describe how your company will support local and diverse suppliers throughout the term of
+the agreement, and how you will report on your performance each year. It is the responsibility of the
+proponent to ensure that the information provided is accurate and complete.`,
+
+	LanguageFrench: `Le soumissionnaire doit décrire son approche pour la prestation des services décrits dans
+le présent appel d'offres. Les propositions seront évaluées en fonction de l'expérience, de la
+méthodologie, du prix et des engagements du soumissionnaire en matière de développement durable.
+Le fournisseur retenu devra maintenir un système de gestion de la qualité et fournir une preuve de
+certification sur demande. Toutes les soumissions doivent être reçues avant la date et l'heure de
+clôture indiquées ci-dessus. Veuillez fournir les détails de votre programme de santé et de sécurité,
+de votre politique environnementale et des cibles que vous avez établies pour réduire les émissions
+de gaz à effet de serre. Le propriétaire se réserve le droit d'accepter ou de rejeter toute
+proposition et de négocier avec tout soumissionnaire. Décrivez comment votre entreprise appuiera les
+fournisseurs locaux et diversifiés pendant la durée de l'entente, et comment vous rendrez compte de
+votre rendement chaque année. Il incombe au soumissionnaire de s'assurer que les renseignements
+fournis sont exacts et complets.`,
+}
+
+var languageProfiles = buildLanguageProfiles()
+
+func buildLanguageProfiles() map[string]map[string]int {
+	profiles := make(map[string]map[string]int, len(languageSamples))
+	for code, sample := range languageSamples {
+		profiles[code] = trigramProfile(sample)
+	}
+	return profiles
+}
+
+// SupportedLanguages returns the language codes that can be detected
+func SupportedLanguages() []string {
+	codes := make([]string, 0, len(languageProfiles))
+	for code := range languageProfiles {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func isSupportedLanguage(code string) bool {
+	_, ok := languageProfiles[code]
+	return ok
+}
+
+// detectLanguage returns the closest supported language, or "" when there is too little text
+func detectLanguage(text string) string {
+	letters := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	if letters < minDetectLetters {
+		return ""
+	}
+
+	docProfile := trigramProfile(text)
+
+	best, bestDistance := "", -1
+	for _, code := range SupportedLanguages() {
+		distance := 0
+		for trigram, rank := range docProfile {
+			if langRank, ok := languageProfiles[code][trigram]; ok {
+				distance += abs(rank - langRank)
+			} else {
+				distance += profileSize
+			}
+		}
+		if bestDistance == -1 || distance < bestDistance {
+			best, bestDistance = code, distance
+		}
+	}
+	return best
+}
+
+// trigramProfile ranks the most frequent character trigrams of text. Words are padded with
+// "_" so word starts and endings count as trigrams too.
+func trigramProfile(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(normalizeText(text)), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		runes := []rune("_" + word + "_")
+		for i := 0; i+3 <= len(runes); i++ {
+			counts[string(runes[i:i+3])]++
+		}
+	}
+
+	trigrams := make([]string, 0, len(counts))
+	for trigram := range counts {
+		trigrams = append(trigrams, trigram)
+	}
+	sort.Slice(trigrams, func(a, b int) bool {
+		if counts[trigrams[a]] != counts[trigrams[b]] {
+			return counts[trigrams[a]] > counts[trigrams[b]]
+		}
+		return trigrams[a] < trigrams[b]
+	})
+	if len(trigrams) > profileSize {
+		trigrams = trigrams[:profileSize]
+	}
+
+	ranks := make(map[string]int, len(trigrams))
+	for i, trigram := range trigrams {
+		ranks[trigram] = i
+	}
+	return ranks
+}
+
+// WithLanguageDetection wraps emit so every segment of a document carries the document's
+// detected language. Segments are held back until enough text has been seen to decide; call
+// the returned flush function once the document has been fully extracted.
+func WithLanguageDetection(emit SegmentFunc) (SegmentFunc, func() error) {
+	var (
+		pending  []TextSegment
+		sample   strings.Builder
+		language string
+		decided  bool
+	)
+
+	release := func() error {
+		language = detectLanguage(sample.String())
+		decided = true
+		for _, seg := range pending {
+			seg.Language = language
+			if err := emit(seg); err != nil {
+				return err
+			}
+		}
+		pending = nil
+		return nil
+	}
+
+	detect := func(seg TextSegment) error {
+		if decided {
+			seg.Language = language
+			return emit(seg)
+		}
+
+		pending = append(pending, seg)
+		sample.WriteString(seg.Text)
+		sample.WriteString("\n")
+		if sample.Len() >= detectSampleChars {
+			return release()
+		}
+		return nil
+	}
+
+	flush := func() error {
+		if decided {
+			return nil
+		}
+		return release()
+	}
+
+	return detect, flush
+}
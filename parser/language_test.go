@@ -0,0 +1,151 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	englishText = `Proposals will be evaluated on experience, methodology and price. The contractor must
+provide a health and safety plan and maintain its certification for the term of the agreement.`
+	frenchText = `Les propositions seront évaluées selon l'expérience, la méthodologie et le prix. L'entrepreneur
+doit fournir un plan de santé et sécurité et maintenir sa certification pendant toute la durée de l'entente.`
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", englishText, LanguageEnglish},
+		{"french", frenchText, LanguageFrench},
+		{"english in capitals", strings.ToUpper(englishText), LanguageEnglish},
+		{"french without accents", "Les soumissions doivent etre recues avant la date de cloture indiquee et le fournisseur doit fournir une preuve de certification.", LanguageFrench},
+		{"too short", "The contractor must be certified.", ""},
+		{"numbers only", strings.Repeat("2026 14001 100% $5,000 ", 20), ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportedLanguages(t *testing.T) {
+	if got, want := SupportedLanguages(), []string{LanguageEnglish, LanguageFrench}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SupportedLanguages = %v, want %v", got, want)
+	}
+	if isSupportedLanguage("de") {
+		t.Error("de reported as supported")
+	}
+}
+
+// collectSegments is a SegmentFunc recording what it receives
+type collectSegments struct {
+	segs []TextSegment
+}
+
+func (c *collectSegments) emit(seg TextSegment) error {
+	c.segs = append(c.segs, seg)
+	return nil
+}
+
+func TestWithLanguageDetectionBuffersUntilFlush(t *testing.T) {
+	var got collectSegments
+	detect, flush := WithLanguageDetection(got.emit)
+
+	//too little text to decide, everything is held back
+	for _, seg := range []TextSegment{
+		{Text: "Évaluation des propositions", Location: "paragraph 1"},
+		{Text: frenchText, Location: "paragraph 2"},
+	} {
+		if err := detect(seg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got.segs) != 0 {
+		t.Fatalf("%d segments emitted before flush, want them held back", len(got.segs))
+	}
+
+	if err := flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.segs) != 2 || got.segs[0].Location != "paragraph 1" || got.segs[1].Location != "paragraph 2" {
+		t.Fatalf("flush emitted %+v, want both segments in order", got.segs)
+	}
+	for _, seg := range got.segs {
+		if seg.Language != LanguageFrench {
+			t.Errorf("segment %s language = %q, want %q", seg.Location, seg.Language, LanguageFrench)
+		}
+	}
+
+	//a second flush emits nothing again
+	if err := flush(); err != nil || len(got.segs) != 2 {
+		t.Errorf("second flush emitted %d segments, error %v", len(got.segs)-2, err)
+	}
+}
+
+func TestWithLanguageDetectionDecidesOnceSampled(t *testing.T) {
+	var got collectSegments
+	detect, flush := WithLanguageDetection(got.emit)
+
+	sent := 0
+	for sent*len(englishText) < detectSampleChars {
+		if err := detect(TextSegment{Text: englishText}); err != nil {
+			t.Fatal(err)
+		}
+		sent++
+	}
+	//the sample is full, the held back segments are released without waiting for flush
+	if len(got.segs) != sent {
+		t.Fatalf("%d of %d segments emitted once the sample was full", len(got.segs), sent)
+	}
+
+	//later segments pass straight through with the decided language, even in another language
+	if err := detect(TextSegment{Text: frenchText}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.segs) != sent+1 {
+		t.Fatalf("segment after the decision was held back")
+	}
+	if err := flush(); err != nil {
+		t.Fatal(err)
+	}
+	for i, seg := range got.segs {
+		if seg.Language != LanguageEnglish {
+			t.Errorf("segment %d language = %q, want %q", i, seg.Language, LanguageEnglish)
+		}
+	}
+}
+
+func TestWithLanguageDetectionShortDocument(t *testing.T) {
+	var got collectSegments
+	detect, flush := WithLanguageDetection(got.emit)
+
+	detect(TextSegment{Text: "Appendix A"})
+	if err := flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.segs) != 1 || got.segs[0].Language != "" {
+		t.Errorf("flush emitted %+v, want the segment without a language", got.segs)
+	}
+}
+
+func TestWithLanguageDetectionEmitError(t *testing.T) {
+	errStop := errors.New("stop")
+	detect, flush := WithLanguageDetection(func(TextSegment) error { return errStop })
+
+	if err := detect(TextSegment{Text: englishText}); err != nil {
+		t.Fatalf("detect error = %v, want nil while the segment is held back", err)
+	}
+	if err := flush(); !errors.Is(err, errStop) {
+		t.Errorf("flush error = %v, want the emit error", err)
+	}
+}
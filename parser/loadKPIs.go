@@ -1,55 +1,425 @@
 package parser
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 )
 
+// KPIDefinitionFile is the versioned layout of kpiDefinitions.json
+type KPIDefinitionFile struct {
+	Version      int                 `json:"version"`
+	StrengthCues *StrengthCues       `json:"strengthCues,omitempty"`
+	Scoring      *ScoringSettings    `json:"scoring,omitempty"`
+	Context      *ContextSettings    `json:"context,omitempty"`
+	Macros       map[string]string   `json:"macros,omitempty"`   //regex fragments referenced as {{name}}
+	Synonyms     map[string][]string `json:"synonyms,omitempty"` //literal phrase lists referenced as {{name}}
+	KPIs         []KPIDefinition     `json:"kpis"`
+
+	settings *matchSettings
+}
+
 type KPIDefinition struct {
-	Name      string           `json:"name"`
-	Category  string           `json:"category"`
-	Regexps   []*regexp.Regexp `json:"-"`
-	RegexStrs []string         `json:"regexps"` //temporary holder
+	ID            string                     `json:"id"`
+	Name          string                     `json:"name"`
+	Category      string                     `json:"category"`
+	Description   string                     `json:"description,omitempty"`
+	Owner         string                     `json:"owner,omitempty"`
+	Enabled       *bool                      `json:"enabled,omitempty"`
+	Tags          []string                   `json:"tags,omitempty"`
+	Weight        *float64                   `json:"weight,omitempty"`        //scales the KPI's score, default 1
+	EffectiveFrom string                     `json:"effectiveFrom,omitempty"` //YYYY-MM-DD
+	RegexStrs     []string                   `json:"regexps,omitempty"`       //matches when any pattern matches - use Rule for anything stricter
+	Rule          *Rule                      `json:"rule,omitempty"`
+	Fuzzy         *FuzzyRule                 `json:"fuzzy,omitempty"`   //opt-in approximate matching, in addition to regexps or rule
+	Exclude       []string                   `json:"exclude,omitempty"` //sentences matching any of these are never reported
+	Sections      *SectionFilter             `json:"sections,omitempty"`
+	Languages     map[string]LanguageVariant `json:"languages,omitempty"` //extra patterns per language code, e.g. "fr"
+	Examples      *KPIExamples               `json:"examples,omitempty"`
+	Regexps       []*regexp.Regexp           `json:"-"`
+
+	matcher         ruleMatcher
+	langMatchers    map[string]ruleMatcher
+	excludes        []*regexp.Regexp
+	includeSections []*regexp.Regexp
+	excludeSections []*regexp.Regexp
+	settings        *matchSettings
+}
+
+// SectionFilter restricts a KPI to text under matching section paths, e.g.
+// {"include": ["(?i)evaluation criteria"], "exclude": ["(?i)sample contract"]}
+type SectionFilter struct {
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// LanguageVariant adds patterns for documents detected as being in one language. They are
+// matched alongside the definition's own regexps, rule and fuzzy phrases.
+type LanguageVariant struct {
+	RegexStrs []string   `json:"regexps,omitempty"`
+	Rule      *Rule      `json:"rule,omitempty"`
+	Fuzzy     *FuzzyRule `json:"fuzzy,omitempty"`
+}
+
+// legacyKPIDefinition is the unversioned format: a bare array of definitions without IDs
+type legacyKPIDefinition struct {
+	Name      string   `json:"name"`
+	Category  string   `json:"category"`
+	RegexStrs []string `json:"regexps"`
+	Found     bool     `json:"found"` //never read - kept so legacy files still decode strictly
 }
 
 const KPIDefPath = "./parser/kpiDefinitions.json"
 
-func LoadKPIDefinitions() ([]KPIDefinition, error) {
-	jsonFile, err := os.Open(KPIDefPath)
+const KPISchemaVersion = 2
+
+// EffectiveFromLayout is the date format of KPIDefinition.EffectiveFrom
+const EffectiveFromLayout = "2006-01-02"
+
+var kpiIDRule = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+func LoadKPIDefinitions() (*KPIDefinitionFile, error) {
+	data, err := os.ReadFile(KPIDefPath)
 	if err != nil {
 		return nil, err
 	}
-	defer jsonFile.Close()
+	return DecodeKPIDefinitions(data)
+}
 
-	decoder := json.NewDecoder(jsonFile)
+// DecodeKPIDefinitions strictly decodes a definitions file and expands its macros. Unknown fields
+// are rejected. Files in the legacy unversioned format are migrated in memory.
+func DecodeKPIDefinitions(data []byte) (*KPIDefinitionFile, error) {
+	defFile, err := DecodeKPIDefinitionsUnchecked(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if issues := expandKPIMacros(defFile); len(issues) > 0 {
+		return nil, issues[0]
+	}
+
+	if issues := checkKPIDefinitions(defFile.KPIs); len(issues) > 0 {
+		return nil, issues[0]
+	}
+	return defFile, nil
+}
+
+// DecodeKPIDefinitionsUnchecked decodes a definitions file without checking the definitions
+// themselves, so ValidateKPIDefinitions can report every problem at once.
+func DecodeKPIDefinitionsUnchecked(data []byte) (*KPIDefinitionFile, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		kpiDefs, err := decodeLegacyKPIDefinitions(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		return &KPIDefinitionFile{Version: KPISchemaVersion, KPIs: kpiDefs}, nil
+	}
+
+	var defFile KPIDefinitionFile
+	if err := decodeStrict(trimmed, &defFile); err != nil {
+		return nil, fmt.Errorf("decoding KPI definitions: %w", err)
+	}
+
+	if defFile.Version != KPISchemaVersion {
+		return nil, fmt.Errorf("unsupported KPI definitions version %d, expected %d", defFile.Version, KPISchemaVersion)
+	}
+
+	if len(defFile.KPIs) == 0 {
+		return nil, fmt.Errorf("kpiDefinition.json file does not contain KPI Definition parsing content")
+	}
 
-	var kpiDefs []KPIDefinition
+	return &defFile, nil
+}
 
-	err = decoder.Decode(&kpiDefs)
+// MigrateLegacyKPIDefinitions converts a legacy definitions file into the current versioned format
+func MigrateLegacyKPIDefinitions(data []byte) ([]byte, error) {
+	kpiDefs, err := decodeLegacyKPIDefinitions(bytes.TrimSpace(data))
 	if err != nil {
 		return nil, err
 	}
 
-	if len(kpiDefs) == 0 {
+	defFile := KPIDefinitionFile{
+		Version: KPISchemaVersion,
+		KPIs:    kpiDefs,
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	if err := encoder.Encode(defFile); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeLegacyKPIDefinitions(data []byte) ([]KPIDefinition, error) {
+	var legacyDefs []legacyKPIDefinition
+	if err := decodeStrict(data, &legacyDefs); err != nil {
+		return nil, fmt.Errorf("decoding legacy KPI definitions: %w", err)
+	}
+
+	if len(legacyDefs) == 0 {
 		return nil, fmt.Errorf("kpiDefinition.json file does not contain KPI Definition parsing content")
 	}
 
+	kpiDefs := make([]KPIDefinition, 0, len(legacyDefs))
+	for _, legacy := range legacyDefs {
+		kpiDefs = append(kpiDefs, KPIDefinition{
+			ID:        legacyKPIID(legacy.Name),
+			Name:      legacy.Name,
+			Category:  legacy.Category,
+			RegexStrs: legacy.RegexStrs,
+		})
+	}
+
 	return kpiDefs, nil
 }
 
-func CompileRegexStrings(kpiDefs []KPIDefinition) ([]KPIDefinition, error) {
-	for i := range kpiDefs {
-		compiled := make([]*regexp.Regexp, 0, len(kpiDefs[i].RegexStrs))
-		for _, pattern := range kpiDefs[i].RegexStrs {
-			re, err := regexp.Compile(pattern)
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after top-level value")
+	}
+	return nil
+}
+
+// legacyKPIID derives a stable ID from a legacy KPI name, e.g. "ISO 9001 Quality" -> "iso-9001-quality"
+func legacyKPIID(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-")
+}
+
+// Compile prepares every definition and the file-level settings for matching
+func (f *KPIDefinitionFile) Compile() error {
+	settings, err := compileMatchSettings(f)
+	if err != nil {
+		return err
+	}
+	f.settings = settings
+
+	for i := range f.KPIs {
+		if err := f.KPIs[i].compile(); err != nil {
+			return fmt.Errorf("KPI definition %d (%s %q) %w", i, f.KPIs[i].ID, f.KPIs[i].Name, err)
+		}
+		f.KPIs[i].settings = settings
+	}
+	return nil
+}
+
+func (d *KPIDefinition) compile() error {
+	m, compiled, err := compileMatcher(d.RegexStrs, d.Rule, d.Fuzzy, "")
+	if err != nil {
+		return err
+	}
+	d.matcher = m
+	d.Regexps = compiled
+
+	d.langMatchers = nil
+	for lang, variant := range d.Languages {
+		if !isSupportedLanguage(lang) {
+			return fmt.Errorf("languages.%s: unsupported language, expected one of %v", lang, SupportedLanguages())
+		}
+		variantMatcher, _, err := compileMatcher(variant.RegexStrs, variant.Rule, variant.Fuzzy, "languages."+lang+".")
+		if err != nil {
+			return err
+		}
+		if d.langMatchers == nil {
+			d.langMatchers = make(map[string]ruleMatcher, len(d.Languages))
+		}
+		d.langMatchers[lang] = anyMatcher{subs: []ruleMatcher{d.matcher, variantMatcher}}
+	}
+
+	excludes, err := compilePatterns(d.Exclude, "exclude")
+	if err != nil {
+		return err
+	}
+	d.excludes = excludes
+
+	if d.Sections != nil {
+		if d.includeSections, err = compilePatterns(d.Sections.Include, "sections.include"); err != nil {
+			return err
+		}
+		if d.excludeSections, err = compilePatterns(d.Sections.Exclude, "sections.exclude"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compileMatcher builds the matcher for one set of regexps, rule and fuzzy phrases. prefix locates
+// the set in error messages.
+func compileMatcher(regexStrs []string, rule *Rule, fuzzy *FuzzyRule, prefix string) (ruleMatcher, []*regexp.Regexp, error) {
+	if rule != nil && len(regexStrs) > 0 {
+		return nil, nil, fmt.Errorf("%srule: set either regexps or rule, not both", prefix)
+	}
+
+	var m ruleMatcher
+	var compiled []*regexp.Regexp
+	if rule != nil {
+		var err error
+		if m, err = compileRule(*rule, prefix+"rule"); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		compiled = make([]*regexp.Regexp, 0, len(regexStrs))
+		subs := make([]ruleMatcher, 0, len(regexStrs))
+		for j, pattern := range regexStrs {
+			re, err := compilePattern(pattern, fmt.Sprintf("%sregexps[%d]", prefix, j))
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			compiled = append(compiled, re)
+			subs = append(subs, patternMatcher{re: re})
 		}
-		kpiDefs[i].Regexps = compiled
+		m = anyMatcher{subs: subs}
 	}
-	return kpiDefs, nil
+
+	if fuzzy != nil {
+		fm, err := compileFuzzyRule(*fuzzy, prefix+"fuzzy")
+		if err != nil {
+			return nil, nil, err
+		}
+		m = anyMatcher{subs: []ruleMatcher{m, fm}}
+	}
+
+	return m, compiled, nil
+}
+
+func compilePatterns(patterns []string, field string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for j, pattern := range patterns {
+		re, err := compilePattern(pattern, fmt.Sprintf("%s[%d]", field, j))
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// inSection reports whether text under section may match the definition
+func (d *KPIDefinition) inSection(section string) bool {
+	for _, re := range d.excludeSections {
+		if re.MatchString(section) {
+			return false
+		}
+	}
+	if len(d.includeSections) == 0 {
+		return true
+	}
+	for _, re := range d.includeSections {
+		if re.MatchString(section) {
+			return true
+		}
+	}
+	return false
+}
+
+// match uses the definition's variant for language, when it has one, alongside its own patterns
+func (d *KPIDefinition) match(text, language string) ([]int, bool) {
+	if m, ok := d.langMatchers[language]; ok {
+		return m.match(text)
+	}
+	if d.matcher == nil {
+		return nil, false
+	}
+	return d.matcher.match(text)
+}
+
+func (d *KPIDefinition) weight() float64 {
+	if d.Weight == nil {
+		return 1
+	}
+	return *d.Weight
+}
+
+func (d *KPIDefinition) matchSettings() *matchSettings {
+	if d.settings == nil {
+		return defaultMatchSettings
+	}
+	return d.settings
+}
+
+func (d *KPIDefinition) excluded(sentence string) bool {
+	for _, re := range d.excludes {
+		if re.MatchString(sentence) {
+			return true
+		}
+	}
+	return false
+}
+
+// ActiveKPIDefinitions drops definitions that are disabled or not yet effective at now
+func ActiveKPIDefinitions(kpiDefs []KPIDefinition, now time.Time) []KPIDefinition {
+	active := make([]KPIDefinition, 0, len(kpiDefs))
+	for _, def := range kpiDefs {
+		if def.IsActive(now) {
+			active = append(active, def)
+		}
+	}
+	return active
+}
+
+func (d KPIDefinition) IsActive(now time.Time) bool {
+	if d.Enabled != nil && !*d.Enabled {
+		return false
+	}
+	if d.EffectiveFrom != "" {
+		from, err := time.ParseInLocation(EffectiveFromLayout, d.EffectiveFrom, now.Location())
+		if err == nil && now.Before(from) {
+			return false
+		}
+	}
+	return true
+}
+
+// Key identifies a KPI definition across runs. It is the stable ID, so renaming a KPI keeps its history.
+func (d KPIDefinition) Key() string {
+	return d.ID
+}
+
+// ContentHash changes whenever the parts of a definition that affect matching, reporting or scoring
+// change, including the file-level strength cues, scoring and context settings it was compiled with
+func (d KPIDefinition) ContentHash() string {
+	content := struct {
+		Name      string                     `json:"name"`
+		Category  string                     `json:"category"`
+		RegexStrs []string                   `json:"regexps"`
+		Rule      *Rule                      `json:"rule,omitempty"`
+		Exclude   []string                   `json:"exclude,omitempty"`
+		Fuzzy     *FuzzyRule                 `json:"fuzzy,omitempty"`
+		Sections  *SectionFilter             `json:"sections,omitempty"`
+		Languages map[string]LanguageVariant `json:"languages,omitempty"`
+		Weight    *float64                   `json:"weight,omitempty"`
+		Settings  string                     `json:"settings,omitempty"` //omitted for the default settings
+	}{d.Name, d.Category, d.RegexStrs, d.Rule, d.Exclude, d.Fuzzy, d.Sections, d.Languages, d.Weight, d.matchSettings().hash}
+
+	b, _ := json.Marshal(content)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMigrateLegacyKPIDefinitions(t *testing.T) {
+	legacy := []byte(`[{"name": "ISO 9001 Quality", "category": "Certifications", "regexps": ["\\bISO 9001\\b"], "found": false}]`)
+
+	migrated, err := MigrateLegacyKPIDefinitions(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defFile, err := DecodeKPIDefinitions(migrated)
+	if err != nil {
+		t.Fatalf("migrated file does not decode: %v\n%s", err, migrated)
+	}
+	if defFile.Version != KPISchemaVersion {
+		t.Errorf("version = %d, want %d", defFile.Version, KPISchemaVersion)
+	}
+	if len(defFile.KPIs) != 1 || defFile.KPIs[0].ID != "iso-9001-quality" {
+		t.Errorf("KPIs = %+v, want one with ID iso-9001-quality", defFile.KPIs)
+	}
+}
+
+func TestMigrateLegacyKPIDefinitionsRejectsVersionedFiles(t *testing.T) {
+	if _, err := MigrateLegacyKPIDefinitions([]byte(`{"version": 2, "kpis": []}`)); err == nil {
+		t.Error("expected an error for a versioned file")
+	}
+}
+
+// compileKPIs decodes and compiles a definitions file for matching
+func compileKPIs(t *testing.T, data string) []KPIDefinition {
+	t.Helper()
+
+	defFile, err := DecodeKPIDefinitions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := defFile.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	return defFile.KPIs
+}
+
+func TestContentHash(t *testing.T) {
+	const kpi = `{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["(?i)iso 14001"]%s}`
+	file := func(settings, kpiFields string) string {
+		return `{"version": 2, ` + settings + `"kpis": [` + fmt.Sprintf(kpi, kpiFields) + `]}`
+	}
+	base := compileKPIs(t, file("", ""))[0].ContentHash()
+
+	tests := []struct {
+		name    string
+		data    string
+		changed bool
+	}{
+		{"same definition", file("", ""), false},
+		{"description", file("", `, "description": "Environmental management", "owner": "Sustainability"`), false},
+		{"tags and effective date", file("", `, "tags": ["environment"], "effectiveFrom": "2026-01-01"`), false},
+		{"weight", file("", `, "weight": 2`), true},
+		{"exclusions", file("", `, "exclude": ["(?i)not required"]`), true},
+		{"strength cues", file(`"strengthCues": {"mandatory": ["must"]}, `, ""), true},
+		{"scoring", file(`"scoring": {"categoryWeights": {"Certifications": 2}}, `, ""), true},
+		{"context", file(`"context": {"maxLength": 200}, `, ""), true},
+		{"macros only", file(`"macros": {"unused": "x"}, `, ""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := compileKPIs(t, tt.data)[0].ContentHash()
+			if changed := hash != base; changed != tt.changed {
+				t.Errorf("hash changed = %t, want %t", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestContentHashDefaultSettings(t *testing.T) {
+	//definitions compiled with the default settings keep the hashes recorded before settings were hashed
+	def := KPIDefinition{ID: "iso-14001", Name: "ISO 14001", Category: "Certifications", RegexStrs: []string{"(?i)iso 14001"}}
+	compiled := compileKPIs(t, `{"version": 2, "kpis": [{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["(?i)iso 14001"]}]}`)[0]
+
+	if def.ContentHash() != compiled.ContentHash() {
+		t.Error("compiling with the default settings changed the content hash")
+	}
+}
@@ -0,0 +1,203 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// macroRef matches a {{name}} reference in a pattern
+var macroRef = regexp.MustCompile(`\{\{\s*([A-Za-z][A-Za-z0-9_-]*)\s*\}\}`)
+
+var macroNameRule = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// maxMacroDepth bounds macros that reference other macros
+const maxMacroDepth = 10
+
+// compileMacros resolves the file's macros and synonym lists into regex fragments keyed by name.
+// Macros are regex fragments and may reference other macros. Synonyms are literal phrases,
+// matched case-insensitively with any whitespace between words. On error, field names the bad entry.
+func compileMacros(defFile *KPIDefinitionFile) (map[string]string, string, error) {
+	fragments := make(map[string]string, len(defFile.Macros)+len(defFile.Synonyms))
+
+	for _, name := range sortedKeys(defFile.Synonyms) {
+		if !macroNameRule.MatchString(name) {
+			return nil, fmt.Sprintf("synonyms.%s", name), errors.New("invalid name - use letters, digits, '-' and '_'")
+		}
+		phrases := defFile.Synonyms[name]
+		if len(phrases) == 0 {
+			return nil, fmt.Sprintf("synonyms.%s", name), errors.New("no phrases defined")
+		}
+		alternatives := make([]string, 0, len(phrases))
+		for i, phrase := range phrases {
+			if strings.TrimSpace(phrase) == "" {
+				return nil, fmt.Sprintf("synonyms.%s[%d]", name, i), errors.New("phrase is empty")
+			}
+			alternatives = append(alternatives, phrasePattern(phrase))
+		}
+		fragments[name] = `(?i:` + strings.Join(alternatives, "|") + `)`
+	}
+
+	for _, name := range sortedKeys(defFile.Macros) {
+		if !macroNameRule.MatchString(name) {
+			return nil, fmt.Sprintf("macros.%s", name), errors.New("invalid name - use letters, digits, '-' and '_'")
+		}
+		if _, ok := fragments[name]; ok {
+			return nil, fmt.Sprintf("macros.%s", name), errors.New("name is also used by a synonym list")
+		}
+		if strings.TrimSpace(defFile.Macros[name]) == "" {
+			return nil, fmt.Sprintf("macros.%s", name), errors.New("pattern is empty")
+		}
+	}
+
+	for _, name := range sortedKeys(defFile.Macros) {
+		fragment, err := expandMacroRefs(defFile.Macros[name], defFile.Macros, fragments, 1)
+		if err != nil {
+			return nil, fmt.Sprintf("macros.%s", name), err
+		}
+		if _, err := regexp.Compile(fragment); err != nil {
+			return nil, fmt.Sprintf("macros.%s", name), fmt.Errorf("invalid pattern %q: %w", fragment, err)
+		}
+		fragments[name] = `(?:` + fragment + `)`
+	}
+
+	return fragments, "", nil
+}
+
+// expandMacroRefs replaces the {{name}} references in pattern, expanding macros recursively
+func expandMacroRefs(pattern string, macros map[string]string, fragments map[string]string, depth int) (string, error) {
+	if depth > maxMacroDepth {
+		return "", fmt.Errorf("macros nested more than %d deep - check for a macro that references itself", maxMacroDepth)
+	}
+
+	var expandErr error
+	expanded := macroRef.ReplaceAllStringFunc(pattern, func(ref string) string {
+		name := macroRef.FindStringSubmatch(ref)[1]
+		if raw, ok := macros[name]; ok {
+			fragment, err := expandMacroRefs(raw, macros, fragments, depth+1)
+			if err != nil && expandErr == nil {
+				expandErr = err
+			}
+			return `(?:` + fragment + `)`
+		}
+		if fragment, ok := fragments[name]; ok {
+			return fragment
+		}
+		if expandErr == nil {
+			expandErr = fmt.Errorf("unknown macro %q", ref)
+		}
+		return ref
+	})
+	return expanded, expandErr
+}
+
+// expandKPIMacros replaces the macro references in every pattern of defFile's definitions.
+// Expanded fields are newly allocated, so a shallow copy of defFile can be expanded without
+// touching the original.
+func expandKPIMacros(defFile *KPIDefinitionFile) []ValidationIssue {
+	fragments, field, err := compileMacros(defFile)
+	if err != nil {
+		return []ValidationIssue{{Severity: SeverityError, Index: -1, Field: field, Message: err.Error()}}
+	}
+
+	var issues []ValidationIssue
+	for i := range defFile.KPIs {
+		def := &defFile.KPIs[i]
+		expand := func(field, pattern string) string {
+			expanded, err := expandMacroRefs(pattern, nil, fragments, 1)
+			if err != nil {
+				issues = append(issues, ValidationIssue{
+					Severity: SeverityError,
+					Index:    i,
+					KPIID:    def.ID,
+					KPIName:  def.Name,
+					Field:    field,
+					Message:  err.Error(),
+				})
+			}
+			return expanded
+		}
+
+		def.RegexStrs = expandPatterns(def.RegexStrs, "regexps", expand)
+		def.Exclude = expandPatterns(def.Exclude, "exclude", expand)
+		if def.Rule != nil {
+			rule := expandRule(*def.Rule, "rule", expand)
+			def.Rule = &rule
+		}
+		if def.Sections != nil {
+			def.Sections = &SectionFilter{
+				Include: expandPatterns(def.Sections.Include, "sections.include", expand),
+				Exclude: expandPatterns(def.Sections.Exclude, "sections.exclude", expand),
+			}
+		}
+		if def.Languages != nil {
+			languages := make(map[string]LanguageVariant, len(def.Languages))
+			for lang, variant := range def.Languages {
+				prefix := "languages." + lang + "."
+				expandedVariant := LanguageVariant{
+					RegexStrs: expandPatterns(variant.RegexStrs, prefix+"regexps", expand),
+					Fuzzy:     variant.Fuzzy,
+				}
+				if variant.Rule != nil {
+					rule := expandRule(*variant.Rule, prefix+"rule", expand)
+					expandedVariant.Rule = &rule
+				}
+				languages[lang] = expandedVariant
+			}
+			def.Languages = languages
+		}
+	}
+	return issues
+}
+
+func expandPatterns(patterns []string, field string, expand func(field, pattern string) string) []string {
+	if patterns == nil {
+		return nil
+	}
+	expanded := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		expanded[i] = expand(fmt.Sprintf("%s[%d]", field, i), pattern)
+	}
+	return expanded
+}
+
+func expandRule(r Rule, path string, expand func(field, pattern string) string) Rule {
+	expanded := r
+	if r.Pattern != "" {
+		expanded.Pattern = expand(path+".pattern", r.Pattern)
+	}
+	if r.All != nil {
+		expanded.All = make([]Rule, len(r.All))
+		for i, sub := range r.All {
+			expanded.All[i] = expandRule(sub, fmt.Sprintf("%s.all[%d]", path, i), expand)
+		}
+	}
+	if r.Any != nil {
+		expanded.Any = make([]Rule, len(r.Any))
+		for i, sub := range r.Any {
+			expanded.Any[i] = expandRule(sub, fmt.Sprintf("%s.any[%d]", path, i), expand)
+		}
+	}
+	if r.Not != nil {
+		not := expandRule(*r.Not, path+".not", expand)
+		expanded.Not = &not
+	}
+	if r.Near != nil {
+		expanded.Near = &NearRule{
+			Patterns: expandPatterns(r.Near.Patterns, path+".near.patterns", expand),
+			Distance: r.Near.Distance,
+		}
+	}
+	return expanded
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,208 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decodeMacroFile(t *testing.T, data string) *KPIDefinitionFile {
+	t.Helper()
+
+	defFile, err := DecodeKPIDefinitionsUnchecked([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return defFile
+}
+
+func TestExpandKPIMacros(t *testing.T) {
+	defFile := decodeMacroFile(t, `{"version": 2,
+		"synonyms": {"certified": ["certified", "accredited", "ISO  certified"]},
+		"macros": {"sustainab": "sustainab(le|ility)", "sdgs": "{{sustainab}} development goals", "sdg-cert": "{{ sdgs }} {{certified}}"},
+		"kpis": [{"id": "sdg", "name": "SDGs", "category": "Policies",
+			"regexps": ["(?i)\\b{{sdgs}}\\b", "plain"],
+			"exclude": ["{{certified}} auditor"],
+			"sections": {"include": ["(?i){{sustainab}}"]},
+			"languages": {"fr": {"rule": {"pattern": "{{sustainab}}"}}}
+		}, {"id": "cert", "name": "Certification", "category": "Certifications",
+			"rule": {"all": [{"near": {"patterns": ["ISO 14001", "{{certified}}"], "distance": 5}}, {"not": {"pattern": "{{sdg-cert}}"}}]}
+		}]
+	}`)
+
+	if issues := expandKPIMacros(defFile); len(issues) > 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+
+	sdg, cert := defFile.KPIs[0], defFile.KPIs[1]
+	wantRegexps := []string{`(?i)\b(?:(?:sustainab(le|ility)) development goals)\b`, "plain"}
+	if !reflect.DeepEqual(sdg.RegexStrs, wantRegexps) {
+		t.Errorf("regexps = %q, want %q", sdg.RegexStrs, wantRegexps)
+	}
+	if want := `(?i)(?:sustainab(le|ility))`; sdg.Sections.Include[0] != want {
+		t.Errorf("sections.include = %q, want %q", sdg.Sections.Include[0], want)
+	}
+	if want := `(?:sustainab(le|ility))`; sdg.Languages["fr"].Rule.Pattern != want {
+		t.Errorf("languages.fr.rule = %q, want %q", sdg.Languages["fr"].Rule.Pattern, want)
+	}
+
+	//the expanded patterns match as the macros describe
+	if err := defFile.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	sdg, cert = defFile.KPIs[0], defFile.KPIs[1]
+	matches := []struct {
+		def   KPIDefinition
+		text  string
+		match bool
+	}{
+		{sdg, "We support the Sustainable Development Goals.", true},
+		{sdg, "We support the sustainable goals.", false},
+		{cert, "The site is ISO 14001 Accredited.", true},
+		//synonym phrases allow any whitespace between words
+		{cert, "ISO 14001 ISO \t certified", true},
+		{cert, "ISO 14001 sustainable development goals certified", false},
+	}
+	for _, m := range matches {
+		if _, ok := m.def.match(m.text, ""); ok != m.match {
+			t.Errorf("%s matched %q = %t, want %t", m.def.ID, m.text, ok, m.match)
+		}
+	}
+	if !sdg.excluded("an accredited auditor") {
+		t.Error("exclude with a synonym list did not match")
+	}
+}
+
+func TestExpandKPIMacrosLeavesOriginal(t *testing.T) {
+	defFile := decodeMacroFile(t, `{"version": 2, "macros": {"iso": "ISO 14001"},
+		"kpis": [{"id": "iso", "name": "ISO", "category": "Certifications", "regexps": ["{{iso}}"]}]}`)
+
+	original := defFile.KPIs
+	copyFile := *defFile
+	copyFile.KPIs = append([]KPIDefinition(nil), defFile.KPIs...)
+	if issues := expandKPIMacros(&copyFile); len(issues) > 0 {
+		t.Fatalf("unexpected issues: %v", issues)
+	}
+
+	if original[0].RegexStrs[0] != "{{iso}}" {
+		t.Errorf("original regexps = %q, want them unexpanded", original[0].RegexStrs)
+	}
+	if copyFile.KPIs[0].RegexStrs[0] != "(?:ISO 14001)" {
+		t.Errorf("copy regexps = %q, want them expanded", copyFile.KPIs[0].RegexStrs)
+	}
+}
+
+func TestExpandKPIMacrosErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		settings  string
+		regexp    string
+		wantField string
+		wantIndex int
+		want      string
+	}{
+		{
+			name:      "undefined in a KPI",
+			regexp:    "{{missing}}",
+			wantField: "regexps[0]",
+			wantIndex: 0,
+			want:      `unknown macro "{{missing}}"`,
+		},
+		{
+			name:      "undefined in a macro",
+			settings:  `"macros": {"outer": "{{missing}}"},`,
+			regexp:    "{{outer}}",
+			wantField: "macros.outer",
+			wantIndex: -1,
+			want:      "unknown macro",
+		},
+		{
+			name:      "self reference",
+			settings:  `"macros": {"loop": "a{{loop}}"},`,
+			regexp:    "{{loop}}",
+			wantField: "macros.loop",
+			wantIndex: -1,
+			want:      "references itself",
+		},
+		{
+			name:      "cycle",
+			settings:  `"macros": {"a": "x{{b}}", "b": "y{{a}}"},`,
+			regexp:    "{{a}}",
+			wantField: "macros.a",
+			wantIndex: -1,
+			want:      "nested more than",
+		},
+		{
+			name:      "invalid fragment",
+			settings:  `"macros": {"open": "(unclosed"},`,
+			regexp:    "{{open}}",
+			wantField: "macros.open",
+			wantIndex: -1,
+			want:      "invalid pattern",
+		},
+		{
+			name:      "empty macro",
+			settings:  `"macros": {"blank": "  "},`,
+			regexp:    "x",
+			wantField: "macros.blank",
+			wantIndex: -1,
+			want:      "pattern is empty",
+		},
+		{
+			name:      "invalid name",
+			settings:  `"macros": {"1st": "x"},`,
+			regexp:    "x",
+			wantField: "macros.1st",
+			wantIndex: -1,
+			want:      "invalid name",
+		},
+		{
+			name:      "name used twice",
+			settings:  `"macros": {"cert": "x"}, "synonyms": {"cert": ["certified"]},`,
+			regexp:    "x",
+			wantField: "macros.cert",
+			wantIndex: -1,
+			want:      "also used by a synonym list",
+		},
+		{
+			name:      "empty synonym list",
+			settings:  `"synonyms": {"cert": []},`,
+			regexp:    "x",
+			wantField: "synonyms.cert",
+			wantIndex: -1,
+			want:      "no phrases",
+		},
+		{
+			name:      "empty synonym",
+			settings:  `"synonyms": {"cert": ["certified", " "]},`,
+			regexp:    "x",
+			wantField: "synonyms.cert[1]",
+			wantIndex: -1,
+			want:      "phrase is empty",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defFile := decodeMacroFile(t, `{"version": 2, `+tt.settings+`
+				"kpis": [{"id": "kpi", "name": "KPI", "category": "Policies", "regexps": ["`+tt.regexp+`"]}]}`)
+
+			issues := expandKPIMacros(defFile)
+			if len(issues) != 1 {
+				t.Fatalf("got %d issues, want 1: %v", len(issues), issues)
+			}
+			issue := issues[0]
+			if issue.Severity != SeverityError || issue.Field != tt.wantField || issue.Index != tt.wantIndex || !strings.Contains(issue.Message, tt.want) {
+				t.Errorf("issue = %+v, want an error on %s (index %d) containing %q", issue, tt.wantField, tt.wantIndex, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeKPIDefinitionsReportsMacroErrors(t *testing.T) {
+	_, err := DecodeKPIDefinitions([]byte(`{"version": 2,
+		"kpis": [{"id": "kpi", "name": "KPI", "category": "Policies", "regexps": ["{{missing}}"]}]}`))
+	if err == nil || !strings.Contains(err.Error(), "unknown macro") {
+		t.Errorf("error = %v, want the unknown macro", err)
+	}
+}
@@ -0,0 +1,38 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// typographicReplacer folds characters that NFKC leaves alone but that defeat plain regexes:
+// smart quotes, dashes, soft hyphens and zero-width characters
+var typographicReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'", "\u2032", "'",
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`, "\u2033", `"`,
+	"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2014", "-", "\u2015", "-", "\u2212", "-",
+	"\u00ad", "", "\u200b", "", "\u200c", "", "\u200d", "", "\u2060", "", "\ufeff", "",
+)
+
+// hyphenatedBreak joins words split across lines by a hyphen, e.g. "sustain-\nability"
+var hyphenatedBreak = regexp.MustCompile(`(\p{L})-[ \t]*\n[ \t]*(\p{Ll})`)
+
+// normalizeText applies NFKC (which also expands ligatures such as "ﬁ" and maps non-breaking
+// spaces to spaces), folds typographic punctuation and removes line-break hyphenation
+func normalizeText(text string) string {
+	text = norm.NFKC.String(text)
+	text = typographicReplacer.Replace(text)
+	return hyphenatedBreak.ReplaceAllString(text, "$1$2")
+}
+
+// joinHyphenatedLine reports whether line ends with a word broken by a hyphen that continues
+// on next, and returns the two lines joined without the hyphen
+func joinHyphenatedLine(line, next string) (string, bool) {
+	joined := hyphenatedBreak.ReplaceAllString(strings.TrimRight(line, " \t")+"\n"+strings.TrimLeft(next, " \t"), "$1$2")
+	if strings.Contains(joined, "\n") {
+		return "", false
+	}
+	return joined, true
+}
@@ -0,0 +1,53 @@
+package parser
+
+import "testing"
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "ISO 14001 certified", "ISO 14001 certified"},
+		{"ligatures", "certiﬁcation and eﬀective", "certification and effective"},
+		{"non-breaking space", "ISO\u00a014001", "ISO 14001"},
+		{"fullwidth", "ＩＳＯ １４００１", "ISO 14001"},
+		{"combining accent composed", "e\u0301nergie", "\u00e9nergie"},
+		{"accents kept", "carboneutralité", "carboneutralité"},
+		{"smart quotes", "“shall” and ‘must’", `"shall" and 'must'`},
+		{"dashes", "24–7 service — all sites", "24-7 service - all sites"},
+		{"soft hyphen and zero width", "sustain\u00adability\u200b report", "sustainability report"},
+		{"line break hyphenation", "sustain-\nability", "sustainability"},
+		{"hyphen before a capital kept", "Carbon-\nNeutral", "Carbon-\nNeutral"},
+		{"hyphenated compound kept", "24-hour", "24-hour"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.text); got != tt.want {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoinHyphenatedLine(t *testing.T) {
+	tests := []struct {
+		line, next string
+		want       string
+		ok         bool
+	}{
+		{"all build-", "ings in the portfolio", "all buildings in the portfolio", true},
+		{"all build- ", "  ings", "all buildings", true},
+		{"the City of", "Ottawa", "", false},
+		{"North-", "West region", "", false},
+		{"pages 10-", "12", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := joinHyphenatedLine(tt.line, tt.next)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("joinHyphenatedLine(%q, %q) = %q, %t, want %q, %t", tt.line, tt.next, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -5,20 +5,33 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
-func DocxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
+// docxStyle is the part of a word/styles.xml paragraph style needed to detect headings
+type docxStyle struct {
+	name       string
+	basedOn    string
+	outlineLvl int //-1 when the style sets no outline level
+}
+
+var headingStyleName = regexp.MustCompile(`(?i)^heading\s*(\d)$`)
+
+func DocxParser(r io.ReaderAt, size int64, emit SegmentFunc) error {
 	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return err
 	}
 
-	var documentFile *zip.File
+	var documentFile, stylesFile *zip.File
 	for _, f := range zr.File {
-		if f.Name == "word/document.xml" {
+		switch f.Name {
+		case "word/document.xml":
 			documentFile = f
-			break
+		case "word/styles.xml":
+			stylesFile = f
 		}
 	}
 
@@ -26,6 +39,14 @@ func DocxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
 		return fmt.Errorf("word/document.xml not found")
 	}
 
+	headingLevels := map[string]int{}
+	if stylesFile != nil {
+		headingLevels, err = loadHeadingLevels(stylesFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	rc, err := documentFile.Open()
 	if err != nil {
 		return err
@@ -34,9 +55,13 @@ func DocxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
 
 	decoder := xml.NewDecoder(rc)
 	var (
-		inText      bool
-		currentText string
-		output      strings.Builder
+		inText       bool
+		currentText  string
+		output       strings.Builder
+		paragraphs   int
+		tableDepth   int
+		headingLevel int
+		sections     sectionTracker
 	)
 
 	for {
@@ -50,25 +75,168 @@ func DocxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
 
 		switch tokElem := tok.(type) {
 		case xml.StartElement:
-			if tokElem.Name.Local == "t" {
+			switch tokElem.Name.Local {
+			case "t":
 				inText = true
 				currentText = ""
+			case "tbl":
+				tableDepth++
+			case "pStyle":
+				headingLevel = styleHeadingLevel(attrValue(tokElem, "val"), headingLevels)
+			case "outlineLvl":
+				//direct paragraph formatting overrides the style
+				if lvl, err := strconv.Atoi(attrValue(tokElem, "val")); err == nil && lvl < 9 {
+					headingLevel = lvl + 1
+				}
 			}
 		case xml.CharData:
 			if inText {
 				currentText += string(tokElem)
 			}
 		case xml.EndElement:
-			if tokElem.Name.Local == "t" {
+			switch tokElem.Name.Local {
+			case "t":
 				output.WriteString(currentText)
 				inText = false
-			}
-			if tokElem.Name.Local == "p" {
-				output.WriteString("\n")
-				scanTextWithRegex(output.String(), kpiResults)
+			case "tbl":
+				tableDepth--
+			case "p":
+				paragraphs++
+				text := output.String()
 				output.Reset()
+
+				level := headingLevel
+				headingLevel = 0
+
+				if strings.TrimSpace(text) == "" {
+					continue
+				}
+
+				seg := TextSegment{
+					Text:     text,
+					Location: fmt.Sprintf("paragraph %d", paragraphs),
+					Type:     SegmentParagraph,
+					Section:  sections.path(),
+				}
+				if tableDepth > 0 {
+					seg.Type = SegmentTableCell
+				} else if level > 0 {
+					seg.Type = SegmentHeading
+					seg.Section = sections.enter(level, text)
+				}
+
+				if err := emit(seg); err != nil {
+					return err
+				}
 			}
 		}
 	}
 	return nil
 }
+
+// loadHeadingLevels maps paragraph style IDs to their heading level (1 = top level) using the
+// style name ("heading 2") or outline level, following basedOn inheritance
+func loadHeadingLevels(stylesFile *zip.File) (map[string]int, error) {
+	rc, err := stylesFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	styles := make(map[string]*docxStyle)
+	var current *docxStyle
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decoding word/styles.xml: %w", err)
+		}
+
+		switch tokElem := tok.(type) {
+		case xml.StartElement:
+			switch tokElem.Name.Local {
+			case "style":
+				current = nil
+				if attrValue(tokElem, "type") == "paragraph" {
+					current = &docxStyle{outlineLvl: -1}
+					styles[attrValue(tokElem, "styleId")] = current
+				}
+			case "name":
+				if current != nil {
+					current.name = attrValue(tokElem, "val")
+				}
+			case "basedOn":
+				if current != nil {
+					current.basedOn = attrValue(tokElem, "val")
+				}
+			case "outlineLvl":
+				if current != nil {
+					if lvl, err := strconv.Atoi(attrValue(tokElem, "val")); err == nil {
+						current.outlineLvl = lvl
+					}
+				}
+			}
+		case xml.EndElement:
+			if tokElem.Name.Local == "style" {
+				current = nil
+			}
+		}
+	}
+
+	levels := make(map[string]int, len(styles))
+	for id := range styles {
+		if level := resolveHeadingLevel(id, styles); level > 0 {
+			levels[id] = level
+		}
+	}
+	return levels, nil
+}
+
+func resolveHeadingLevel(id string, styles map[string]*docxStyle) int {
+	//basedOn chains are short - the limit only guards against cycles
+	for depth := 0; depth < 10; depth++ {
+		style, ok := styles[id]
+		if !ok {
+			return 0
+		}
+		if m := headingStyleName.FindStringSubmatch(style.name); m != nil {
+			level, _ := strconv.Atoi(m[1])
+			return level
+		}
+		if strings.EqualFold(style.name, "title") {
+			return 1
+		}
+		if style.outlineLvl >= 0 && style.outlineLvl < 9 {
+			return style.outlineLvl + 1
+		}
+		id = style.basedOn
+	}
+	return 0
+}
+
+// styleHeadingLevel falls back to the built-in style IDs when styles.xml is missing
+func styleHeadingLevel(styleID string, headingLevels map[string]int) int {
+	if level, ok := headingLevels[styleID]; ok {
+		return level
+	}
+	if level, err := strconv.Atoi(strings.TrimPrefix(styleID, "Heading")); err == nil && strings.HasPrefix(styleID, "Heading") {
+		return level
+	}
+	if styleID == "Title" {
+		return 1
+	}
+	return 0
+}
+
+func attrValue(elem xml.StartElement, local string) string {
+	for _, attr := range elem.Attr {
+		if attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+const testStylesXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+	<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+	<w:style w:type="paragraph" w:styleId="Titre"><w:name w:val="Title"/><w:basedOn w:val="Normal"/></w:style>
+	<w:style w:type="paragraph" w:styleId="Titre1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/></w:style>
+	<w:style w:type="paragraph" w:styleId="Titre2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/></w:style>
+	<w:style w:type="paragraph" w:styleId="RFPSection"><w:name w:val="RFP Section"/><w:basedOn w:val="Titre2"/></w:style>
+	<w:style w:type="paragraph" w:styleId="Clause"><w:name w:val="Clause"/><w:basedOn w:val="Normal"/><w:pPr><w:outlineLvl w:val="2"/></w:pPr></w:style>
+	<w:style w:type="paragraph" w:styleId="LoopA"><w:name w:val="Loop A"/><w:basedOn w:val="LoopB"/></w:style>
+	<w:style w:type="paragraph" w:styleId="LoopB"><w:name w:val="Loop B"/><w:basedOn w:val="LoopA"/></w:style>
+	<w:style w:type="character" w:styleId="Heading1Char"><w:name w:val="heading 1 Char"/></w:style>
+</w:styles>`
+
+// docxParagraph is a paragraph of a test document.xml with an optional paragraph style
+func docxParagraph(style, text string) string {
+	pPr := ""
+	if style != "" {
+		pPr = `<w:pPr><w:pStyle w:val="` + style + `"/></w:pPr>`
+	}
+	return `<w:p>` + pPr + `<w:r><w:t>` + text + `</w:t></w:r></w:p>`
+}
+
+func testDocx(t *testing.T, stylesXML string, body ...string) *bytes.Reader {
+	t.Helper()
+
+	var document bytes.Buffer
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	for _, p := range body {
+		document.WriteString(p)
+	}
+	document.WriteString(`</w:body></w:document>`)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{"word/document.xml": document.String()}
+	if stylesXML != "" {
+		files["word/styles.xml"] = stylesXML
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func parseTestDocx(t *testing.T, r *bytes.Reader) []TextSegment {
+	t.Helper()
+
+	var segs []TextSegment
+	err := DocxParser(r, r.Size(), func(seg TextSegment) error {
+		segs = append(segs, seg)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return segs
+}
+
+type wantSegment struct {
+	text    string
+	typ     SegmentType
+	section string
+}
+
+func checkSegments(t *testing.T, segs []TextSegment, want []wantSegment) {
+	t.Helper()
+
+	if len(segs) != len(want) {
+		t.Fatalf("got %d segments, want %d: %+v", len(segs), len(want), segs)
+	}
+	for i, w := range want {
+		if segs[i].Text != w.text || segs[i].Type != w.typ || segs[i].Section != w.section {
+			t.Errorf("segment %d = %q (%s) in %q, want %q (%s) in %q", i, segs[i].Text, segs[i].Type, segs[i].Section, w.text, w.typ, w.section)
+		}
+	}
+}
+
+func TestDocxHeadingsFromStyles(t *testing.T) {
+	segs := parseTestDocx(t, testDocx(t, testStylesXML,
+		docxParagraph("Titre", "Request for Proposal"),
+		docxParagraph("", "Issued by the City of Ottawa."),
+		docxParagraph("Titre1", "Scope of Work"),
+		//a custom style based on a heading style
+		docxParagraph("RFPSection", "Facilities"),
+		//a style with an outline level
+		docxParagraph("Clause", "HVAC Maintenance"),
+		docxParagraph("Normal", "The contractor shall service all units."),
+		`<w:tbl><w:tr><w:tc>`+docxParagraph("", "Quarterly inspections")+`</w:tc></w:tr></w:tbl>`,
+		//direct formatting overrides the paragraph style
+		`<w:p><w:pPr><w:pStyle w:val="Normal"/><w:outlineLvl w:val="0"/></w:pPr><w:r><w:t>Evaluation Criteria</w:t></w:r></w:p>`,
+		//cyclic basedOn chains are not headings
+		docxParagraph("LoopA", "Proposals are scored out of 100."),
+	))
+
+	checkSegments(t, segs, []wantSegment{
+		{"Request for Proposal", SegmentHeading, "Request for Proposal"},
+		{"Issued by the City of Ottawa.", SegmentParagraph, "Request for Proposal"},
+		{"Scope of Work", SegmentHeading, "Scope of Work"},
+		{"Facilities", SegmentHeading, "Scope of Work > Facilities"},
+		{"HVAC Maintenance", SegmentHeading, "Scope of Work > Facilities > HVAC Maintenance"},
+		{"The contractor shall service all units.", SegmentParagraph, "Scope of Work > Facilities > HVAC Maintenance"},
+		{"Quarterly inspections", SegmentTableCell, "Scope of Work > Facilities > HVAC Maintenance"},
+		{"Evaluation Criteria", SegmentHeading, "Evaluation Criteria"},
+		{"Proposals are scored out of 100.", SegmentParagraph, "Evaluation Criteria"},
+	})
+}
+
+func TestDocxHeadingsWithoutStyles(t *testing.T) {
+	//without styles.xml the built-in style IDs are recognised
+	segs := parseTestDocx(t, testDocx(t, "",
+		docxParagraph("Heading1", "Scope of Work"),
+		docxParagraph("Heading2", "Facilities"),
+		docxParagraph("Titre1", "Not a known style ID"),
+		docxParagraph("", "The contractor shall service all units."),
+	))
+
+	checkSegments(t, segs, []wantSegment{
+		{"Scope of Work", SegmentHeading, "Scope of Work"},
+		{"Facilities", SegmentHeading, "Scope of Work > Facilities"},
+		{"Not a known style ID", SegmentParagraph, "Scope of Work > Facilities"},
+		{"The contractor shall service all units.", SegmentParagraph, "Scope of Work > Facilities"},
+	})
+}
+
+func TestResolveHeadingLevel(t *testing.T) {
+	styles := map[string]*docxStyle{
+		"Heading3":  {name: "Heading 3", outlineLvl: -1},
+		"Custom":    {name: "Custom", basedOn: "Heading3", outlineLvl: -1},
+		"Outline":   {name: "Outline", outlineLvl: 1},
+		"BodyLevel": {name: "Body", outlineLvl: 9}, //Word's "body text" outline level
+		"Orphan":    {name: "Orphan", basedOn: "Missing", outlineLvl: -1},
+	}
+
+	tests := map[string]int{
+		"Heading3":  3,
+		"Custom":    3,
+		"Outline":   2,
+		"BodyLevel": 0,
+		"Orphan":    0,
+		"Missing":   0,
+	}
+	for id, want := range tests {
+		if got := resolveHeadingLevel(id, styles); got != want {
+			t.Errorf("resolveHeadingLevel(%s) = %d, want %d", id, got, want)
+		}
+	}
+}
@@ -6,9 +6,14 @@ import (
 )
 
 type KPIResult struct {
-	KPIDef   *KPIDefinition
-	Found    bool
-	Sentence string
+	KPIDef      *KPIDefinition
+	Found       bool
+	Sentence    string
+	Section     string //section path of Sentence
+	Strength    Strength
+	Occurrences int
+	Score       float64
+	Language    string //detected language of the document Sentence came from
 }
 
 type cleanupRule struct {
@@ -28,57 +33,74 @@ var cleanupRules = []cleanupRule{
 	{regexp.MustCompile(`(?m)^[-•]\s*`), ""},
 }
 
-var sentenceRule = regexp.MustCompile(`\. [A-Z]`)
+// ScanSegment runs the matcher stage and, unless entities is nil, the entity stage over a single
+// TextSegment, cleaning its text once for both
+func ScanSegment(seg TextSegment, kpiResults []KPIResult, entities *EntityCollector) {
+	lines := segmentLines(seg)
+	matchLines(seg, lines, kpiResults)
+	if entities != nil {
+		entities.extractLines(seg, lines)
+	}
+}
 
-func scanTextWithRegex(text string, kpiResults []KPIResult) {
-	text = cleanText(text)
-	textSlice := strings.Split(text, "\n")
+// MatchSegment is the matcher stage: it scans a single TextSegment against every KPI
+// definition and records the matching sentence on kpiResults.
+func MatchSegment(seg TextSegment, kpiResults []KPIResult) {
+	matchLines(seg, segmentLines(seg), kpiResults)
+}
+
+// segmentLines is the cleaned text of seg split into lines
+func segmentLines(seg TextSegment) []string {
+	return strings.Split(cleanText(seg.Text), "\n")
+}
 
-	for _, item := range textSlice {
+func matchLines(seg TextSegment, lines []string, kpiResults []KPIResult) {
+	for _, item := range lines {
 		for i, kpiResult := range kpiResults {
-			for _, re := range kpiResult.KPIDef.Regexps {
-				if re.Match([]byte(item)) {
-					sentence := extractSentence(item, re, sentenceRule)
-					if sentence == "" {
-						continue
-					}
-					kpiResults[i].Sentence = sentence
-					kpiResults[i].Found = true
-					break
-				}
+			if !kpiResult.KPIDef.inSection(seg.Section) {
+				continue
+			}
+			loc, ok := kpiResult.KPIDef.match(item, seg.Language)
+			if !ok {
+				continue
+			}
+			start, end := sentenceBounds(item, loc)
+			sentence := item[start:end]
+			if sentence == "" || kpiResult.KPIDef.excluded(sentence) {
+				continue
+			}
+
+			settings := kpiResult.KPIDef.matchSettings()
+			strength := settings.classify(sentence)
+			kpiResults[i].Occurrences++
+			kpiResults[i].Score += settings.weights.occurrenceScore(kpiResult.KPIDef, strength, seg)
+
+			//keep the sentence with the strongest requirement, the latest one on a tie
+			if kpiResult.Found && strengthRank[strength] < strengthRank[kpiResult.Strength] {
+				continue
+			}
+			//the whole sentence is classified, only the reported context is trimmed
+			if loc == nil {
+				kpiResults[i].Sentence = trimContext(sentence, 0, 0, settings.maxContext)
+			} else {
+				kpiResults[i].Sentence = trimContext(sentence, loc[0]-start, loc[1]-start, settings.maxContext)
 			}
+			kpiResults[i].Section = seg.Section
+			kpiResults[i].Strength = strength
+			kpiResults[i].Language = seg.Language
+			kpiResults[i].Found = true
 		}
 	}
 }
 
 func cleanText(text string) string {
+	text = normalizeText(text)
 	for _, rule := range cleanupRules {
 		text = rule.re.ReplaceAllString(text, rule.repl)
 	}
 	return text
 }
 
-func extractSentence(text string, target *regexp.Regexp, boundary *regexp.Regexp) string {
-	targetLoc := target.FindIndex([]byte(text))
-	if targetLoc == nil {
-		return ""
-	}
-
-	leftBounds := boundary.FindAllStringIndex(text[0:targetLoc[0]], -1)
-	leftIdx := 0
-	if leftBounds != nil {
-		leftBoundsLen := len(leftBounds) - 1
-		leftIdx = leftBounds[leftBoundsLen][0] + 2
-	}
-
-	rightBound := boundary.FindStringIndex(text[targetLoc[1]:])
-	rightIdx := len(text)
-	if rightBound != nil {
-		rightIdx = targetLoc[1] + rightBound[1] - 2
-	}
-	return text[leftIdx:rightIdx]
-}
-
 func CreatePkgResultForRFPPackage(kpiDefs []KPIDefinition) []KPIResult {
 	kpiResults := make([]KPIResult, 0, len(kpiDefs))
 
@@ -1,20 +1,42 @@
 package parser
 
 import (
-	"bufio"
 	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 )
 
-func PdfParser(ctx context.Context, f *os.File, kpiResults []KPIResult) error {
+// pdfLine is a line of text from pdftotext -bbox-layout. Its height approximates the font size.
+type pdfLine struct {
+	text   string
+	height float64
+	block  int //lines of one block form a paragraph
+}
+
+const (
+	//a line this much taller than the page's typical line is treated as a heading
+	pdfHeadingScale   = 1.2
+	pdfTopLevelScale  = 1.6
+	pdfMaxHeadingWord = 15
+)
+
+// numberedHeading matches short numbered titles such as "4.2 Evaluation Criteria"
+var numberedHeading = regexp.MustCompile(`^(\d+(?:\.\d+)*)\.?\s+[A-Z][^.!?;:]*$`)
+
+func PdfParser(ctx context.Context, f *os.File, emit SegmentFunc) error {
 	if _, err := f.Seek(0, io.SeekStart); err != nil {
 		return err
 	}
 
-	cmd := exec.CommandContext(ctx, "pdftotext", "-", "-")
+	cmd := exec.CommandContext(ctx, "pdftotext", "-bbox-layout", "-", "-")
 	cmd.Stdin = f
 
 	stdoutPipe, err := cmd.StdoutPipe()
@@ -31,16 +53,9 @@ func PdfParser(ctx context.Context, f *os.File, kpiResults []KPIResult) error {
 		return err
 	}
 
-	scanner := bufio.NewScanner(stdoutPipe)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		scanTextWithRegex(line, kpiResults)
-	}
-
-	if err := scanner.Err(); err != nil {
+	if err := parseBBoxLayout(stdoutPipe, emit); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
 		return err
 	}
 
@@ -51,3 +66,171 @@ func PdfParser(ctx context.Context, f *os.File, kpiResults []KPIResult) error {
 
 	return nil
 }
+
+// parseBBoxLayout reads the XHTML written by pdftotext -bbox-layout and emits one segment per
+// paragraph and heading, a page at a time so headings can be detected relative to the page's body
+// text size
+func parseBBoxLayout(r io.Reader, emit SegmentFunc) error {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var (
+		page     int
+		block    int
+		lines    []pdfLine
+		words    []string
+		height   float64
+		inWord   bool
+		wordText strings.Builder
+		sections sectionTracker
+	)
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decoding pdftotext output: %w", err)
+		}
+
+		switch tokElem := tok.(type) {
+		case xml.StartElement:
+			switch tokElem.Name.Local {
+			case "page":
+				page++
+				lines = lines[:0]
+			case "block":
+				block++
+			case "line":
+				words = words[:0]
+				yMin, _ := strconv.ParseFloat(attrValue(tokElem, "yMin"), 64)
+				yMax, _ := strconv.ParseFloat(attrValue(tokElem, "yMax"), 64)
+				height = yMax - yMin
+			case "word":
+				inWord = true
+				wordText.Reset()
+			}
+		case xml.CharData:
+			if inWord {
+				wordText.Write(tokElem)
+			}
+		case xml.EndElement:
+			switch tokElem.Name.Local {
+			case "word":
+				inWord = false
+				words = append(words, wordText.String())
+			case "line":
+				lines = append(lines, pdfLine{text: strings.Join(words, " "), height: height, block: block})
+			case "page":
+				if err := emitPdfPage(page, lines, &sections, emit); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// emitPdfPage emits each heading line on its own and joins the other lines of a block into one
+// paragraph, so phrases wrapped onto the next printed line still match together
+func emitPdfPage(page int, lines []pdfLine, sections *sectionTracker, emit SegmentFunc) error {
+	bodyHeight := medianLineHeight(lines)
+
+	var para *TextSegment
+	paraBlock := 0
+	flush := func() error {
+		if para == nil {
+			return nil
+		}
+		seg := *para
+		para = nil
+		return emit(seg)
+	}
+
+	for i, line := range lines {
+		if strings.TrimSpace(line.text) == "" {
+			continue
+		}
+		location := fmt.Sprintf("page %d, line %d", page, i+1)
+		continued := para != nil && paraBlock == line.block
+
+		if level := pdfHeadingLevel(line, bodyHeight, continued); level > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			seg := TextSegment{
+				Text:     line.text,
+				Location: location,
+				Type:     SegmentHeading,
+				Section:  sections.enter(level, line.text),
+			}
+			if err := emit(seg); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if continued {
+			if joined, ok := joinHyphenatedLine(para.Text, line.text); ok {
+				para.Text = joined
+			} else {
+				para.Text += " " + strings.TrimSpace(line.text)
+			}
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+		para = &TextSegment{
+			Text:     strings.TrimSpace(line.text),
+			Location: location,
+			Type:     SegmentParagraph,
+			Section:  sections.path(),
+		}
+		paraBlock = line.block
+	}
+	return flush()
+}
+
+// pdfHeadingLevel returns 1 or 2 for lines set noticeably larger than the body text, the
+// numbering depth for short numbered titles, and 0 for everything else. A line continuing a
+// paragraph is only a heading by its size, so wrapped text starting with a number stays in place.
+func pdfHeadingLevel(line pdfLine, bodyHeight float64, continued bool) int {
+	text := strings.TrimSpace(line.text)
+	if len(strings.Fields(text)) > pdfMaxHeadingWord || !strings.ContainsFunc(text, unicode.IsLetter) {
+		return 0
+	}
+
+	if bodyHeight > 0 && line.height >= bodyHeight*pdfHeadingScale {
+		if line.height >= bodyHeight*pdfTopLevelScale {
+			return 1
+		}
+		return 2
+	}
+
+	if continued {
+		return 0
+	}
+	if m := numberedHeading.FindStringSubmatch(text); m != nil && len(strings.Fields(text)) <= 8 {
+		return strings.Count(m[1], ".") + 1
+	}
+	return 0
+}
+
+func medianLineHeight(lines []pdfLine) float64 {
+	heights := make([]float64, 0, len(lines))
+	for _, line := range lines {
+		if line.height > 0 {
+			heights = append(heights, line.height)
+		}
+	}
+	if len(heights) == 0 {
+		return 0
+	}
+	sort.Float64s(heights)
+	return heights[len(heights)/2]
+}
@@ -0,0 +1,150 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// bboxTestLine is a line of a pdftotext -bbox-layout fixture. A zero height is the body text height.
+type bboxTestLine struct {
+	text   string
+	height float64
+}
+
+const bboxBodyHeight = 12
+
+// bboxDocument wraps pages from bboxPage in the pdftotext -bbox-layout document
+func bboxDocument(pages ...string) string {
+	return `<!DOCTYPE html><html xmlns="http://www.w3.org/1999/xhtml"><head><title></title></head><body><doc>` +
+		strings.Join(pages, "") + `</doc></body></html>`
+}
+
+// bboxPage builds a page of pdftotext -bbox-layout output with the given blocks of lines
+func bboxPage(blocks ...[]bboxTestLine) string {
+	var b strings.Builder
+	b.WriteString(`<page width="612.000000" height="792.000000"><flow>`)
+
+	y := 72.0
+	for _, block := range blocks {
+		b.WriteString(`<block xMin="72.000000" yMin="72.000000" xMax="540.000000" yMax="720.000000">`)
+		for _, line := range block {
+			height := line.height
+			if height == 0 {
+				height = bboxBodyHeight
+			}
+			fmt.Fprintf(&b, `<line xMin="72.000000" yMin="%f" xMax="540.000000" yMax="%f">`, y, y+height)
+			for _, word := range strings.Fields(line.text) {
+				fmt.Fprintf(&b, `<word xMin="72.000000" yMin="%f" xMax="100.000000" yMax="%f">%s</word>`, y, y+height, html.EscapeString(word))
+			}
+			b.WriteString(`</line>`)
+			y += height + 2
+		}
+		b.WriteString(`</block>`)
+	}
+
+	b.WriteString(`</flow></page>`)
+	return b.String()
+}
+
+func parseTestLayout(t *testing.T, doc string) []TextSegment {
+	t.Helper()
+
+	var segs []TextSegment
+	emit := func(seg TextSegment) error {
+		segs = append(segs, seg)
+		return nil
+	}
+	if err := parseBBoxLayout(strings.NewReader(doc), emit); err != nil {
+		t.Fatal(err)
+	}
+	return segs
+}
+
+func TestPdfParagraphs(t *testing.T) {
+	segs := parseTestLayout(t, bboxDocument(bboxPage(
+		[]bboxTestLine{{text: "The contractor shall provide"}, {text: "24/7 support for all build-"}, {text: "ings in the portfolio."}},
+		[]bboxTestLine{{text: "Invoices are due monthly."}},
+	)))
+
+	want := []TextSegment{
+		{Text: "The contractor shall provide 24/7 support for all buildings in the portfolio.", Location: "page 1, line 1", Type: SegmentParagraph},
+		{Text: "Invoices are due monthly.", Location: "page 1, line 4", Type: SegmentParagraph},
+	}
+	if !reflect.DeepEqual(segs, want) {
+		t.Errorf("segments = %+v, want %+v", segs, want)
+	}
+}
+
+func TestPdfWrappedNumberIsNotHeading(t *testing.T) {
+	segs := parseTestLayout(t, bboxDocument(bboxPage(
+		[]bboxTestLine{{text: "Suppliers must be certified to ISO"}, {text: "14001 Environmental Management"}},
+	)))
+
+	if len(segs) != 1 || segs[0].Type != SegmentParagraph {
+		t.Errorf("segments = %+v, want one paragraph", segs)
+	}
+}
+
+func TestPdfHeadings(t *testing.T) {
+	segs := parseTestLayout(t, bboxDocument(
+		bboxPage(
+			[]bboxTestLine{{text: "Request for Proposal", height: 24}},
+			[]bboxTestLine{{text: "Issued by the City of Ottawa."}},
+			[]bboxTestLine{{text: "Evaluation Criteria", height: 16}},
+			[]bboxTestLine{{text: "Proposals are scored out of 100."}},
+			[]bboxTestLine{{text: "4.2.1 Mandatory Requirements"}},
+			[]bboxTestLine{{text: "Bidders must hold ISO 14001."}},
+		),
+		//sections continue on the next page
+		bboxPage(
+			[]bboxTestLine{{text: "Submissions must be signed."}},
+			[]bboxTestLine{{text: "Pricing", height: 16}},
+			[]bboxTestLine{{text: "Prices are fixed for three years."}},
+		),
+	))
+
+	checkSegments(t, segs, []wantSegment{
+		{"Request for Proposal", SegmentHeading, "Request for Proposal"},
+		{"Issued by the City of Ottawa.", SegmentParagraph, "Request for Proposal"},
+		{"Evaluation Criteria", SegmentHeading, "Request for Proposal > Evaluation Criteria"},
+		{"Proposals are scored out of 100.", SegmentParagraph, "Request for Proposal > Evaluation Criteria"},
+		//a numbered title's depth is its level
+		{"4.2.1 Mandatory Requirements", SegmentHeading, "Request for Proposal > Evaluation Criteria > 4.2.1 Mandatory Requirements"},
+		{"Bidders must hold ISO 14001.", SegmentParagraph, "Request for Proposal > Evaluation Criteria > 4.2.1 Mandatory Requirements"},
+		{"Submissions must be signed.", SegmentParagraph, "Request for Proposal > Evaluation Criteria > 4.2.1 Mandatory Requirements"},
+		{"Pricing", SegmentHeading, "Request for Proposal > Pricing"},
+		{"Prices are fixed for three years.", SegmentParagraph, "Request for Proposal > Pricing"},
+	})
+}
+
+func TestPdfHeadingLevel(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      pdfLine
+		continued bool
+		want      int
+	}{
+		{"body text", pdfLine{text: "Bidders must hold ISO 14001.", height: 12}, false, 0},
+		{"much larger", pdfLine{text: "Request for Proposal", height: 20}, false, 1},
+		{"larger", pdfLine{text: "Evaluation Criteria", height: 15}, false, 2},
+		{"slightly larger", pdfLine{text: "Evaluation Criteria", height: 13}, false, 0},
+		{"numbered", pdfLine{text: "4 Scope of Work", height: 12}, false, 1},
+		{"numbered with trailing dot", pdfLine{text: "4.2. Evaluation Criteria", height: 12}, false, 2},
+		{"numbered sentence", pdfLine{text: "3 Bidders must submit proposals.", height: 12}, false, 0},
+		{"numbered but continued", pdfLine{text: "14001 Environmental Management", height: 12}, true, 0},
+		{"larger and continued", pdfLine{text: "Evaluation Criteria", height: 20}, true, 1},
+		{"large number only", pdfLine{text: "2026", height: 30}, false, 0},
+		{"large but long", pdfLine{text: strings.Repeat("word ", pdfMaxHeadingWord+1), height: 20}, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pdfHeadingLevel(tt.line, bboxBodyHeight, tt.continued); got != tt.want {
+				t.Errorf("pdfHeadingLevel = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
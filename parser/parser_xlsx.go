@@ -7,11 +7,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strconv"
 	"strings"
 )
 
-func XlsxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
+func XlsxParser(r io.ReaderAt, size int64, emit SegmentFunc) error {
 	zr, err := zip.NewReader(r, size)
 	if err != nil {
 		return err
@@ -23,12 +24,12 @@ func XlsxParser(r io.ReaderAt, size int64, kpiResults []KPIResult) error {
 		if err != nil {
 			return err
 		}
-		err := parseWithSharedStringsSlice(zr, sharedStrings, kpiResults)
+		err := parseWithSharedStringsSlice(zr, sharedStrings, emit)
 		if err != nil {
 			return err
 		}
 	} else {
-		err := parseWithSharedStringsTmpFile(zr, kpiResults)
+		err := parseWithSharedStringsTmpFile(zr, emit)
 		if err != nil {
 			return err
 		}
@@ -93,68 +94,17 @@ func loadSharedStrings(zr *zip.Reader) ([]string, error) {
 	return sharedStrings, nil
 }
 
-func parseWithSharedStringsSlice(zr *zip.Reader, sharedStrings []string, kpiResults []KPIResult) error {
-	for _, f := range zr.File {
-		if strings.Contains(f.Name, "worksheets/sheet") {
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			decoder := xml.NewDecoder(rc)
-			var inV bool
-			var val string
-			var cellType string
-
-			for {
-				tok, err := decoder.Token()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					return err
-				}
-
-				switch tokElem := tok.(type) {
-				case xml.StartElement:
-					if tokElem.Name.Local == "c" {
-						for _, attr := range tokElem.Attr {
-							if attr.Name.Local == "t" {
-								cellType = attr.Value
-								break
-							}
-						}
-					}
-					if tokElem.Name.Local == "v" {
-						inV = true
-						val = ""
-					}
-				case xml.CharData:
-					if inV {
-						val += string(tokElem)
-					}
-				case xml.EndElement:
-					if tokElem.Name.Local == "v" {
-						inV = false
-						if cellType == "s" {
-							idx, _ := strconv.Atoi(val)
-							if idx < 0 || idx >= len(sharedStrings) {
-								continue
-							}
-							text := sharedStrings[idx]
-							scanTextWithRegex(text, kpiResults)
-						} else {
-							scanTextWithRegex(val, kpiResults)
-						}
-					}
-				}
-			}
-			rc.Close()
+func parseWithSharedStringsSlice(zr *zip.Reader, sharedStrings []string, emit SegmentFunc) error {
+	lookup := func(idx int) (string, bool, error) {
+		if idx < 0 || idx >= len(sharedStrings) {
+			return "", false, nil
 		}
+		return sharedStrings[idx], true, nil
 	}
-	return nil
+	return parseWorksheets(zr, lookup, emit)
 }
 
-func parseWithSharedStringsTmpFile(zr *zip.Reader, kpiResults []KPIResult) error {
+func parseWithSharedStringsTmpFile(zr *zip.Reader, emit SegmentFunc) error {
 	var sharedStringsFile *zip.File
 	for _, f := range zr.File {
 		if strings.HasSuffix(f.Name, "sharedStrings.xml") {
@@ -222,73 +172,186 @@ func parseWithSharedStringsTmpFile(zr *zip.Reader, kpiResults []KPIResult) error
 		rc.Close()
 	}
 
-	//Parse worksheets
+	lookup := func(idx int) (string, bool, error) {
+		if idx < 0 || idx >= len(ssOffsets) {
+			return "", false, nil
+		}
+		_, err := ssFile.Seek(ssOffsets[idx], io.SeekStart)
+		if err != nil {
+			return "", false, err
+		}
+		reader := bufio.NewReader(ssFile)
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", false, err
+		}
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 {
+			return "", false, fmt.Errorf("malformed shared string entry %d", idx)
+		}
+		return strings.TrimSpace(parts[1]), true, nil
+	}
+
+	return parseWorksheets(zr, lookup, emit)
+}
+
+// parseWorksheets emits one cell segment per <v> value in every worksheet. Shared string
+// cells are resolved through lookup.
+func parseWorksheets(zr *zip.Reader, lookup func(idx int) (string, bool, error), emit SegmentFunc) error {
+	sheetNames, err := loadSheetNames(zr)
+	if err != nil {
+		return err
+	}
+
 	for _, f := range zr.File {
-		if strings.Contains(f.Name, "worksheets/sheet") {
-			rc, err := f.Open()
-			if err != nil {
-				return err
+		if !strings.Contains(f.Name, "worksheets/sheet") {
+			continue
+		}
+
+		sheetName, ok := sheetNames[f.Name]
+		if !ok {
+			sheetName = strings.TrimSuffix(path.Base(f.Name), ".xml")
+		}
+
+		if err := parseWorksheet(f, sheetName, lookup, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSheetNames maps worksheet part names (xl/worksheets/sheet1.xml) to the sheet names shown
+// in Excel, using xl/workbook.xml and its relationships. Missing parts yield an empty map.
+func loadSheetNames(zr *zip.Reader) (map[string]string, error) {
+	var workbookFile, relsFile *zip.File
+	for _, f := range zr.File {
+		switch f.Name {
+		case "xl/workbook.xml":
+			workbookFile = f
+		case "xl/_rels/workbook.xml.rels":
+			relsFile = f
+		}
+	}
+
+	sheetNames := make(map[string]string)
+	if workbookFile == nil || relsFile == nil {
+		return sheetNames, nil
+	}
+
+	targets := make(map[string]string)
+	err := walkXMLStartElements(relsFile, func(elem xml.StartElement) {
+		if elem.Name.Local == "Relationship" {
+			target := attrValue(elem, "Target")
+			if strings.HasPrefix(target, "/") {
+				target = strings.TrimPrefix(target, "/")
+			} else {
+				target = path.Join("xl", target)
 			}
-			decoder := xml.NewDecoder(rc)
-			var inV bool
-			var val string
-			var cellType string
-
-			for {
-				tok, err := decoder.Token()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					return err
-				}
+			targets[attrValue(elem, "Id")] = target
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
 
-				switch tokElem := tok.(type) {
-				case xml.StartElement:
-					if tokElem.Name.Local == "c" {
-						for _, attr := range tokElem.Attr {
-							if attr.Name.Local == "t" {
-								cellType = attr.Value
-							}
-						}
-					}
-					if tokElem.Name.Local == "v" {
-						inV = true
-						val = ""
-					}
-				case xml.CharData:
-					if inV {
-						val += string(tokElem)
+	err = walkXMLStartElements(workbookFile, func(elem xml.StartElement) {
+		if elem.Name.Local == "sheet" {
+			if target, ok := targets[attrValue(elem, "id")]; ok {
+				sheetNames[target] = attrValue(elem, "name")
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sheetNames, nil
+}
+
+func walkXMLStartElements(f *zip.File, fn func(elem xml.StartElement)) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("decoding %s: %w", f.Name, err)
+		}
+		if elem, ok := tok.(xml.StartElement); ok {
+			fn(elem)
+		}
+	}
+}
+
+func parseWorksheet(f *zip.File, sheetName string, lookup func(idx int) (string, bool, error), emit SegmentFunc) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(rc)
+	var inV bool
+	var val string
+	var cellType string
+	var cellRef string
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch tokElem := tok.(type) {
+		case xml.StartElement:
+			if tokElem.Name.Local == "c" {
+				cellType = attrValue(tokElem, "t")
+				cellRef = attrValue(tokElem, "r")
+			}
+			if tokElem.Name.Local == "v" {
+				inV = true
+				val = ""
+			}
+		case xml.CharData:
+			if inV {
+				val += string(tokElem)
+			}
+		case xml.EndElement:
+			if tokElem.Name.Local == "v" {
+				inV = false
+				text := val
+				if cellType == "s" {
+					idx, _ := strconv.Atoi(val)
+					var ok bool
+					text, ok, err = lookup(idx)
+					if err != nil {
+						return err
 					}
-				case xml.EndElement:
-					if tokElem.Name.Local == "v" {
-						inV = false
-						if cellType == "s" {
-							valIdx, _ := strconv.Atoi(val)
-							if valIdx < 0 || valIdx > ssIndex {
-								continue
-							}
-							_, err = ssFile.Seek(ssOffsets[valIdx], io.SeekStart)
-							if err != nil {
-								return err
-							}
-							reader := bufio.NewReader(ssFile)
-							line, err := reader.ReadString('\n')
-							if err != nil && err != io.EOF {
-								return err
-							}
-							parts := strings.SplitN(line, "|", 2)
-							if len(parts) != 2 {
-								return err
-							}
-							scanTextWithRegex(strings.TrimSpace(parts[1]), kpiResults)
-						} else {
-							scanTextWithRegex(val, kpiResults)
-						}
+					if !ok {
+						continue
 					}
 				}
+
+				seg := TextSegment{
+					Text:     text,
+					Location: sheetName + "!" + cellRef,
+					Type:     SegmentTableCell,
+					Section:  sheetName,
+				}
+				if err := emit(seg); err != nil {
+					return err
+				}
 			}
-			rc.Close()
 		}
 	}
 	return nil
@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Rule is a node of a KPI matching rule. Exactly one of Pattern, All, Any, Not, Near or Fuzzy is set.
+// Scope optionally constrains the node to match within a single sentence or paragraph. Rules are
+// matched one paragraph at a time (a Word paragraph, an Excel cell or a block of PDF lines), so the
+// paragraph scope is what an unscoped rule already gets, stated explicitly.
+//
+//	{"all": [{"pattern": "\\bISO 14001\\b"}, {"not": {"pattern": "(?i)\\bnot required\\b"}}], "scope": "sentence"}
+//	{"near": {"patterns": ["\\bISO 14001\\b", "(?i)\\bcertifi(ed|cation)\\b"], "distance": 20}}
+type Rule struct {
+	Pattern string     `json:"pattern,omitempty"`
+	All     []Rule     `json:"all,omitempty"`
+	Any     []Rule     `json:"any,omitempty"`
+	Not     *Rule      `json:"not,omitempty"`
+	Near    *NearRule  `json:"near,omitempty"`
+	Fuzzy   *FuzzyRule `json:"fuzzy,omitempty"`
+	Scope   string     `json:"scope,omitempty"`
+}
+
+// NearRule matches when every pattern occurs within Distance words of the first pattern
+type NearRule struct {
+	Patterns []string `json:"patterns"`
+	Distance int      `json:"distance"`
+}
+
+const (
+	ScopeSentence  = "sentence"
+	ScopeParagraph = "paragraph"
+)
+
+// ruleMatcher is a compiled Rule. loc is the byte range of the match used to extract the
+// surrounding sentence - it is nil for matches that consist only of absent text (Not).
+type ruleMatcher interface {
+	match(text string) (loc []int, ok bool)
+}
+
+type patternMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m patternMatcher) match(text string) ([]int, bool) {
+	loc := m.re.FindStringIndex(text)
+	return loc, loc != nil
+}
+
+type allMatcher struct {
+	subs []ruleMatcher
+}
+
+func (m allMatcher) match(text string) ([]int, bool) {
+	var first []int
+	for _, sub := range m.subs {
+		loc, ok := sub.match(text)
+		if !ok {
+			return nil, false
+		}
+		if first == nil {
+			first = loc
+		}
+	}
+	return first, true
+}
+
+type anyMatcher struct {
+	subs []ruleMatcher
+}
+
+func (m anyMatcher) match(text string) ([]int, bool) {
+	for _, sub := range m.subs {
+		if loc, ok := sub.match(text); ok {
+			return loc, true
+		}
+	}
+	return nil, false
+}
+
+type notMatcher struct {
+	sub ruleMatcher
+}
+
+func (m notMatcher) match(text string) ([]int, bool) {
+	_, ok := m.sub.match(text)
+	return nil, !ok
+}
+
+type nearMatcher struct {
+	res      []*regexp.Regexp
+	distance int
+}
+
+func (m nearMatcher) match(text string) ([]int, bool) {
+	occurrences := make([][][]int, len(m.res))
+	for i, re := range m.res {
+		occurrences[i] = re.FindAllStringIndex(text, -1)
+		if occurrences[i] == nil {
+			return nil, false
+		}
+	}
+
+	words := wordStarts(text)
+	for _, anchor := range occurrences[0] {
+		anchorWord := wordIndex(words, anchor[0])
+		span := []int{anchor[0], anchor[1]}
+
+		within := true
+		for _, others := range occurrences[1:] {
+			found := false
+			for _, other := range others {
+				if abs(wordIndex(words, other[0])-anchorWord) <= m.distance {
+					span[0] = min(span[0], other[0])
+					span[1] = max(span[1], other[1])
+					found = true
+					break
+				}
+			}
+			if !found {
+				within = false
+				break
+			}
+		}
+
+		if within {
+			return span, true
+		}
+	}
+	return nil, false
+}
+
+// scopeMatcher matches its rule within each sentence of the text in turn
+type scopeMatcher struct {
+	sub ruleMatcher
+}
+
+func (m scopeMatcher) match(text string) ([]int, bool) {
+	for _, span := range sentenceSpans(text) {
+		loc, ok := m.sub.match(text[span[0]:span[1]])
+		if !ok {
+			continue
+		}
+		if loc == nil {
+			return []int{span[0], span[1]}, true
+		}
+		return []int{span[0] + loc[0], span[0] + loc[1]}, true
+	}
+	return nil, false
+}
+
+// compileRule compiles r into a matcher. path locates r within the definition for error messages.
+func compileRule(r Rule, path string) (ruleMatcher, error) {
+	set := 0
+	for _, isSet := range []bool{r.Pattern != "", r.All != nil, r.Any != nil, r.Not != nil, r.Near != nil, r.Fuzzy != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("%s: exactly one of pattern, all, any, not, near or fuzzy must be set", path)
+	}
+
+	var m ruleMatcher
+	switch {
+	case r.Pattern != "":
+		re, err := compilePattern(r.Pattern, path+".pattern")
+		if err != nil {
+			return nil, err
+		}
+		m = patternMatcher{re: re}
+
+	case r.All != nil, r.Any != nil:
+		subRules, op := r.All, "all"
+		if r.Any != nil {
+			subRules, op = r.Any, "any"
+		}
+		if len(subRules) == 0 {
+			return nil, fmt.Errorf("%s.%s: at least one rule is required", path, op)
+		}
+
+		subs := make([]ruleMatcher, 0, len(subRules))
+		for i, sub := range subRules {
+			compiled, err := compileRule(sub, fmt.Sprintf("%s.%s[%d]", path, op, i))
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, compiled)
+		}
+
+		if op == "all" {
+			//positive rules first, so the reported location comes from text that is present
+			sort.SliceStable(subs, func(a, b int) bool {
+				_, aNot := subs[a].(notMatcher)
+				_, bNot := subs[b].(notMatcher)
+				return !aNot && bNot
+			})
+			m = allMatcher{subs: subs}
+		} else {
+			m = anyMatcher{subs: subs}
+		}
+
+	case r.Not != nil:
+		sub, err := compileRule(*r.Not, path+".not")
+		if err != nil {
+			return nil, err
+		}
+		m = notMatcher{sub: sub}
+
+	case r.Near != nil:
+		if len(r.Near.Patterns) < 2 {
+			return nil, fmt.Errorf("%s.near: at least two patterns are required", path)
+		}
+		if r.Near.Distance <= 0 {
+			return nil, fmt.Errorf("%s.near: distance must be greater than 0", path)
+		}
+
+		res := make([]*regexp.Regexp, 0, len(r.Near.Patterns))
+		for i, pattern := range r.Near.Patterns {
+			re, err := compilePattern(pattern, fmt.Sprintf("%s.near.patterns[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, re)
+		}
+		m = nearMatcher{res: res, distance: r.Near.Distance}
+
+	case r.Fuzzy != nil:
+		fuzzy, err := compileFuzzyRule(*r.Fuzzy, path+".fuzzy")
+		if err != nil {
+			return nil, err
+		}
+		m = fuzzy
+	}
+
+	switch r.Scope {
+	case "":
+		return m, nil
+	case ScopeSentence:
+		return scopeMatcher{sub: m}, nil
+	case ScopeParagraph:
+		//the matched text is a single paragraph
+		return m, nil
+	default:
+		return nil, fmt.Errorf("%s.scope: must be %q or %q, got %q", path, ScopeSentence, ScopeParagraph, r.Scope)
+	}
+}
+
+func compilePattern(pattern, path string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%s: invalid pattern %q: %w", path, pattern, err)
+	}
+	if re.MatchString("") {
+		return nil, fmt.Errorf("%s: pattern %q matches the empty string", path, pattern)
+	}
+	return re, nil
+}
+
+var wordRule = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+func wordStarts(text string) []int {
+	locs := wordRule.FindAllStringIndex(text, -1)
+	starts := make([]int, len(locs))
+	for i, loc := range locs {
+		starts[i] = loc[0]
+	}
+	return starts
+}
+
+// wordIndex returns the index of the word containing or following byte offset
+func wordIndex(wordStarts []int, offset int) int {
+	return sort.SearchInts(wordStarts, offset+1) - 1
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
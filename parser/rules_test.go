@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleMatching(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  Rule
+		text  string
+		match bool
+	}{
+		{
+			name:  "pattern",
+			rule:  Rule{Pattern: `\bISO 14001\b`},
+			text:  "The vendor holds ISO 14001 certification.",
+			match: true,
+		},
+		{
+			name:  "all matches when every rule matches",
+			rule:  Rule{All: []Rule{{Pattern: `\bISO 14001\b`}, {Pattern: `(?i)\bcertified\b`}}},
+			text:  "The vendor must be ISO 14001 certified.",
+			match: true,
+		},
+		{
+			name:  "all fails when one rule fails",
+			rule:  Rule{All: []Rule{{Pattern: `\bISO 14001\b`}, {Pattern: `(?i)\bcertified\b`}}},
+			text:  "The vendor follows ISO 14001.",
+			match: false,
+		},
+		{
+			name:  "any matches when one rule matches",
+			rule:  Rule{Any: []Rule{{Pattern: `\bLEED\b`}, {Pattern: `\bBOMA BEST\b`}}},
+			text:  "The building is BOMA BEST certified.",
+			match: true,
+		},
+		{
+			name:  "any fails when no rule matches",
+			rule:  Rule{Any: []Rule{{Pattern: `\bLEED\b`}, {Pattern: `\bBOMA BEST\b`}}},
+			text:  "The building is certified.",
+			match: false,
+		},
+		{
+			name:  "not excludes",
+			rule:  Rule{All: []Rule{{Pattern: `\bISO 14001\b`}, {Not: &Rule{Pattern: `(?i)\bnot required\b`}}}},
+			text:  "ISO 14001 is not required.",
+			match: false,
+		},
+		{
+			name:  "not allows",
+			rule:  Rule{All: []Rule{{Not: &Rule{Pattern: `(?i)\bnot required\b`}}, {Pattern: `\bISO 14001\b`}}},
+			text:  "ISO 14001 is required.",
+			match: true,
+		},
+		{
+			name:  "near within distance",
+			rule:  Rule{Near: &NearRule{Patterns: []string{`\bISO 14001\b`, `(?i)\bcertifi(ed|cation)\b`}, Distance: 3}},
+			text:  "Certification to ISO 14001 is mandatory.",
+			match: true,
+		},
+		{
+			name:  "near beyond distance",
+			rule:  Rule{Near: &NearRule{Patterns: []string{`\bISO 14001\b`, `(?i)\bcertifi(ed|cation)\b`}, Distance: 3}},
+			text:  "ISO 14001 applies to the site, and the staff listed in appendix B hold certification.",
+			match: false,
+		},
+		{
+			name:  "fuzzy tolerates OCR errors",
+			rule:  Rule{Fuzzy: &FuzzyRule{Phrases: []string{"ISO 14001"}, MaxDistance: 1}},
+			text:  "The vendor holds IS0 14001 certification.",
+			match: true,
+		},
+		{
+			name:  "fuzzy beyond max distance",
+			rule:  Rule{Fuzzy: &FuzzyRule{Phrases: []string{"ISO 14001"}, MaxDistance: 1}},
+			text:  "The vendor holds IS0 1400l certification.",
+			match: false,
+		},
+		{
+			name:  "sentence scope within one sentence",
+			rule:  Rule{All: []Rule{{Pattern: `\bISO 14001\b`}, {Pattern: `(?i)\bcertified\b`}}, Scope: ScopeSentence},
+			text:  "Bidders must be ISO 14001 certified. Pricing is fixed.",
+			match: true,
+		},
+		{
+			name:  "sentence scope across sentences",
+			rule:  Rule{All: []Rule{{Pattern: `\bISO 14001\b`}, {Pattern: `(?i)\bcertified\b`}}, Scope: ScopeSentence},
+			text:  "Bidders follow ISO 14001. Staff must be certified.",
+			match: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compileRule(tt.rule, "rule")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := m.match(tt.text); ok != tt.match {
+				t.Errorf("match(%q) = %v, want %v", tt.text, ok, tt.match)
+			}
+		})
+	}
+}
+
+func TestRuleLocationComesFromPresentText(t *testing.T) {
+	m, err := compileRule(Rule{All: []Rule{{Not: &Rule{Pattern: `waived`}}, {Pattern: `\bISO 9001\b`}}}, "rule")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := "Suppliers shall hold ISO 9001."
+	loc, ok := m.match(text)
+	if !ok {
+		t.Fatal("expected a match")
+	}
+	if got := text[loc[0]:loc[1]]; got != "ISO 9001" {
+		t.Errorf("match location = %q, want %q", got, "ISO 9001")
+	}
+}
+
+func TestCompileRuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		want string
+	}{
+		{"no operator", Rule{}, "exactly one of"},
+		{"two operators", Rule{Pattern: "a", Not: &Rule{Pattern: "b"}}, "exactly one of"},
+		{"empty all", Rule{All: []Rule{}}, "at least one rule"},
+		{"near with one pattern", Rule{Near: &NearRule{Patterns: []string{"abc"}, Distance: 5}}, "at least two patterns"},
+		{"near without distance", Rule{Near: &NearRule{Patterns: []string{"abc", "def"}}}, "distance"},
+		{"empty pattern match", Rule{Pattern: "a*"}, "matches the empty string"},
+		{"short fuzzy phrase", Rule{Fuzzy: &FuzzyRule{Phrases: []string{"ISO"}, MaxDistance: 1}}, "too short"},
+		{"unknown scope", Rule{Pattern: "abc", Scope: "page"}, "must be"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileRule(tt.rule, "rule")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesMatchAcrossWrappedPdfLines(t *testing.T) {
+	//one paragraph printed over two lines, the phrase split between them
+	segs := parseTestLayout(t, bboxDocument(bboxPage(
+		[]bboxTestLine{{text: "The contractor shall maintain ISO"}, {text: "14001 certifi-"}, {text: "cation for all sites."}},
+		[]bboxTestLine{{text: "Certification is reviewed annually."}},
+	)))
+
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "near", "name": "Near", "category": "Certifications",
+		 "rule": {"near": {"patterns": ["\\bISO 14001\\b", "(?i)\\bcertification\\b"], "distance": 2}}},
+		{"id": "sentence", "name": "Sentence", "category": "Certifications",
+		 "rule": {"all": [{"pattern": "\\bmaintain ISO 14001\\b"}, {"pattern": "\\ball sites\\b"}], "scope": "sentence"}},
+		{"id": "paragraph", "name": "Paragraph", "category": "Certifications",
+		 "rule": {"all": [{"pattern": "\\bcontractor\\b"}, {"pattern": "\\bsites\\b"}], "scope": "paragraph"}},
+		{"id": "other-block", "name": "Other Block", "category": "Certifications",
+		 "rule": {"all": [{"pattern": "\\bcontractor\\b"}, {"pattern": "\\bannually\\b"}], "scope": "paragraph"}}
+	]}`)
+	kpiResults := CreatePkgResultForRFPPackage(kpiDefs)
+	for _, seg := range segs {
+		ScanSegment(seg, kpiResults, nil)
+	}
+
+	found := make(map[string]KPIResult)
+	for _, result := range RemoveKPIResultsNotFound(kpiResults) {
+		found[result.KPIDef.ID] = result
+	}
+	for _, id := range []string{"near", "sentence", "paragraph"} {
+		result, ok := found[id]
+		if !ok {
+			t.Errorf("%s rule did not match the wrapped phrase", id)
+			continue
+		}
+		if want := "The contractor shall maintain ISO 14001 certification for all sites."; result.Sentence != want {
+			t.Errorf("%s sentence = %q, want %q", id, result.Sentence, want)
+		}
+	}
+	if _, ok := found["other-block"]; ok {
+		t.Error("paragraph-scoped rule matched across two blocks")
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// ScoringSettings weight each KPI occurrence by its requirement strength and where it
+// appeared. A KPI's score is the sum over its occurrences of strength weight x location
+// weight x section weight x KPI weight x category weight.
+type ScoringSettings struct {
+	StrengthWeights map[Strength]float64    `json:"strengthWeights,omitempty"`
+	LocationWeights map[SegmentType]float64 `json:"locationWeights,omitempty"`
+	SectionWeights  []SectionWeight         `json:"sectionWeights,omitempty"`
+	CategoryWeights map[string]float64      `json:"categoryWeights,omitempty"`
+}
+
+// SectionWeight applies Weight to occurrences whose section path matches Pattern. The first
+// matching entry wins; occurrences matching none are weighted 1.
+type SectionWeight struct {
+	Pattern string  `json:"pattern"`
+	Weight  float64 `json:"weight"`
+}
+
+var defaultStrengthWeights = map[Strength]float64{
+	StrengthMandatory:     3,
+	StrengthPreferred:     2,
+	StrengthInformational: 1,
+	StrengthNegated:       0,
+}
+
+var defaultLocationWeights = map[SegmentType]float64{
+	SegmentHeading:   1.5,
+	SegmentParagraph: 1,
+	SegmentTableCell: 1,
+	SegmentLine:      1,
+}
+
+type scoreWeights struct {
+	strength map[Strength]float64
+	location map[SegmentType]float64
+	section  []compiledSectionWeight
+	category map[string]float64
+}
+
+type compiledSectionWeight struct {
+	re     *regexp.Regexp
+	weight float64
+}
+
+func compileScoreWeights(scoring *ScoringSettings) (scoreWeights, error) {
+	weights := scoreWeights{
+		strength: make(map[Strength]float64, len(defaultStrengthWeights)),
+		location: make(map[SegmentType]float64, len(defaultLocationWeights)),
+		category: make(map[string]float64),
+	}
+	for k, v := range defaultStrengthWeights {
+		weights.strength[k] = v
+	}
+	for k, v := range defaultLocationWeights {
+		weights.location[k] = v
+	}
+
+	if scoring == nil {
+		return weights, nil
+	}
+
+	for strength, w := range scoring.StrengthWeights {
+		if _, ok := defaultStrengthWeights[strength]; !ok {
+			return scoreWeights{}, fmt.Errorf("scoring.strengthWeights: unknown strength %q", strength)
+		}
+		if w < 0 {
+			return scoreWeights{}, fmt.Errorf("scoring.strengthWeights.%s: weight must not be negative", strength)
+		}
+		weights.strength[strength] = w
+	}
+	for segType, w := range scoring.LocationWeights {
+		if _, ok := defaultLocationWeights[segType]; !ok {
+			return scoreWeights{}, fmt.Errorf("scoring.locationWeights: unknown segment type %q", segType)
+		}
+		if w < 0 {
+			return scoreWeights{}, fmt.Errorf("scoring.locationWeights.%s: weight must not be negative", segType)
+		}
+		weights.location[segType] = w
+	}
+	for i, sw := range scoring.SectionWeights {
+		re, err := compilePattern(sw.Pattern, fmt.Sprintf("scoring.sectionWeights[%d].pattern", i))
+		if err != nil {
+			return scoreWeights{}, err
+		}
+		if sw.Weight < 0 {
+			return scoreWeights{}, fmt.Errorf("scoring.sectionWeights[%d]: weight must not be negative", i)
+		}
+		weights.section = append(weights.section, compiledSectionWeight{re: re, weight: sw.Weight})
+	}
+	for category, w := range scoring.CategoryWeights {
+		if w < 0 {
+			return scoreWeights{}, fmt.Errorf("scoring.categoryWeights.%s: weight must not be negative", category)
+		}
+		weights.category[category] = w
+	}
+	return weights, nil
+}
+
+// occurrenceScore is the contribution of one match of def in seg
+func (w scoreWeights) occurrenceScore(def *KPIDefinition, strength Strength, seg TextSegment) float64 {
+	location, ok := w.location[seg.Type]
+	if !ok {
+		location = 1
+	}
+	section := 1.0
+	for _, sw := range w.section {
+		if sw.re.MatchString(seg.Section) {
+			section = sw.weight
+			break
+		}
+	}
+	category, ok := w.category[def.Category]
+	if !ok {
+		category = 1
+	}
+	return w.strength[strength] * location * section * def.weight() * category
+}
+
+// CategoryScores sums the KPI scores of a package per KPI category
+func CategoryScores(kpiResults []KPIResult) map[string]float64 {
+	scores := make(map[string]float64)
+	for _, result := range kpiResults {
+		scores[result.KPIDef.Category] += result.Score
+	}
+	return scores
+}
@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestScoreWeightsOccurrences(t *testing.T) {
+	kpiDefs := compileKPIs(t, `{"version": 2,
+		"scoring": {
+			"locationWeights": {"heading": 2},
+			"sectionWeights": [{"pattern": "(?i)evaluation", "weight": 3}],
+			"categoryWeights": {"Certifications": 0.5}
+		},
+		"kpis": [
+			{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "weight": 2, "regexps": ["\\bISO 14001\\b"]}
+		]}`)
+	results := CreatePkgResultForRFPPackage(kpiDefs)
+
+	//mandatory (3) x paragraph (1) x section (1) x KPI (2) x category (0.5) = 3
+	MatchSegment(TextSegment{Text: "The Contractor shall maintain ISO 14001 certification.", Type: SegmentParagraph}, results)
+	//preferred (2) x heading (2) x section (3) x KPI (2) x category (0.5) = 12
+	MatchSegment(TextSegment{Text: "ISO 14001 is preferred", Type: SegmentHeading, Section: "4 Evaluation Criteria"}, results)
+	//negated (0) adds nothing
+	MatchSegment(TextSegment{Text: "ISO 14001 is not required.", Type: SegmentParagraph}, results)
+
+	if got := results[0].Score; math.Abs(got-15) > 1e-9 {
+		t.Errorf("score = %v, want 15", got)
+	}
+}
+
+func TestScoreWeightsDefaults(t *testing.T) {
+	weights, err := compileScoreWeights(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := &KPIDefinition{Category: "Policies"}
+
+	tests := []struct {
+		strength Strength
+		segType  SegmentType
+		want     float64
+	}{
+		{StrengthMandatory, SegmentParagraph, 3},
+		{StrengthPreferred, SegmentTableCell, 2},
+		{StrengthInformational, SegmentHeading, 1.5},
+		{StrengthNegated, SegmentHeading, 0},
+	}
+	for _, tt := range tests {
+		got := weights.occurrenceScore(def, tt.strength, TextSegment{Type: tt.segType})
+		if got != tt.want {
+			t.Errorf("occurrenceScore(%s, %s) = %v, want %v", tt.strength, tt.segType, got, tt.want)
+		}
+	}
+}
+
+func TestScoreWeightsFirstMatchingSectionWins(t *testing.T) {
+	weights, err := compileScoreWeights(&ScoringSettings{
+		SectionWeights: []SectionWeight{
+			{Pattern: "(?i)appendix", Weight: 0.5},
+			{Pattern: "(?i)evaluation", Weight: 2},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seg := TextSegment{Type: SegmentParagraph, Section: "Appendix A > Evaluation Criteria"}
+	if got := weights.occurrenceScore(&KPIDefinition{}, StrengthInformational, seg); got != 0.5 {
+		t.Errorf("score = %v, want 0.5", got)
+	}
+}
+
+func TestScoreWeightsInvalid(t *testing.T) {
+	tests := []struct {
+		scoring ScoringSettings
+		want    string
+	}{
+		{ScoringSettings{StrengthWeights: map[Strength]float64{"Required": 1}}, "unknown strength"},
+		{ScoringSettings{StrengthWeights: map[Strength]float64{StrengthMandatory: -1}}, "must not be negative"},
+		{ScoringSettings{LocationWeights: map[SegmentType]float64{"footer": 1}}, "unknown segment type"},
+		{ScoringSettings{SectionWeights: []SectionWeight{{Pattern: "(", Weight: 1}}}, "sectionWeights[0].pattern"},
+		{ScoringSettings{SectionWeights: []SectionWeight{{Pattern: "x", Weight: -1}}}, "must not be negative"},
+		{ScoringSettings{CategoryWeights: map[string]float64{"Policies": -2}}, "must not be negative"},
+	}
+
+	for _, tt := range tests {
+		_, err := compileScoreWeights(&tt.scoring)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("compileScoreWeights(%+v) error = %v, want one containing %q", tt.scoring, err, tt.want)
+		}
+	}
+}
+
+func TestCategoryScores(t *testing.T) {
+	certs := &KPIDefinition{Category: "Certifications"}
+	policies := &KPIDefinition{Category: "Policies"}
+
+	scores := CategoryScores([]KPIResult{
+		{KPIDef: certs, Score: 3},
+		{KPIDef: policies, Score: 1.5},
+		{KPIDef: certs, Score: 4.5},
+	})
+
+	want := map[string]float64{"Certifications": 7.5, "Policies": 1.5}
+	if len(scores) != len(want) {
+		t.Fatalf("scores = %v, want %v", scores, want)
+	}
+	for category, score := range want {
+		if scores[category] != score {
+			t.Errorf("score for %s = %v, want %v", category, scores[category], score)
+		}
+	}
+}
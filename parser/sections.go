@@ -0,0 +1,29 @@
+package parser
+
+import "strings"
+
+// sectionSeparator joins the headings of a section path, e.g. "Evaluation Criteria > Mandatory Requirements"
+const sectionSeparator = " > "
+
+// sectionTracker maintains the heading hierarchy of a document as headings are encountered
+type sectionTracker struct {
+	headings []string
+}
+
+// enter records a heading at level (1 = top level) and returns the resulting section path
+func (t *sectionTracker) enter(level int, heading string) string {
+	heading = strings.Join(strings.Fields(heading), " ")
+	if level < 1 {
+		level = 1
+	}
+	if len(t.headings) >= level {
+		t.headings = t.headings[:level-1]
+	}
+	//a skipped level (Heading 1 followed by Heading 3) is not padded
+	t.headings = append(t.headings, heading)
+	return t.path()
+}
+
+func (t *sectionTracker) path() string {
+	return strings.Join(t.headings, sectionSeparator)
+}
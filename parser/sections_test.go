@@ -0,0 +1,63 @@
+package parser
+
+import "testing"
+
+func TestSectionTracker(t *testing.T) {
+	steps := []struct {
+		level   int
+		heading string
+		want    string
+	}{
+		{1, "Scope of Work", "Scope of Work"},
+		{2, "Facilities", "Scope of Work > Facilities"},
+		{3, "HVAC", "Scope of Work > Facilities > HVAC"},
+		//a sibling replaces the heading at its level and everything below it
+		{2, "Security", "Scope of Work > Security"},
+		//a skipped level is not padded
+		{4, "Patrols", "Scope of Work > Security > Patrols"},
+		{3, "Alarms", "Scope of Work > Security > Alarms"},
+		{1, "  Evaluation\n Criteria ", "Evaluation Criteria"},
+		//levels below 1 are top level
+		{0, "Appendix A", "Appendix A"},
+	}
+
+	var tracker sectionTracker
+	if got := tracker.path(); got != "" {
+		t.Errorf("initial path = %q, want empty", got)
+	}
+	for _, step := range steps {
+		if got := tracker.enter(step.level, step.heading); got != step.want {
+			t.Errorf("enter(%d, %q) = %q, want %q", step.level, step.heading, got, step.want)
+		}
+		if got := tracker.path(); got != step.want {
+			t.Errorf("path after %q = %q, want %q", step.heading, got, step.want)
+		}
+	}
+}
+
+func TestSectionFilterOnParsedDocument(t *testing.T) {
+	segs := parseTestDocx(t, testDocx(t, testStylesXML,
+		docxParagraph("Titre1", "Sample Contract"),
+		docxParagraph("", "The contractor must hold ISO 14001 certification."),
+		docxParagraph("Titre1", "Evaluation Criteria"),
+		docxParagraph("Titre2", "Mandatory Requirements"),
+		docxParagraph("", "Bidders shall be ISO 14001 certified."),
+	))
+
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["\\bISO 14001\\b"],
+		 "sections": {"include": ["(?i)evaluation criteria"], "exclude": ["(?i)sample contract"]}}
+	]}`)
+	kpiResults := CreatePkgResultForRFPPackage(kpiDefs)
+	for _, seg := range segs {
+		ScanSegment(seg, kpiResults, nil)
+	}
+
+	result := kpiResults[0]
+	if !result.Found || result.Occurrences != 1 {
+		t.Fatalf("found %t with %d occurrences, want the one under Evaluation Criteria", result.Found, result.Occurrences)
+	}
+	if result.Sentence != "Bidders shall be ISO 14001 certified." {
+		t.Errorf("sentence = %q, want the one under Evaluation Criteria", result.Sentence)
+	}
+}
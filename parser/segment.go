@@ -0,0 +1,29 @@
+package parser
+
+// ExtractorVersion identifies the output format of the parsers. Bump it whenever a parser
+// changes the segments it produces so cached extractions are invalidated.
+const ExtractorVersion = "4"
+
+// SegmentType describes the structural element a TextSegment was extracted from.
+type SegmentType string
+
+const (
+	SegmentParagraph SegmentType = "paragraph"
+	SegmentHeading   SegmentType = "heading"
+	SegmentTableCell SegmentType = "cell"
+	SegmentLine      SegmentType = "line" //no longer emitted, PDF lines are joined into paragraphs
+)
+
+// TextSegment is a unit of normalised text produced by a file parser. Parsers only extract
+// segments - KPI matching happens in a separate stage that consumes them (see MatchSegment).
+type TextSegment struct {
+	Text     string      `json:"text"`
+	File     string      `json:"file,omitempty"` //path of the file within its package, e.g. "Addenda/Addendum 1.pdf"
+	Location string      `json:"location,omitempty"`
+	Type     SegmentType `json:"type"`
+	Section  string      `json:"section,omitempty"`  //heading path, e.g. "Evaluation Criteria > Mandatory Requirements"
+	Language string      `json:"language,omitempty"` //detected language of the document, see WithLanguageDetection
+}
+
+// SegmentFunc receives each TextSegment as it is extracted. Returning an error stops the parser.
+type SegmentFunc func(seg TextSegment) error
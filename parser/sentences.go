@@ -0,0 +1,293 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxContextLength = 400
+	minMaxContextLength     = 40
+	ellipsis                = "…"
+)
+
+// ContextSettings controls the sentence reported for a match
+type ContextSettings struct {
+	//MaxLength caps the reported context in characters. Longer sentences are trimmed to a window
+	//centred on the match, with an ellipsis marking each cut. Default 400
+	MaxLength int `json:"maxLength,omitempty"`
+}
+
+func compileMaxContextLength(context *ContextSettings) (int, error) {
+	if context == nil || context.MaxLength == 0 {
+		return defaultMaxContextLength, nil
+	}
+	if context.MaxLength < minMaxContextLength {
+		return 0, fmt.Errorf("context.maxLength: must be at least %d, got %d", minMaxContextLength, context.MaxLength)
+	}
+	return context.MaxLength, nil
+}
+
+// abbreviations never end a sentence when followed by a full stop. Lowercase, without the final
+// full stop. Abbreviations that commonly end sentences ("etc.", "Inc.") are deliberately left out.
+var abbreviations = map[string]bool{
+	//English
+	"e.g": true, "i.e": true, "eg": true, "ie": true, "cf": true, "vs": true, "viz": true, "al": true,
+	"no": true, "nos": true, "num": true, "approx": true, "appx": true, "est": true, "min": true, "max": true, "avg": true,
+	"incl": true, "excl": true, "fig": true, "figs": true, "sec": true, "sect": true, "art": true, "para": true,
+	"ref": true, "refs": true, "vol": true, "p": true, "pp": true, "ch": true, "app": true, "dept": true, "div": true,
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true, "jr": true, "sr": true, "govt": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+	//French
+	"p. ex": true, "env": true, "chap": true, "mme": true, "mlle": true,
+}
+
+// listMarker matches an inline list marker such as "(a)", "b)", "(iv)" or "2)" between spaces
+var listMarker = regexp.MustCompile(`(?:^|\s)(\(?(?:[a-z]|[ivx]{1,4}|\d{1,2})\))\s`)
+
+func isBullet(r rune) bool {
+	switch r {
+	case '•', '▪', '◦', '‣', '●', '■', '□', '◆', '➢':
+		return true
+	}
+	return false
+}
+
+func isTerminal(r rune) bool {
+	switch r {
+	case '.', '!', '?', ';', '…':
+		return true
+	}
+	return false
+}
+
+func isCloser(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '»', '”', '’':
+		return true
+	}
+	return false
+}
+
+func isOpener(r rune) bool {
+	switch r {
+	case '"', '\'', '(', '[', '«', '“', '‘':
+		return true
+	}
+	return false
+}
+
+// sentenceSpans splits text into [start, end) byte ranges, trimmed of surrounding space. A sentence
+// ends at ., !, ?, ; or … followed by space and a sentence start, except after an abbreviation or
+// initial. Bullets, and inline list markers when the text has two or more of them, start a new span.
+func sentenceSpans(text string) [][]int {
+	listStarts := make(map[int]bool)
+	if markers := listMarker.FindAllStringSubmatchIndex(text, -1); len(markers) >= 2 {
+		for _, m := range markers {
+			listStarts[m[2]] = true
+		}
+	}
+
+	var spans [][]int
+	start := 0
+	split := func(end, next int) {
+		s, e := trimSpan(text, start, end)
+		if e > s {
+			spans = append(spans, []int{s, e})
+		}
+		start = next
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		switch {
+		case isBullet(r):
+			split(i, i+size)
+			i += size
+			continue
+
+		case listStarts[i]:
+			split(i, i)
+
+		case isTerminal(r):
+			end := i + size
+			for end < len(text) {
+				next, n := utf8.DecodeRuneInString(text[end:])
+				if !isTerminal(next) && !isCloser(next) {
+					break
+				}
+				end += n
+			}
+			//French spaces closing guillemets: « ... ! »
+			if strings.HasPrefix(text[end:], " »") {
+				end += len(" »")
+			}
+
+			next := end
+			for next < len(text) {
+				r, n := utf8.DecodeRuneInString(text[next:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				next += n
+			}
+
+			//no space after it ("3.5", "e.g.ISO"), or nothing follows
+			if next == end || next == len(text) {
+				i = end
+				continue
+			}
+			if endsSentence(text, i, r, next) {
+				split(end, next)
+			}
+			i = next
+			continue
+		}
+		i += size
+	}
+	split(len(text), len(text))
+
+	if len(spans) == 0 {
+		return [][]int{{0, len(text)}}
+	}
+	return spans
+}
+
+// endsSentence decides whether the terminal punctuation r at punct, followed by the text at next, ends a sentence
+func endsSentence(text string, punct int, r rune, next int) bool {
+	if r == ';' {
+		return true
+	}
+
+	first, n := utf8.DecodeRuneInString(text[next:])
+	if isOpener(first) {
+		first, _ = utf8.DecodeRuneInString(strings.TrimLeft(text[next+n:], " "))
+	}
+	if unicode.IsLower(first) {
+		return false
+	}
+	if r != '.' {
+		return true
+	}
+
+	word := wordBefore(text, punct)
+	if abbreviations[strings.ToLower(word)] {
+		return false
+	}
+	//"p. ex." - the abbreviation spans a space
+	if prev := wordBefore(text, punct-len(word)-1); prev != "" && abbreviations[strings.ToLower(prev+" "+word)] {
+		return false
+	}
+	//initials ("J. Smith") and dotted abbreviations ("U.S.")
+	if first, _ := utf8.DecodeRuneInString(word); (utf8.RuneCountInString(word) == 1 && unicode.IsLetter(first)) || strings.Contains(word, ".") {
+		return false
+	}
+	return true
+}
+
+// wordBefore returns the non-space run of text ending at end, without opening brackets or quotes
+func wordBefore(text string, end int) string {
+	if end <= 0 || end > len(text) {
+		return ""
+	}
+	start := end
+	for start > 0 {
+		r, n := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsSpace(r) || isOpener(r) {
+			break
+		}
+		start -= n
+	}
+	return text[start:end]
+}
+
+func trimSpan(text string, start, end int) (int, int) {
+	for start < end {
+		r, n := utf8.DecodeRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += n
+	}
+	for end > start {
+		r, n := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		end -= n
+	}
+	return start, end
+}
+
+// sentenceBounds returns the byte range of the sentences of text spanning the match at targetLoc.
+// A nil targetLoc (a rule satisfied only by absent text) returns the whole text.
+func sentenceBounds(text string, targetLoc []int) (int, int) {
+	if targetLoc == nil {
+		return trimSpan(text, 0, len(text))
+	}
+
+	spans := sentenceSpans(text)
+	leftIdx, rightIdx := spans[0][0], spans[len(spans)-1][1]
+	for _, span := range spans {
+		if span[0] <= targetLoc[0] {
+			leftIdx = span[0]
+		}
+		if span[1] >= targetLoc[1] {
+			rightIdx = span[1]
+			break
+		}
+	}
+	//the match can start in the space before a trimmed span
+	leftIdx = min(leftIdx, targetLoc[0])
+	rightIdx = max(rightIdx, targetLoc[1])
+	return leftIdx, rightIdx
+}
+
+// trimContext shortens sentence to at most maxLength characters, keeping a window centred on the
+// match at [matchStart, matchEnd), cut at word boundaries and marked with an ellipsis at each cut
+func trimContext(sentence string, matchStart, matchEnd, maxLength int) string {
+	runes := []rune(sentence)
+	if maxLength <= 0 || len(runes) <= maxLength {
+		return sentence
+	}
+
+	ms := utf8.RuneCountInString(sentence[:matchStart])
+	me := ms + utf8.RuneCountInString(sentence[matchStart:matchEnd])
+
+	budget := maxLength - 2*utf8.RuneCountInString(ellipsis)
+	start := (ms+me)/2 - budget/2
+	start = max(0, min(start, len(runes)-budget))
+	end := start + budget
+
+	//cut at word boundaries, without cutting into the match
+	if start > 0 {
+		for s := start; s < ms && s < end; s++ {
+			if unicode.IsSpace(runes[s-1]) {
+				start = s
+				break
+			}
+		}
+	}
+	if end < len(runes) {
+		for e := end; e > me && e > start; e-- {
+			if unicode.IsSpace(runes[e]) {
+				end = e
+				break
+			}
+		}
+	}
+
+	context := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		context = ellipsis + context
+	}
+	if end < len(runes) {
+		context += ellipsis
+	}
+	return context
+}
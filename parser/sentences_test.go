@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func sentences(text string) []string {
+	var out []string
+	for _, span := range sentenceSpans(text) {
+		out = append(out, text[span[0]:span[1]])
+	}
+	return out
+}
+
+func TestSentenceSpans(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "two sentences",
+			text: "The contractor must be certified. Invoices are due monthly.",
+			want: []string{"The contractor must be certified.", "Invoices are due monthly."},
+		},
+		{
+			name: "e.g. before a capital",
+			text: "Provide proof of certification, e.g. ISO 14001 or equivalent. Invoices are due monthly.",
+			want: []string{"Provide proof of certification, e.g. ISO 14001 or equivalent.", "Invoices are due monthly."},
+		},
+		{
+			name: "i.e. and vs.",
+			text: "Use recycled paper, i.e. FSC certified. Price vs. Quality is weighted 40/60.",
+			want: []string{"Use recycled paper, i.e. FSC certified.", "Price vs. Quality is weighted 40/60."},
+		},
+		{
+			name: "No. before a number",
+			text: "Refer to Addendum No. 5 for the revised dates. Questions close Friday.",
+			want: []string{"Refer to Addendum No. 5 for the revised dates.", "Questions close Friday."},
+		},
+		{
+			name: "section reference",
+			text: "As described in Sec. 4.2 the bid bond is required. See Fig. 3 for the layout.",
+			want: []string{"As described in Sec. 4.2 the bid bond is required.", "See Fig. 3 for the layout."},
+		},
+		{
+			name: "decimals and percentages",
+			text: "Reduce emissions by 3.5 % by 2030. The target is 12.75 tonnes.",
+			want: []string{"Reduce emissions by 3.5 % by 2030.", "The target is 12.75 tonnes."},
+		},
+		{
+			name: "initials and dotted abbreviations",
+			text: "Contact J. Smith at the U.S. office. Bids close at noon.",
+			want: []string{"Contact J. Smith at the U.S. office.", "Bids close at noon."},
+		},
+		{
+			name: "sentence ending with etc.",
+			text: "Provide safety plans, insurance, etc. The owner will review them.",
+			want: []string{"Provide safety plans, insurance, etc.", "The owner will review them."},
+		},
+		{
+			name: "lowercase start continues the sentence",
+			text: "Approx. three sites are included. approx. 40 staff attend.",
+			want: []string{"Approx. three sites are included. approx. 40 staff attend."},
+		},
+		{
+			name: "closing quote after the full stop",
+			text: `The clause reads "the vendor shall comply." The next clause is optional.`,
+			want: []string{`The clause reads "the vendor shall comply."`, "The next clause is optional."},
+		},
+		{
+			name: "closing bracket after the full stop",
+			text: "Bonds are required (see the rate table.) Submissions must be signed.",
+			want: []string{"Bonds are required (see the rate table.)", "Submissions must be signed."},
+		},
+		{
+			name: "sentence starting with a quote",
+			text: `Bids close Friday. "Late" bids are rejected.`,
+			want: []string{"Bids close Friday.", `"Late" bids are rejected.`},
+		},
+		{
+			name: "french guillemets",
+			text: "Le fournisseur doit être « certifié ISO 14001 ». Les factures sont mensuelles.",
+			want: []string{"Le fournisseur doit être « certifié ISO 14001 ».", "Les factures sont mensuelles."},
+		},
+		{
+			name: "french guillemets closing after the punctuation",
+			text: "L'avis indique « Les soumissions tardives sont refusées ! » Le délai est ferme.",
+			want: []string{"L'avis indique « Les soumissions tardives sont refusées ! »", "Le délai est ferme."},
+		},
+		{
+			name: "french abbreviation spanning a space",
+			text: "Fournir une preuve, p. ex. ISO 14001. Les factures sont mensuelles.",
+			want: []string{"Fournir une preuve, p. ex. ISO 14001.", "Les factures sont mensuelles."},
+		},
+		{
+			name: "question, exclamation, semicolon and ellipsis",
+			text: "Is the site accessible? Yes! Parking is limited; carpool where possible… Arrive early.",
+			want: []string{"Is the site accessible?", "Yes!", "Parking is limited;", "carpool where possible…", "Arrive early."},
+		},
+		{
+			name: "repeated punctuation",
+			text: "Really?! The deadline moved.",
+			want: []string{"Really?!", "The deadline moved."},
+		},
+		{
+			name: "bullets",
+			text: "Requirements: • ISO 14001 • ISO 9001 • LEED Gold",
+			want: []string{"Requirements:", "ISO 14001", "ISO 9001", "LEED Gold"},
+		},
+		{
+			name: "inline list markers",
+			text: "The vendor shall (a) hold ISO 14001 (b) report emissions yearly",
+			want: []string{"The vendor shall", "(a) hold ISO 14001", "(b) report emissions yearly"},
+		},
+		{
+			name: "a single bracketed letter is not a list",
+			text: "Refer to Schedule (a) for details.",
+			want: []string{"Refer to Schedule (a) for details."},
+		},
+		{
+			name: "no terminal punctuation",
+			text: "  Evaluation Criteria  ",
+			want: []string{"Evaluation Criteria"},
+		},
+		{
+			name: "only space",
+			text: "   ",
+			want: []string{"   "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sentences =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentenceBounds(t *testing.T) {
+	text := "Bids close Friday. Suppliers must hold ISO 14001, e.g. through BSI. Invoices are due monthly."
+
+	tests := []struct {
+		name  string
+		match string
+		want  string
+	}{
+		{"within one sentence", "ISO 14001", "Suppliers must hold ISO 14001, e.g. through BSI."},
+		{"spanning two sentences", "Friday. Suppliers", "Bids close Friday. Suppliers must hold ISO 14001, e.g. through BSI."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := strings.Index(text, tt.match)
+			start, end := sentenceBounds(text, []int{i, i + len(tt.match)})
+			if got := text[start:end]; got != tt.want {
+				t.Errorf("sentence = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	//a match of absent text reports the whole text
+	if start, end := sentenceBounds("  "+text+" ", nil); end-start != len(text) {
+		t.Errorf("nil match bounds = %d..%d, want the trimmed text", start, end)
+	}
+}
+
+func TestTrimContext(t *testing.T) {
+	sentence := "The successful proponent shall, for the full term of the agreement and any renewal, maintain ISO 14001 certification for every facility operated on behalf of the City of Ottawa."
+	match := strings.Index(sentence, "ISO 14001")
+	matchEnd := match + len("ISO 14001")
+
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{"fits", 500, sentence},
+		{"no limit", 0, sentence},
+		{"window around the match", 60, "…any renewal, maintain ISO 14001 certification for every…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimContext(sentence, match, matchEnd, tt.maxLength)
+			if got != tt.want {
+				t.Errorf("trimContext = %q, want %q", got, tt.want)
+			}
+			if tt.maxLength > 0 && utf8.RuneCountInString(got) > tt.maxLength {
+				t.Errorf("trimContext is %d characters, over %d", utf8.RuneCountInString(got), tt.maxLength)
+			}
+		})
+	}
+}
+
+func TestTrimContextAtTheEdges(t *testing.T) {
+	sentence := "ISO 14001 certification is required for every facility operated on behalf of the City of Ottawa under this agreement."
+
+	//a match at the start is only cut on the right
+	got := trimContext(sentence, 0, len("ISO 14001"), 50)
+	if !strings.HasPrefix(got, "ISO 14001") || !strings.HasSuffix(got, ellipsis) {
+		t.Errorf("trimContext = %q, want the start kept and the end cut", got)
+	}
+
+	//a match at the end is only cut on the left
+	end := strings.Index(sentence, "agreement.")
+	got = trimContext(sentence, end, len(sentence), 50)
+	if !strings.HasPrefix(got, ellipsis) || !strings.HasSuffix(got, "agreement.") {
+		t.Errorf("trimContext = %q, want the end kept and the start cut", got)
+	}
+
+	//accented text is counted in characters
+	french := strings.Repeat("é", 30) + " certifié ISO 14001 " + strings.Repeat("é", 30)
+	i := strings.Index(french, "ISO")
+	got = trimContext(french, i, i+len("ISO 14001"), 40)
+	if n := utf8.RuneCountInString(got); n > 40 || !strings.Contains(got, "ISO 14001") {
+		t.Errorf("trimContext = %q (%d characters), want at most 40 with the match", got, n)
+	}
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strength classifies how strongly the sentence around a match asks for the KPI
+type Strength string
+
+const (
+	StrengthMandatory     Strength = "Mandatory"
+	StrengthPreferred     Strength = "Preferred"
+	StrengthInformational Strength = "Informational"
+	StrengthNegated       Strength = "Negated"
+)
+
+// strengthRank orders strengths when a KPI matches more than once - the strongest sentence is reported
+var strengthRank = map[Strength]int{
+	StrengthNegated:       0,
+	StrengthInformational: 1,
+	StrengthPreferred:     2,
+	StrengthMandatory:     3,
+}
+
+// StrengthCues are the phrases that classify a matched sentence. Each list that is set in
+// kpiDefinitions.json replaces the default list for that strength. Phrases are matched
+// case-insensitively on word boundaries; negated cues are checked before mandatory ones so
+// "not required" is not read as "required".
+type StrengthCues struct {
+	Mandatory []string `json:"mandatory,omitempty"`
+	Preferred []string `json:"preferred,omitempty"`
+	Negated   []string `json:"negated,omitempty"`
+}
+
+var defaultStrengthCues = StrengthCues{
+	Mandatory: []string{"must", "shall", "required", "requires", "requirement", "mandatory", "compulsory", "is expected to", "are expected to",
+		//French
+		"doit", "doivent", "devra", "devront", "obligatoire", "obligatoires", "exigé", "exigée", "exigence", "requis", "requise"},
+	Preferred: []string{"prefer", "prefers", "preferred", "preference", "should", "desirable", "desired", "encouraged", "asset", "advantage", "nice to have", "optional", "bonus points",
+		//French
+		"de préférence", "préférable", "souhaitable", "souhaité", "devrait", "devraient", "un atout", "facultatif", "facultative", "optionnel"},
+	Negated: []string{"not required", "is not a requirement", "no requirement", "not mandatory", "need not", "not necessary", "not applicable", "N/A", "does not apply", "will not be considered", "shall not be required",
+		//French
+		"n'est pas requis", "n'est pas requise", "non requis", "non obligatoire", "n'est pas obligatoire", "sans objet", "ne s'applique pas"},
+}
+
+// matchSettings are the compiled file-level settings shared by every definition in a file
+type matchSettings struct {
+	mandatory *regexp.Regexp
+	preferred *regexp.Regexp
+	negated   *regexp.Regexp
+	weights   scoreWeights
+	//maxContext caps the reported sentence in characters
+	maxContext int
+	//hash identifies the file-level settings the KPIs are matched with, "" for the defaults
+	hash string
+}
+
+var defaultMatchSettings = mustCompileMatchSettings(&KPIDefinitionFile{})
+
+func mustCompileMatchSettings(f *KPIDefinitionFile) *matchSettings {
+	settings, err := compileMatchSettings(f)
+	if err != nil {
+		panic(err)
+	}
+	return settings
+}
+
+func compileMatchSettings(f *KPIDefinitionFile) (*matchSettings, error) {
+	cues := defaultStrengthCues
+	if f.StrengthCues != nil {
+		if f.StrengthCues.Mandatory != nil {
+			cues.Mandatory = f.StrengthCues.Mandatory
+		}
+		if f.StrengthCues.Preferred != nil {
+			cues.Preferred = f.StrengthCues.Preferred
+		}
+		if f.StrengthCues.Negated != nil {
+			cues.Negated = f.StrengthCues.Negated
+		}
+	}
+
+	var settings matchSettings
+	var err error
+	if settings.mandatory, err = compileCues(cues.Mandatory, "strengthCues.mandatory"); err != nil {
+		return nil, err
+	}
+	if settings.preferred, err = compileCues(cues.Preferred, "strengthCues.preferred"); err != nil {
+		return nil, err
+	}
+	if settings.negated, err = compileCues(cues.Negated, "strengthCues.negated"); err != nil {
+		return nil, err
+	}
+	if settings.weights, err = compileScoreWeights(f.Scoring); err != nil {
+		return nil, err
+	}
+	if settings.maxContext, err = compileMaxContextLength(f.Context); err != nil {
+		return nil, err
+	}
+	settings.hash = hashMatchSettings(f)
+	return &settings, nil
+}
+
+// hashMatchSettings hashes the strength cues, scoring and context settings as declared in the file
+func hashMatchSettings(f *KPIDefinitionFile) string {
+	if f.StrengthCues == nil && f.Scoring == nil && f.Context == nil {
+		return ""
+	}
+
+	declared := struct {
+		StrengthCues *StrengthCues    `json:"strengthCues,omitempty"`
+		Scoring      *ScoringSettings `json:"scoring,omitempty"`
+		Context      *ContextSettings `json:"context,omitempty"`
+	}{f.StrengthCues, f.Scoring, f.Context}
+
+	b, _ := json.Marshal(declared)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// compileCues builds one case-insensitive alternation from a list of phrases. An empty list never matches.
+func compileCues(phrases []string, field string) (*regexp.Regexp, error) {
+	if len(phrases) == 0 {
+		return nil, nil
+	}
+
+	alternatives := make([]string, 0, len(phrases))
+	for i, phrase := range phrases {
+		phrase = strings.TrimSpace(phrase)
+		if phrase == "" {
+			return nil, fmt.Errorf("%s[%d]: cue phrase is empty", field, i)
+		}
+		alternatives = append(alternatives, phrasePattern(phrase))
+	}
+	return regexp.Compile(`(?i)(?:` + strings.Join(alternatives, "|") + `)`)
+}
+
+// phrasePattern quotes phrase, allows any whitespace between its words and anchors it on word
+// boundaries where it starts or ends with a word character
+func phrasePattern(phrase string) string {
+	words := strings.Fields(phrase)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	pattern := strings.Join(words, `\s+`)
+
+	first, _ := utf8.DecodeRuneInString(phrase)
+	last, _ := utf8.DecodeLastRuneInString(phrase)
+	if isWordRune(first) {
+		pattern = `\b` + pattern
+	}
+	if isWordRune(last) {
+		pattern += `\b`
+	}
+	return pattern
+}
+
+// isWordRune mirrors regexp's ASCII-only \b, so "exigé" is not anchored after its final letter
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// classify returns the requirement strength expressed by sentence
+func (s *matchSettings) classify(sentence string) Strength {
+	switch {
+	case s.negated != nil && s.negated.MatchString(sentence):
+		return StrengthNegated
+	case s.mandatory != nil && s.mandatory.MatchString(sentence):
+		return StrengthMandatory
+	case s.preferred != nil && s.preferred.MatchString(sentence):
+		return StrengthPreferred
+	}
+	return StrengthInformational
+}
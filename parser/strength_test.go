@@ -0,0 +1,84 @@
+package parser
+
+import "testing"
+
+func TestClassifyStrength(t *testing.T) {
+	tests := []struct {
+		sentence string
+		want     Strength
+	}{
+		{"The Contractor shall maintain ISO 14001 certification.", StrengthMandatory},
+		{"Proponents must be ISO 9001 certified.", StrengthMandatory},
+		{"ISO 14001 certification is mandatory.", StrengthMandatory},
+		{"ISO 14001 certification is not required.", StrengthNegated},
+		{"Proponents shall not be required to hold LEED accreditation.", StrengthNegated},
+		{"Bonding: N/A", StrengthNegated},
+		{"LEED accreditation is preferred.", StrengthPreferred},
+		{"An EcoVadis rating would be an asset.", StrengthPreferred},
+		{"The vendor should describe its sustainability program.", StrengthPreferred},
+		{"The City adopted ISO 14001 in 2019.", StrengthInformational},
+		{"Le soumissionnaire doit détenir la certification ISO 14001.", StrengthMandatory},
+		{"La certification ISO 14001 n'est pas requise.", StrengthNegated},
+		{"La certification LEED est un atout.", StrengthPreferred},
+		//cues match whole words only
+		{"The mustard supplier holds ISO 22000.", StrengthInformational},
+	}
+
+	for _, tt := range tests {
+		if got := defaultMatchSettings.classify(tt.sentence); got != tt.want {
+			t.Errorf("classify(%q) = %s, want %s", tt.sentence, got, tt.want)
+		}
+	}
+}
+
+func TestStrengthCuesReplaceDefaults(t *testing.T) {
+	settings, err := compileMatchSettings(&KPIDefinitionFile{
+		StrengthCues: &StrengthCues{Mandatory: []string{"is a condition of award"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		sentence string
+		want     Strength
+	}{
+		{"ISO 14001 is a condition of award.", StrengthMandatory},
+		//"shall" is no longer a mandatory cue, the other lists keep their defaults
+		{"The Contractor shall hold ISO 14001.", StrengthInformational},
+		{"ISO 14001 is not required.", StrengthNegated},
+		{"ISO 14001 is preferred.", StrengthPreferred},
+	}
+	for _, tt := range tests {
+		if got := settings.classify(tt.sentence); got != tt.want {
+			t.Errorf("classify(%q) = %s, want %s", tt.sentence, got, tt.want)
+		}
+	}
+}
+
+func TestStrengthCuesRejectEmptyPhrases(t *testing.T) {
+	_, err := compileMatchSettings(&KPIDefinitionFile{
+		StrengthCues: &StrengthCues{Negated: []string{"not required", " "}},
+	})
+	if err == nil {
+		t.Error("expected an error for an empty cue phrase")
+	}
+}
+
+func TestMatchSegmentReportsStrongestSentence(t *testing.T) {
+	kpiDefs := compileKPIs(t, `{"version": 2, "kpis": [
+		{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["\\bISO 14001\\b"]}
+	]}`)
+	results := CreatePkgResultForRFPPackage(kpiDefs)
+
+	MatchSegment(TextSegment{Text: "The City adopted ISO 14001 in 2019.", Type: SegmentParagraph}, results)
+	MatchSegment(TextSegment{Text: "The Contractor shall maintain ISO 14001 certification.", Type: SegmentParagraph}, results)
+	MatchSegment(TextSegment{Text: "ISO 14001 reports are not required monthly.", Type: SegmentParagraph}, results)
+
+	if results[0].Strength != StrengthMandatory {
+		t.Errorf("strength = %s, want %s", results[0].Strength, StrengthMandatory)
+	}
+	if results[0].Occurrences != 3 {
+		t.Errorf("occurrences = %d, want 3", results[0].Occurrences)
+	}
+}
@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "ERROR"
+	SeverityWarning Severity = "WARNING"
+)
+
+// ValidationIssue is a single problem found in a KPI definition. Field locates it within the
+// definition, e.g. "regexps[2]" or "examples.negative[0]". Index is -1 for file-level settings.
+type ValidationIssue struct {
+	Severity Severity
+	Index    int
+	KPIID    string
+	KPIName  string
+	Field    string
+	Message  string
+}
+
+func (i ValidationIssue) Error() string {
+	if i.Index < 0 {
+		return fmt.Sprintf("%s: %s", i.Field, i.Message)
+	}
+	return fmt.Sprintf("KPI definition %d (%s %q) %s: %s", i.Index, i.KPIID, i.KPIName, i.Field, i.Message)
+}
+
+// KPIExamples are sentences a definition must (Positive) and must not (Negative) match
+type KPIExamples struct {
+	Positive []string `json:"positive,omitempty"`
+	Negative []string `json:"negative,omitempty"`
+}
+
+// minPatternLength is the shortest match a pattern may have before it is flagged as overly broad
+const minPatternLength = 3
+
+// genericProbeText is RFP boilerplate that should not trigger any KPI. A pattern matching
+// several of these sentences is flagged as overly broad.
+var genericProbeText = []string{
+	"The Proponent shall submit its proposal no later than the closing date.",
+	"All prices must be quoted in Canadian dollars, exclusive of applicable taxes.",
+	"The Owner reserves the right to reject any or all proposals.",
+	"Please describe your company's experience providing similar services.",
+	"The contract term is three years with two optional one-year extensions.",
+	"Questions regarding this Request for Proposal should be directed to the contact below.",
+	"Section 4 describes the evaluation process and scoring.",
+	"Appendix A contains the pricing form.",
+}
+
+const broadProbeThreshold = 2
+
+// ValidateKPIDefinitions reports every problem in kpiDefs rather than stopping at the first one.
+// Definitions with errors must not be used; warnings flag patterns that are likely too broad.
+func ValidateKPIDefinitions(defFile *KPIDefinitionFile) []ValidationIssue {
+	//validate the patterns as they will be matched, leaving defFile unexpanded
+	expanded := *defFile
+	expanded.KPIs = append([]KPIDefinition(nil), defFile.KPIs...)
+	issues := expandKPIMacros(&expanded)
+	defFile = &expanded
+
+	kpiDefs := defFile.KPIs
+	issues = append(issues, checkKPIDefinitions(kpiDefs)...)
+
+	settings, err := compileMatchSettings(defFile)
+	if err != nil {
+		issues = append(issues, ValidationIssue{
+			Severity: SeverityError,
+			Index:    -1,
+			Field:    "settings",
+			Message:  err.Error(),
+		})
+		settings = defaultMatchSettings
+	}
+
+	names := make(map[string]int, len(kpiDefs))
+	for i, def := range kpiDefs {
+		issue := func(severity Severity, field, format string, args ...any) {
+			issues = append(issues, ValidationIssue{
+				Severity: severity,
+				Index:    i,
+				KPIID:    def.ID,
+				KPIName:  def.Name,
+				Field:    field,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		normName := strings.ToLower(strings.TrimSpace(def.Name))
+		if first, ok := names[normName]; ok && normName != "" {
+			issue(SeverityError, "name", "duplicate name, also used by KPI definition %d", first)
+		} else {
+			names[normName] = i
+		}
+
+		switch {
+		case def.Rule != nil && len(def.RegexStrs) > 0:
+			issue(SeverityError, "rule", "set either regexps or rule, not both")
+		case def.Rule != nil:
+			if _, err := compileRule(*def.Rule, "rule"); err != nil {
+				issue(SeverityError, "rule", "%v", err)
+			}
+		case len(def.RegexStrs) == 0 && def.Fuzzy == nil:
+			issue(SeverityError, "regexps", "no patterns defined")
+		}
+
+		if def.Fuzzy != nil {
+			if _, err := compileFuzzyRule(*def.Fuzzy, "fuzzy"); err != nil {
+				issue(SeverityError, "fuzzy", "%v", err)
+			}
+		}
+
+		if _, err := compilePatterns(def.Exclude, "exclude"); err != nil {
+			issue(SeverityError, "exclude", "%v", err)
+		}
+
+		if def.Sections != nil {
+			if _, err := compilePatterns(def.Sections.Include, "sections.include"); err != nil {
+				issue(SeverityError, "sections", "%v", err)
+			}
+			if _, err := compilePatterns(def.Sections.Exclude, "sections.exclude"); err != nil {
+				issue(SeverityError, "sections", "%v", err)
+			}
+		}
+
+		for lang, variant := range def.Languages {
+			prefix := "languages." + lang + "."
+			if !isSupportedLanguage(lang) {
+				issue(SeverityError, "languages."+lang, "unsupported language, expected one of %v", SupportedLanguages())
+				continue
+			}
+			if len(variant.RegexStrs) == 0 && variant.Rule == nil && variant.Fuzzy == nil {
+				issue(SeverityError, "languages."+lang, "no patterns defined")
+				continue
+			}
+			if _, _, err := compileMatcher(variant.RegexStrs, variant.Rule, variant.Fuzzy, prefix); err != nil {
+				issue(SeverityError, "languages."+lang, "%v", err)
+			}
+		}
+
+		for j, pattern := range def.RegexStrs {
+			field := fmt.Sprintf("regexps[%d]", j)
+
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				issue(SeverityError, field, "invalid pattern %q: %v", pattern, err)
+				continue
+			}
+
+			if re.MatchString("") {
+				issue(SeverityError, field, "pattern %q matches the empty string", pattern)
+				continue
+			}
+
+			if n := minMatchLength(pattern); n < minPatternLength {
+				issue(SeverityWarning, field, "pattern %q can match as few as %d characters", pattern, n)
+			}
+
+			probeHits := 0
+			for _, probe := range genericProbeText {
+				if re.MatchString(probe) {
+					probeHits++
+				}
+			}
+			if probeHits >= broadProbeThreshold {
+				issue(SeverityWarning, field, "pattern %q matches %d of %d generic RFP sentences", pattern, probeHits, len(genericProbeText))
+			}
+		}
+
+		if def.Examples == nil {
+			continue
+		}
+
+		//examples can only be run against a definition that compiles
+		testDef := def
+		if err := testDef.compile(); err != nil {
+			continue
+		}
+		testDef.settings = settings
+		//examples have no document structure, so section filters don't apply
+		testDef.includeSections, testDef.excludeSections = nil, nil
+		for j, example := range def.Examples.Positive {
+			if !matchesExample(&testDef, example) {
+				issue(SeverityError, fmt.Sprintf("examples.positive[%d]", j), "expected a match: %q", example)
+			}
+		}
+		for j, example := range def.Examples.Negative {
+			if matchesExample(&testDef, example) {
+				issue(SeverityError, fmt.Sprintf("examples.negative[%d]", j), "expected no match: %q", example)
+			}
+		}
+	}
+
+	sort.SliceStable(issues, func(a, b int) bool {
+		return issues[a].Index < issues[b].Index
+	})
+	return issues
+}
+
+// checkKPIDefinitions covers the structural problems that make definitions unusable
+func checkKPIDefinitions(kpiDefs []KPIDefinition) []ValidationIssue {
+	var issues []ValidationIssue
+
+	ids := make(map[string]int, len(kpiDefs))
+	for i, def := range kpiDefs {
+		issue := func(field, format string, args ...any) {
+			issues = append(issues, ValidationIssue{
+				Severity: SeverityError,
+				Index:    i,
+				KPIID:    def.ID,
+				KPIName:  def.Name,
+				Field:    field,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		if !kpiIDRule.MatchString(def.ID) {
+			issue("id", "invalid id %q - use lowercase letters, digits, '-' and '_'", def.ID)
+		} else if first, ok := ids[def.ID]; ok {
+			issue("id", "duplicate id, also used by KPI definition %d", first)
+		} else {
+			ids[def.ID] = i
+		}
+
+		if strings.TrimSpace(def.Name) == "" {
+			issue("name", "name is required")
+		}
+
+		if def.Weight != nil && *def.Weight < 0 {
+			issue("weight", "must not be negative")
+		}
+
+		if def.EffectiveFrom != "" {
+			if _, err := time.Parse(EffectiveFromLayout, def.EffectiveFrom); err != nil {
+				issue("effectiveFrom", "must be YYYY-MM-DD: %v", err)
+			}
+		}
+	}
+
+	return issues
+}
+
+// matchesExample reports whether example matches def in any of its languages, since examples are
+// too short for language detection
+func matchesExample(def *KPIDefinition, example string) bool {
+	languages := []string{""}
+	for lang := range def.Languages {
+		languages = append(languages, lang)
+	}
+
+	for _, lang := range languages {
+		kpiResults := CreatePkgResultForRFPPackage([]KPIDefinition{*def})
+		MatchSegment(TextSegment{Text: example, Type: SegmentParagraph, Language: lang}, kpiResults)
+		if kpiResults[0].Found {
+			return true
+		}
+	}
+	return false
+}
+
+// minMatchLength returns the fewest characters pattern can match
+func minMatchLength(pattern string) int {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0
+	}
+	return syntaxMinLength(re.Simplify())
+}
+
+func syntaxMinLength(re *syntax.Regexp) int {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return len(re.Rune)
+	case syntax.OpCharClass, syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return 1
+	case syntax.OpCapture, syntax.OpPlus:
+		return syntaxMinLength(re.Sub[0])
+	case syntax.OpRepeat:
+		return re.Min * syntaxMinLength(re.Sub[0])
+	case syntax.OpConcat:
+		total := 0
+		for _, sub := range re.Sub {
+			total += syntaxMinLength(sub)
+		}
+		return total
+	case syntax.OpAlternate:
+		shortest := -1
+		for _, sub := range re.Sub {
+			if n := syntaxMinLength(sub); shortest == -1 || n < shortest {
+				shortest = n
+			}
+		}
+		return max(shortest, 0)
+	}
+	//empty matches, anchors, word boundaries, star and quest
+	return 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/JA50N14/rfp_parser/server"
+)
+
+// runServe runs the parser as a service with the HTTP API and SERVE_SCHEDULE until it receives
+// SIGINT or SIGTERM. It returns the process exit code: 0 after a clean shutdown, 1 on errors, 2 on
+// bad usage.
+func runServe(ctx context.Context, args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	addr := fs.String("addr", "", "listen address, overriding SERVE_ADDR (default :8080)")
+	schedule := fs.Bool("schedule", true, "start runs on SERVE_SCHEDULE; false for API-triggered runs only")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary serve [-addr host:port] [-schedule=false]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+
+	cfg, err := loadConfig(logger)
+	if err != nil {
+		logger.Error("Failed to start server", "error", err)
+		return 1
+	}
+	if *addr != "" {
+		cfg.ServeAddr = *addr
+	}
+	if !*schedule {
+		cfg.ServeSchedule = nil
+	}
+	if cfg.ServeAPIKey == "" {
+		cfg.Logger.Warn("SERVE_API_KEY not set, the API accepts unauthenticated requests")
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.New(ctx, cfg).ListenAndServe(); err != nil {
+		cfg.Logger.Error("Server stopped", "error", err)
+		return 1
+	}
+	cfg.Logger.Info("Server stopped")
+	return 0
+}
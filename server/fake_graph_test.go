@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// graphPrefix is the path of the fake Graph API, as in https://graph.microsoft.com/v1.0
+const graphPrefix = "/v1.0"
+
+// fakeGraph is a Graph API and managed identity endpoint served by httptest. Handlers are
+// registered per test; every Graph request is recorded.
+type fakeGraph struct {
+	*httptest.Server
+	mux *http.ServeMux
+
+	mu       sync.Mutex
+	requests []string //"METHOD /path", without graphPrefix
+}
+
+func newFakeGraph(t *testing.T) *fakeGraph {
+	t.Helper()
+
+	g := &fakeGraph{mux: http.NewServeMux()}
+	g.mux.HandleFunc("GET /msi/token", func(w http.ResponseWriter, r *http.Request) {
+		expiresOn := time.Now().Add(time.Hour).Unix()
+		writeJSON(w, http.StatusOK, map[string]string{
+			"access_token": "fake-graph-token",
+			"token_type":   "Bearer",
+			"expires_on":   strconv.FormatInt(expiresOn, 10),
+		})
+	})
+	g.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/msi/token" {
+			g.mu.Lock()
+			g.requests = append(g.requests, r.Method+" "+r.URL.Path[len(graphPrefix):])
+			g.mu.Unlock()
+		}
+		g.mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(g.Close)
+	return g
+}
+
+// handle registers a Graph handler, pattern as for http.ServeMux without graphPrefix, e.g. "GET /subscriptions"
+func (g *fakeGraph) handle(method, path string, handler http.HandlerFunc) {
+	g.mux.HandleFunc(method+" "+graphPrefix+path, handler)
+}
+
+// count returns how many requests were made for "METHOD /path"
+func (g *fakeGraph) count(request string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	n := 0
+	for _, r := range g.requests {
+		if r == request {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestConfig loads a configuration from the environment that uses g for Graph and its managed
+// identity, with env setting or overriding variables
+func newTestConfig(t *testing.T, g *fakeGraph, env map[string]string) *config.ApiConfig {
+	t.Helper()
+
+	vars := map[string]string{
+		"CONFIG_FILE":          "",
+		"SMARTSHEET_TOKEN":     "smartsheet-token",
+		"SMARTSHEET_URL":       g.URL + "/smartsheet/rows",
+		"SMARTSHEET_COLUMNS":   "RequirementStrength:1001;KPIScore:1002;CategoryScore:1003",
+		"GRAPH_SITE_ID":        "site",
+		"GRAPH_LIBRARY_NAME":   "Documents",
+		"GRAPH_DRIVE_ID":       "drive",
+		"GRAPH_BASE_URL":       g.URL + graphPrefix,
+		"GRAPH_AUTH_MODE":      config.AuthModeManagedIdentity,
+		"IDENTITY_ENDPOINT":    g.URL + "/msi/token",
+		"IDENTITY_HEADER":      "identity-header",
+		"KPI_DEFINITIONS_PATH": filepath.Join("..", "parser", "kpiDefinitions.json"),
+		"KPI_STATE_PATH":       filepath.Join(t.TempDir(), "kpiState.json"),
+		"MAX_RETRIES":          "0",
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+	for k, v := range vars {
+		t.Setenv(k, v)
+	}
+
+	cfg, err := config.NewApiConfig(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// newTestServer returns a server whose runs and watchers stop when the test ends
+func newTestServer(t *testing.T, cfg *config.ApiConfig) *Server {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := New(ctx, cfg)
+	t.Cleanup(func() {
+		cancel()
+		s.runsStopped.Wait()
+	})
+	return s
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// decodeResponse decodes a JSON response body into v
+func decodeResponse(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+}
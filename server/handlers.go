@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// maxRequestBody bounds request bodies, which are small JSON objects
+const maxRequestBody = 64 << 10
+
+// Handler returns the HTTP API:
+//
+//	GET  /healthz              liveness, the active run and the next scheduled run
+//	POST /runs                 start a run
+//	GET  /runs                 the active and recent runs, newest first
+//	GET  /runs/{id}            one run, with its summary once finished
+//	POST /packages/reprocess   reset the ProcessStatus of the selected packages and process them
+//	POST /webhooks/graph       Graph change notifications, with WEBHOOK_URL
+//
+// Every endpoint but /healthz and the webhook requires "Authorization: Bearer <SERVE_API_KEY>" when
+// a key is configured. The webhook checks the notifications' clientState instead.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealth)
+	mux.Handle("POST /runs", s.authorized(s.handleStartRun))
+	mux.Handle("GET /runs", s.authorized(s.handleListRuns))
+	mux.Handle("GET /runs/{id}", s.authorized(s.handleGetRun))
+	mux.Handle("POST /packages/reprocess", s.authorized(s.handleReprocess))
+	if s.watcher != nil {
+		mux.HandleFunc("POST "+webhookPath, s.handleWebhook)
+	}
+	return mux
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.ServeAPIKey != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.ServeAPIKey)) != 1 {
+				writeError(w, http.StatusUnauthorized, "missing or invalid API key")
+				return
+			}
+		}
+		next(w, r)
+	})
+}
+
+type healthResponse struct {
+	Status           string     `json:"status"`
+	ActiveRun        string     `json:"activeRun,omitempty"`
+	NextScheduledRun *time.Time `json:"nextScheduledRun,omitempty"`
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp := healthResponse{Status: "ok"}
+
+	s.mu.Lock()
+	if s.active != nil {
+		resp.ActiveRun = s.active.ID
+	}
+	if !s.nextRunAt.IsZero() {
+		next := s.nextRunAt.UTC()
+		resp.NextScheduledRun = &next
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// runRequest is the body of POST /runs and POST /packages/reprocess. Levels and Package select
+// packages as the command line filter flags do.
+type runRequest struct {
+	Mode    string            `json:"mode"` //POST /runs only
+	DryRun  bool              `json:"dryRun"`
+	Levels  map[string]string `json:"levels"`
+	Package string            `json:"package"`
+	Force   bool              `json:"force"` //POST /packages/reprocess only
+}
+
+func (s *Server) handleStartRun(w http.ResponseWriter, r *http.Request) {
+	var body runRequest
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Mode != "" && body.Mode != config.RunModeProcess && body.Mode != config.RunModeBackfill {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("mode must be %q or %q", config.RunModeProcess, config.RunModeBackfill))
+		return
+	}
+
+	s.start(w, RunRequest{
+		Trigger: TriggerAPI,
+		Mode:    body.Mode,
+		DryRun:  body.DryRun,
+		Filter:  config.PackageFilter{Levels: body.Levels, Package: body.Package},
+	})
+}
+
+func (s *Server) handleReprocess(w http.ResponseWriter, r *http.Request) {
+	var body runRequest
+	if err := decodeBody(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	filter := config.PackageFilter{Levels: body.Levels, Package: body.Package}
+	if filter.IsEmpty() {
+		writeError(w, http.StatusBadRequest, "select the packages to reprocess with package and/or levels")
+		return
+	}
+
+	s.start(w, RunRequest{
+		Trigger:   TriggerAPI,
+		DryRun:    body.DryRun,
+		Filter:    filter,
+		Reprocess: true,
+		Force:     body.Force,
+	})
+}
+
+func (s *Server) start(w http.ResponseWriter, req RunRequest) {
+	run, err := s.Start(req)
+	if errors.Is(err, ErrRunActive) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	w.Header().Set("Location", "/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, struct {
+		Runs []Run `json:"runs"`
+	}{Runs: s.Runs()})
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, ok := s.Run(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "run not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+// decodeBody decodes an optional JSON body, rejecting unknown fields
+func decodeBody(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{Error: message})
+}
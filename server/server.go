@@ -0,0 +1,320 @@
+// Package server runs the parser as a long-running service: runs are started by a cron schedule,
+// through an HTTP API or by changes in the document library, one at a time.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/walk"
+	"github.com/google/uuid"
+)
+
+// What started a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerAPI      = "api"
+	TriggerWebhook  = "webhook" //a package changed in the library
+)
+
+// Run statuses
+const (
+	RunStatusRunning   = "running"
+	RunStatusSucceeded = "succeeded"
+	RunStatusFailed    = "failed"
+)
+
+// maxHistory is the number of finished runs kept for the API
+const maxHistory = 50
+
+const shutdownTimeout = 10 * time.Second
+
+// ErrRunActive is returned when a run is requested while another is active
+var ErrRunActive = errors.New("a run is already active")
+
+// RunRequest describes a run to start
+type RunRequest struct {
+	Trigger   string
+	Mode      string //config.RunModeProcess or config.RunModeBackfill, the configured mode when empty
+	DryRun    bool
+	Filter    config.PackageFilter
+	Reprocess bool //reset the ProcessStatus of the filtered packages before processing them
+	Force     bool //with Reprocess, also reset InProgress packages
+}
+
+// Run is a run started by the server. Fields are only changed under the server's lock.
+type Run struct {
+	ID         string            `json:"id"`
+	Trigger    string            `json:"trigger"`
+	Mode       string            `json:"mode"`
+	DryRun     bool              `json:"dryRun,omitempty"`
+	Levels     map[string]string `json:"levels,omitempty"`
+	Package    string            `json:"package,omitempty"`
+	Reprocess  bool              `json:"reprocess,omitempty"`
+	Reset      []string          `json:"reset,omitempty"` //packages whose ProcessStatus was reset, as path/name
+	Status     string            `json:"status"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Summary    *walk.RunSummary  `json:"summary,omitempty"` //set when the run finishes
+}
+
+// Server starts runs and keeps their history. cfg is never changed after New; each run gets its
+// own copy with the run's mode, dry run setting and filter.
+type Server struct {
+	cfg    *config.ApiConfig
+	ctx    context.Context //cancels active runs on shutdown
+	cancel context.CancelFunc
+
+	watcher *changeWatcher //nil without WEBHOOK_URL
+
+	mu          sync.Mutex
+	active      *Run
+	history     []*Run //finished runs, oldest first
+	nextRunAt   time.Time
+	runsStopped sync.WaitGroup
+}
+
+// New returns a Server whose runs, schedule and watchers stop when ctx is done or serving the API
+// fails
+func New(ctx context.Context, cfg *config.ApiConfig) *Server {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Server{
+		cfg:    cfg,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if cfg.WebhookURL != "" {
+		s.watcher = newChangeWatcher(s)
+	}
+	return s
+}
+
+// Start starts a run in the background. It returns ErrRunActive while another run is active.
+func (s *Server) Start(req RunRequest) (Run, error) {
+	mode := req.Mode
+	if mode == "" {
+		mode = s.cfg.RunMode
+	}
+	if req.Reprocess {
+		mode = config.RunModeProcess
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active != nil {
+		return Run{}, fmt.Errorf("%w: %s", ErrRunActive, s.active.ID)
+	}
+	if s.ctx.Err() != nil {
+		return Run{}, errors.New("server is shutting down")
+	}
+
+	run := &Run{
+		ID:        uuid.NewString(),
+		Trigger:   req.Trigger,
+		Mode:      mode,
+		DryRun:    req.DryRun || s.cfg.DryRun,
+		Levels:    req.Filter.Levels,
+		Package:   req.Filter.Package,
+		Reprocess: req.Reprocess,
+		Status:    RunStatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+	s.active = run
+
+	s.runsStopped.Add(1)
+	go func() {
+		defer s.runsStopped.Done()
+		s.execute(run, req)
+	}()
+
+	return *run, nil
+}
+
+func (s *Server) execute(run *Run, req RunRequest) {
+	logger := s.cfg.Logger.With("Server Run ID", run.ID)
+	logger.Info("Run started", "trigger", run.Trigger, "mode", run.Mode, "dryRun", run.DryRun, "levels", run.Levels, "package", run.Package)
+
+	cfg := s.cfg.ForRun(run.Mode, run.DryRun, req.Filter)
+
+	var reset []string
+	var summary *walk.RunSummary
+	err := func() error {
+		if req.Reprocess {
+			pkgs, err := walk.ListPackages(s.ctx, cfg)
+			if err != nil {
+				//nothing is reset from a partial listing
+				return fmt.Errorf("listing packages to reprocess: %w", err)
+			}
+			resetPkgs, err := walk.ResetPackages(s.ctx, cfg, pkgs, req.Force)
+			for _, pkg := range resetPkgs {
+				reset = append(reset, pkg.Path.String()+"/"+pkg.Name)
+			}
+			if err != nil {
+				return fmt.Errorf("resetting packages: %w", err)
+			}
+		}
+
+		var err error
+		summary, err = walk.WalkDocLibrary(s.ctx, cfg)
+		if summary != nil {
+			logger.Info("Run summary", "summary", summary)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to walk document library: %w", err)
+		}
+		return summary.CheckThresholds(cfg)
+	}()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	finishedAt := time.Now().UTC()
+	run.FinishedAt = &finishedAt
+	run.Reset = reset
+	run.Summary = summary
+	run.Status = RunStatusSucceeded
+	if err != nil {
+		run.Status = RunStatusFailed
+		run.Error = err.Error()
+		logger.Error("Run failed", "error", err)
+	} else {
+		logger.Info("Run finished")
+	}
+
+	s.active = nil
+	s.history = append(s.history, run)
+	if len(s.history) > maxHistory {
+		s.history = slices.Delete(s.history, 0, len(s.history)-maxHistory)
+	}
+}
+
+// Runs returns the active run, if any, and the finished runs, newest first
+func (s *Server) Runs() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	runs := make([]Run, 0, len(s.history)+1)
+	if s.active != nil {
+		runs = append(runs, *s.active)
+	}
+	for i := len(s.history) - 1; i >= 0; i-- {
+		runs = append(runs, *s.history[i])
+	}
+	return runs
+}
+
+// Run returns the run with the given ID
+func (s *Server) Run(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active != nil && s.active.ID == id {
+		return *s.active, true
+	}
+	for _, run := range s.history {
+		if run.ID == id {
+			return *run, true
+		}
+	}
+	return Run{}, false
+}
+
+// schedule starts a run at each activation of the configured schedule until ctx is done
+func (s *Server) schedule(ctx context.Context) {
+	schedule := s.cfg.ServeSchedule
+	for {
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			s.cfg.Logger.Warn("Schedule never activates", "schedule", schedule.String())
+			return
+		}
+		s.mu.Lock()
+		s.nextRunAt = next
+		s.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := s.Start(RunRequest{Trigger: TriggerSchedule}); err != nil {
+			s.cfg.Logger.Warn("Scheduled run skipped", "error", err)
+		}
+	}
+}
+
+// ListenAndServe serves the API on cfg.ServeAddr, runs the schedule and, with WEBHOOK_URL, watches
+// the library for changes until the server's context is done or serving fails. Active runs are
+// cancelled and awaited, and the subscription deleted, before it returns.
+func (s *Server) ListenAndServe() error {
+	//listening before subscribing, Graph calls the webhook to validate a new subscription
+	listener, err := net.Listen("tcp", s.cfg.ServeAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.cfg.ServeAddr, err)
+	}
+	return s.serve(listener)
+}
+
+// serve is ListenAndServe on an open listener
+func (s *Server) serve(listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	var err error
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- httpServer.Serve(listener)
+	}()
+	s.cfg.Logger.Info("Server listening", "addr", listener.Addr().String())
+
+	if s.cfg.ServeSchedule != nil {
+		go s.schedule(s.ctx)
+		s.cfg.Logger.Info("Schedule started", "schedule", s.cfg.ServeSchedule.String())
+	}
+
+	var watchers sync.WaitGroup
+	if s.watcher != nil {
+		watchers.Add(2)
+		go func() {
+			defer watchers.Done()
+			s.watcher.watch(s.ctx)
+		}()
+		go func() {
+			defer watchers.Done()
+			s.watcher.manageSubscription(s.ctx)
+		}()
+	}
+
+	select {
+	case err = <-serveErr:
+		err = fmt.Errorf("serving API: %w", err)
+		//nothing else cancels the runs and watchers when serving fails
+		s.cancel()
+	case <-s.ctx.Done():
+		s.cfg.Logger.Info("Server shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if shutdownErr := httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = fmt.Errorf("shutting down API: %w", shutdownErr)
+		}
+	}
+
+	//runs and watchers stop once the context is done
+	watchers.Wait()
+	s.runsStopped.Wait()
+	return err
+}
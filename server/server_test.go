@@ -0,0 +1,248 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// blockGraph makes every Graph request wait until the returned release func is called, then fail
+// with 404, so runs stay active until then
+func blockGraph(g *fakeGraph) (release func()) {
+	released := make(chan struct{})
+	g.mux.HandleFunc(graphPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-released:
+		case <-r.Context().Done():
+			return
+		}
+		writeError(w, http.StatusNotFound, "itemNotFound")
+	})
+
+	var once bool
+	return func() {
+		if !once {
+			once = true
+			close(released)
+		}
+	}
+}
+
+func TestStartRejectsConcurrentRuns(t *testing.T) {
+	g := newFakeGraph(t)
+	release := blockGraph(g)
+	defer release()
+	s := newTestServer(t, newTestConfig(t, g, nil))
+
+	first, err := s.Start(RunRequest{Trigger: TriggerAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.Start(RunRequest{Trigger: TriggerSchedule})
+	if !errors.Is(err, ErrRunActive) {
+		t.Fatalf("second Start error = %v, want ErrRunActive", err)
+	}
+	if !strings.Contains(err.Error(), first.ID) {
+		t.Errorf("error %q does not name the active run %s", err, first.ID)
+	}
+
+	//the API answers 409 Conflict
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/runs", strings.NewReader(`{"mode": "backfill"}`)))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST /runs = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	release()
+	waitFor(t, "the run to finish", func() bool {
+		run, _ := s.Run(first.ID)
+		return run.Status != RunStatusRunning
+	})
+
+	//another run can start once the first has finished
+	if _, err := s.Start(RunRequest{Trigger: TriggerAPI}); err != nil {
+		t.Errorf("Start after the run finished: %v", err)
+	}
+}
+
+func TestRunsDoNotChangeTheSharedConfig(t *testing.T) {
+	g := newFakeGraph(t)
+	release := blockGraph(g)
+	defer release()
+	cfg := newTestConfig(t, g, nil)
+	s := newTestServer(t, cfg)
+
+	run, err := s.Start(RunRequest{
+		Trigger: TriggerAPI,
+		Mode:    config.RunModeBackfill,
+		DryRun:  true,
+		Filter:  config.PackageFilter{Package: "City of*"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	waitFor(t, "the run to finish", func() bool {
+		run, _ := s.Run(run.ID)
+		return run.Status != RunStatusRunning
+	})
+
+	if cfg.RunMode != config.RunModeProcess || cfg.DryRun || !cfg.Filter.IsEmpty() {
+		t.Errorf("shared config changed by a run: mode %s, dry run %t, filter %+v", cfg.RunMode, cfg.DryRun, cfg.Filter)
+	}
+
+	//runs that do not set them use the configured values
+	next, err := s.Start(RunRequest{Trigger: TriggerSchedule})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Mode != config.RunModeProcess || next.DryRun {
+		t.Errorf("run mode %s, dry run %t, want the configured process run", next.Mode, next.DryRun)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	g := newFakeGraph(t)
+	release := blockGraph(g)
+	release()
+	s := newTestServer(t, newTestConfig(t, g, map[string]string{"SERVE_API_KEY": "serve-api-key"}))
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		run, err := s.Start(RunRequest{Trigger: TriggerAPI, Filter: config.PackageFilter{Package: fmt.Sprint("package ", i)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the run to finish", func() bool {
+			run, _ := s.Run(run.ID)
+			return run.Status != RunStatusRunning
+		})
+		ids = append(ids, run.ID)
+	}
+
+	api := httptest.NewServer(s.Handler())
+	defer api.Close()
+
+	resp, err := http.Get(api.URL + "/runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /runs without the API key = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	get := func(path string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, api.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer serve-api-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	var list struct {
+		Runs []Run `json:"runs"`
+	}
+	decodeResponse(t, get("/runs"), &list)
+	if len(list.Runs) != 3 {
+		t.Fatalf("got %d runs, want 3", len(list.Runs))
+	}
+	for i, run := range list.Runs {
+		//newest first
+		if want := ids[len(ids)-1-i]; run.ID != want {
+			t.Errorf("runs[%d] = %s, want %s", i, run.ID, want)
+		}
+		if run.Status != RunStatusFailed || run.Error == "" || run.FinishedAt == nil {
+			t.Errorf("runs[%d] = %+v, want a finished failed run with its error", i, run)
+		}
+	}
+
+	var one Run
+	decodeResponse(t, get("/runs/"+ids[0]), &one)
+	if one.ID != ids[0] || one.Package != "package 0" {
+		t.Errorf("GET /runs/{id} = %+v, want run %s for package 0", one, ids[0])
+	}
+
+	resp = get("/runs/unknown")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /runs/unknown = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestRunHistoryIsBounded(t *testing.T) {
+	g := newFakeGraph(t)
+	release := blockGraph(g)
+	release()
+	s := newTestServer(t, newTestConfig(t, g, nil))
+
+	for i := 0; i < maxHistory+2; i++ {
+		run, err := s.Start(RunRequest{Trigger: TriggerAPI})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "the run to finish", func() bool {
+			run, _ := s.Run(run.ID)
+			return run.Status != RunStatusRunning
+		})
+	}
+
+	if got := len(s.Runs()); got != maxHistory {
+		t.Errorf("kept %d runs, want %d", got, maxHistory)
+	}
+}
+
+// failingListener fails every Accept, so serving stops at once
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("accept failed")
+}
+
+func TestServeErrorStopsRunsAndWatchers(t *testing.T) {
+	g := newFakeGraph(t)
+	release := blockGraph(g)
+	defer release()
+	s := newTestServer(t, newTestConfig(t, g, webhookEnv))
+
+	run, err := s.Start(RunRequest{Trigger: TriggerAPI})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.serve(failingListener{listener})
+	}()
+
+	select {
+	case err := <-served:
+		if err == nil || !strings.Contains(err.Error(), "accept failed") {
+			t.Errorf("serve error = %v, want the accept error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not return after the listener failed")
+	}
+
+	if got, _ := s.Run(run.ID); got.Status == RunStatusRunning {
+		t.Errorf("run status = %s after serving failed, want it cancelled", got.Status)
+	}
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/graph"
+)
+
+// webhookPath receives Graph change notifications. WEBHOOK_URL must point to it.
+const webhookPath = "/webhooks/graph"
+
+// Subscription and retry timings, variables so tests can shorten them
+var (
+	subscriptionLifetime      = 72 * time.Hour
+	subscriptionRenewBefore   = 24 * time.Hour
+	subscriptionRetryInterval = 5 * time.Minute
+	//how long a package whose changes have settled waits for the active run to finish
+	busyRetryInterval = time.Minute
+)
+
+// changeWatcher subscribes to changes in the document library and starts a run for each changed
+// package once it has had no changes for cfg.WebhookDebounce, e.g. when an upload has finished
+type changeWatcher struct {
+	s      *Server
+	notify chan struct{} //signalled by notifications, drained by watch
+
+	deltaLink string //owned by watch
+
+	mu      sync.Mutex
+	pending map[string]*pendingPackage //by package path
+	stopped bool
+}
+
+// pendingPackage is a changed package waiting for its changes to settle
+type pendingPackage struct {
+	filter config.PackageFilter
+	due    time.Time
+}
+
+func newChangeWatcher(s *Server) *changeWatcher {
+	return &changeWatcher{
+		s:       s,
+		notify:  make(chan struct{}, 1),
+		pending: make(map[string]*pendingPackage),
+	}
+}
+
+// handleWebhook answers Graph's validation request when a subscription is created, and queues a
+// check for changes on each notification with the configured clientState
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("validationToken"); token != "" {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		io.WriteString(w, token)
+		return
+	}
+
+	var body struct {
+		Value []struct {
+			SubscriptionID string `json:"subscriptionId"`
+			ClientState    string `json:"clientState"`
+		} `json:"value"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxRequestBody)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid notification")
+		return
+	}
+
+	valid := false
+	for _, n := range body.Value {
+		if subtle.ConstantTimeCompare([]byte(n.ClientState), []byte(s.cfg.WebhookClientState)) == 1 {
+			valid = true
+		}
+	}
+	if !valid {
+		s.cfg.Logger.Warn("Change notification with an invalid clientState ignored", "remote", r.RemoteAddr)
+		writeError(w, http.StatusForbidden, "invalid clientState")
+		return
+	}
+
+	//Graph expects a response within seconds, the changes are read in the background
+	select {
+	case s.watcher.notify <- struct{}{}:
+	default:
+		//a check is already queued
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// watch reads the library's changes after each notification until ctx is done
+func (c *changeWatcher) watch(ctx context.Context) {
+	defer c.stop()
+
+	//changes are read from the time the watcher starts
+	for c.deltaLink == "" {
+		_, deltaLink, err := graph.GetDriveChanges("", ctx, c.s.cfg)
+		if err == nil {
+			c.deltaLink = deltaLink
+			break
+		}
+		c.s.cfg.Logger.Error("Failed to start tracking library changes", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(subscriptionRetryInterval):
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.notify:
+			c.readChanges(ctx)
+		}
+	}
+}
+
+// readChanges debounces the packages changed since the last notification
+func (c *changeWatcher) readChanges(ctx context.Context) {
+	logger := c.s.cfg.Logger
+
+	changes, deltaLink, err := graph.GetDriveChanges(c.deltaLink, ctx, c.s.cfg)
+	if err != nil {
+		var apiErr *graph.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusGone {
+			//the delta token expired, changes until now are left to scheduled runs
+			logger.Warn("Library change tracking restarted, earlier changes are left to scheduled runs")
+			if _, deltaLink, err = graph.GetDriveChanges("", ctx, c.s.cfg); err == nil {
+				c.deltaLink = deltaLink
+			}
+			return
+		}
+		logger.Error("Failed to read library changes", "error", err)
+		return
+	}
+	c.deltaLink = deltaLink
+
+	//files are resolved through their folder, so a burst of uploads costs one lookup per folder
+	folders := make(map[string]bool)
+	for _, change := range changes {
+		switch {
+		case change.Deleted != nil:
+		case change.Folder != nil:
+			folders[change.ID] = true
+		case change.ParentReference != nil && change.ParentReference.ID != "":
+			folders[change.ParentReference.ID] = true
+		}
+	}
+
+	for folderID := range folders {
+		segments, err := graph.GetItemPath(folderID, ctx, c.s.cfg)
+		if err != nil {
+			logger.Warn("Failed to locate changed folder", "id", folderID, "error", err)
+			continue
+		}
+
+		key, filter, ok := packageOf(segments, c.s.cfg.HierarchyLevels)
+		if !ok {
+			//above the package level
+			continue
+		}
+		c.debounce(key, filter, c.s.cfg.WebhookDebounce)
+	}
+}
+
+// packageOf returns the package containing the folder at segments, as a key and a filter selecting it
+func packageOf(segments []string, levels []config.HierarchyLevel) (string, config.PackageFilter, bool) {
+	if len(segments) <= len(levels) {
+		return "", config.PackageFilter{}, false
+	}
+
+	filter := config.PackageFilter{
+		Levels:  make(map[string]string, len(levels)),
+		Package: escapePattern(segments[len(levels)]),
+	}
+	for i, level := range levels {
+		filter.Levels[level.Name] = segments[i]
+	}
+	return strings.Join(segments[:len(levels)+1], "/"), filter, true
+}
+
+// escapePattern makes name match only itself as a path.Match pattern
+func escapePattern(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// debounce starts a run for the package once it has had no changes for delay
+func (c *changeWatcher) debounce(key string, filter config.PackageFilter, delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return
+	}
+	if p, ok := c.pending[key]; ok {
+		p.due = time.Now().Add(delay)
+		return
+	}
+
+	c.s.cfg.Logger.Info("Package changed", "Package Path", key, "settles in", delay.String())
+	c.pending[key] = &pendingPackage{filter: filter, due: time.Now().Add(delay)}
+	time.AfterFunc(delay, func() { c.settle(key) })
+}
+
+// settle starts the package's run once its last change is delay old, or waits longer
+func (c *changeWatcher) settle(key string) {
+	c.mu.Lock()
+	p, ok := c.pending[key]
+	if !ok || c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	if wait := time.Until(p.due); wait > 0 {
+		c.mu.Unlock()
+		time.AfterFunc(wait, func() { c.settle(key) })
+		return
+	}
+	delete(c.pending, key)
+	c.mu.Unlock()
+
+	//a changed package is processed whatever the configured RUN_MODE
+	run, err := c.s.Start(RunRequest{Trigger: TriggerWebhook, Mode: config.RunModeProcess, Filter: p.filter})
+	if errors.Is(err, ErrRunActive) {
+		c.s.cfg.Logger.Info("Changed package waiting for the active run", "Package Path", key)
+		c.debounce(key, p.filter, busyRetryInterval)
+		return
+	}
+	if err != nil {
+		c.s.cfg.Logger.Warn("Failed to start run for changed package", "Package Path", key, "error", err)
+		return
+	}
+	c.s.cfg.Logger.Info("Run started for changed package", "Package Path", key, "Server Run ID", run.ID)
+}
+
+func (c *changeWatcher) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	clear(c.pending)
+}
+
+// manageSubscription keeps a subscription to the library's changes until ctx is done, then deletes it
+func (c *changeWatcher) manageSubscription(ctx context.Context) {
+	cfg := c.s.cfg
+	var sub graph.Subscription
+
+	defer func() {
+		if sub.ID == "" {
+			return
+		}
+		deleteCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := graph.DeleteSubscription(sub.ID, deleteCtx, cfg); err != nil {
+			cfg.Logger.Warn("Failed to delete subscription", "subscription", sub.ID, "error", err)
+			return
+		}
+		cfg.Logger.Info("Subscription deleted", "subscription", sub.ID)
+	}()
+
+	for {
+		wait := subscriptionRetryInterval
+		expiration := time.Now().Add(subscriptionLifetime)
+
+		if sub.ID == "" {
+			created, err := graph.CreateDriveSubscription(cfg.WebhookURL, cfg.WebhookClientState, expiration, ctx, cfg)
+			if err != nil {
+				cfg.Logger.Error("Failed to subscribe to library changes", "error", err)
+			} else {
+				sub = created
+				cfg.Logger.Info("Subscribed to library changes", "subscription", sub.ID, "expires", sub.ExpirationDateTime)
+			}
+		} else {
+			renewed, err := graph.RenewSubscription(sub.ID, expiration, ctx, cfg)
+			var apiErr *graph.APIError
+			switch {
+			case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound:
+				cfg.Logger.Warn("Subscription expired, subscribing again", "subscription", sub.ID)
+				sub = graph.Subscription{}
+				continue
+			case err != nil:
+				cfg.Logger.Error("Failed to renew subscription", "subscription", sub.ID, "error", err)
+			default:
+				sub.ExpirationDateTime = renewed.ExpirationDateTime
+				cfg.Logger.Info("Subscription renewed", "subscription", sub.ID, "expires", sub.ExpirationDateTime)
+			}
+		}
+
+		if sub.ID != "" {
+			if renewAt := time.Until(sub.ExpirationDateTime.Add(-subscriptionRenewBefore)); renewAt > wait {
+				wait = renewAt
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// webhookEnv configures the change watcher
+var webhookEnv = map[string]string{
+	"WEBHOOK_URL":          "https://rfp-parser.example.com/webhooks/graph",
+	"WEBHOOK_CLIENT_STATE": "client-state",
+}
+
+func withEnv(env map[string]string, extra map[string]string) map[string]string {
+	merged := make(map[string]string, len(env)+len(extra))
+	for k, v := range env {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[k] = v
+	}
+	return merged
+}
+
+// shortenSubscriptionTimings makes manageSubscription retry and renew every interval for the test
+func shortenSubscriptionTimings(t *testing.T, interval time.Duration) {
+	lifetime, renewBefore, retry := subscriptionLifetime, subscriptionRenewBefore, subscriptionRetryInterval
+	t.Cleanup(func() {
+		subscriptionLifetime, subscriptionRenewBefore, subscriptionRetryInterval = lifetime, renewBefore, retry
+	})
+
+	//renewing as soon as a subscription is made leaves the retry interval as the wait
+	subscriptionLifetime = time.Hour
+	subscriptionRenewBefore = time.Hour
+	subscriptionRetryInterval = interval
+}
+
+func TestWebhookValidationHandshake(t *testing.T) {
+	g := newFakeGraph(t)
+	s := newTestServer(t, newTestConfig(t, g, webhookEnv))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, webhookPath+"?validationToken=Validation%3A+Testing+client+application", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+	if body := rec.Body.String(); body != "Validation: Testing client application" {
+		t.Errorf("body = %q, want the decoded validation token", body)
+	}
+}
+
+func TestWebhookWithoutURLNotServed(t *testing.T) {
+	g := newFakeGraph(t)
+	s := newTestServer(t, newTestConfig(t, g, nil))
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, webhookPath+"?validationToken=token", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestWebhookClientState(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		queued bool
+	}{
+		{
+			name:   "valid",
+			body:   `{"value": [{"subscriptionId": "sub-1", "clientState": "client-state"}]}`,
+			status: http.StatusAccepted,
+			queued: true,
+		},
+		{
+			name:   "one valid among several",
+			body:   `{"value": [{"subscriptionId": "other", "clientState": "other-state"}, {"subscriptionId": "sub-1", "clientState": "client-state"}]}`,
+			status: http.StatusAccepted,
+			queued: true,
+		},
+		{
+			name:   "invalid",
+			body:   `{"value": [{"subscriptionId": "sub-1", "clientState": "guessed-state"}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "missing",
+			body:   `{"value": [{"subscriptionId": "sub-1"}]}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "no notifications",
+			body:   `{"value": []}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "malformed",
+			body:   `{"value": `,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newFakeGraph(t)
+			s := newTestServer(t, newTestConfig(t, g, webhookEnv))
+
+			rec := httptest.NewRecorder()
+			s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, webhookPath, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if queued := len(s.watcher.notify) == 1; queued != tt.queued {
+				t.Errorf("check for changes queued = %t, want %t", queued, tt.queued)
+			}
+		})
+	}
+}
+
+func TestDebounceCoalescesChanges(t *testing.T) {
+	g := newFakeGraph(t)
+	blockGraph(g)()
+	//webhook runs process the package even when scheduled runs backfill
+	s := newTestServer(t, newTestConfig(t, g, withEnv(webhookEnv, map[string]string{"RUN_MODE": config.RunModeBackfill})))
+
+	const delay = 100 * time.Millisecond
+	filter := config.PackageFilter{
+		Levels:  map[string]string{"Year": "2026", "Business Unit": "Facilities Management", "Division": "FM East"},
+		Package: "City of Ottawa RFP",
+	}
+	key := "2026/Facilities Management/FM East/City of Ottawa RFP"
+
+	var lastChange time.Time
+	for i := 0; i < 4; i++ {
+		lastChange = time.Now()
+		s.watcher.debounce(key, filter, delay)
+		time.Sleep(delay / 3)
+	}
+
+	waitFor(t, "the package's run", func() bool { return len(s.Runs()) > 0 })
+	//a second run would have started by now
+	time.Sleep(2 * delay)
+
+	runs := s.Runs()
+	if len(runs) != 1 {
+		t.Fatalf("started %d runs, want 1", len(runs))
+	}
+	run := runs[0]
+	if run.Trigger != TriggerWebhook || run.Mode != config.RunModeProcess {
+		t.Errorf("run trigger %s, mode %s, want a %s run in %s mode", run.Trigger, run.Mode, TriggerWebhook, config.RunModeProcess)
+	}
+	if run.Package != filter.Package || run.Levels["Division"] != "FM East" {
+		t.Errorf("run selects %v/%s, want the changed package", run.Levels, run.Package)
+	}
+	if settled := lastChange.Add(delay); run.StartedAt.Before(settled.Add(-10 * time.Millisecond)) {
+		t.Errorf("run started at %s, before the last change settled at %s", run.StartedAt, settled)
+	}
+}
+
+func TestNotificationStartsRunForChangedPackage(t *testing.T) {
+	g := newFakeGraph(t)
+	blockGraph(g)()
+
+	g.handle("GET", "/drives/drive/root/delta", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") == "latest" {
+			writeJSON(w, http.StatusOK, map[string]any{
+				"value":            []any{},
+				"@odata.deltaLink": g.URL + graphPrefix + "/drives/drive/root/delta?token=1",
+			})
+			return
+		}
+		//two uploads to one package, one deletion and the package folder itself
+		io.WriteString(w, `{
+			"value": [
+				{"id": "file-1", "name": "Scope.docx", "file": {}, "parentReference": {"id": "package-folder"}},
+				{"id": "file-2", "name": "Pricing.xlsx", "file": {}, "parentReference": {"id": "package-folder"}},
+				{"id": "file-3", "name": "Old.pdf", "deleted": {}, "parentReference": {"id": "package-folder"}},
+				{"id": "package-folder", "name": "City of Ottawa [2026]", "folder": {}, "parentReference": {"id": "division-folder"}}
+			],
+			"@odata.deltaLink": "`+g.URL+graphPrefix+`/drives/drive/root/delta?token=2"
+		}`)
+	})
+	g.handle("GET", "/drives/drive/items/package-folder", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{
+			"id": "package-folder",
+			"name": "City of Ottawa [2026]",
+			"parentReference": {"id": "division-folder", "path": "/drives/drive/root:/2026/Facilities%20Management/FM%20East"}
+		}`)
+	})
+
+	s := newTestServer(t, newTestConfig(t, g, withEnv(webhookEnv, map[string]string{"WEBHOOK_DEBOUNCE": "50ms"})))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		s.watcher.watch(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-watching
+	}()
+	waitFor(t, "change tracking to start", func() bool { return g.count("GET /drives/drive/root/delta") == 1 })
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, webhookPath, strings.NewReader(`{"value": [{"clientState": "client-state"}]}`)))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("notification status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+
+	waitFor(t, "the package's run", func() bool { return len(s.Runs()) > 0 })
+
+	run := s.Runs()[0]
+	if run.Trigger != TriggerWebhook || run.Mode != config.RunModeProcess {
+		t.Errorf("run trigger %s, mode %s, want a %s run in %s mode", run.Trigger, run.Mode, TriggerWebhook, config.RunModeProcess)
+	}
+	wantLevels := map[string]string{"Year": "2026", "Business Unit": "Facilities Management", "Division": "FM East"}
+	for name, want := range wantLevels {
+		if run.Levels[name] != want {
+			t.Errorf("run level %s = %q, want %q", name, run.Levels[name], want)
+		}
+	}
+	//the package name only matches itself
+	if want := `City of Ottawa \[2026\]`; run.Package != want {
+		t.Errorf("run package = %q, want %q", run.Package, want)
+	}
+	if n := g.count("GET /drives/drive/items/package-folder"); n != 1 {
+		t.Errorf("package folder looked up %d times, want once for all its changes", n)
+	}
+}
+
+func TestSubscriptionRenewedAndRecreated(t *testing.T) {
+	shortenSubscriptionTimings(t, 20*time.Millisecond)
+
+	g := newFakeGraph(t)
+
+	var mu sync.Mutex
+	var created []map[string]any
+	g.handle("POST", "/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+
+		mu.Lock()
+		created = append(created, body)
+		id := fmt.Sprintf("sub-%d", len(created))
+		mu.Unlock()
+
+		body["id"] = id
+		writeJSON(w, http.StatusCreated, body)
+	})
+	renewals := 0
+	g.handle("PATCH", "/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		renewals++
+		n := renewals
+		mu.Unlock()
+
+		//the first subscription is renewed once, then expires
+		if r.PathValue("id") == "sub-1" && n > 1 {
+			writeError(w, http.StatusNotFound, "ResourceNotFound")
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		body["id"] = r.PathValue("id")
+		writeJSON(w, http.StatusOK, body)
+	})
+	g.handle("DELETE", "/subscriptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s := newTestServer(t, newTestConfig(t, g, webhookEnv))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	managing := make(chan struct{})
+	go func() {
+		defer close(managing)
+		s.watcher.manageSubscription(ctx)
+	}()
+
+	waitFor(t, "the expired subscription to be re-created and renewed", func() bool {
+		return g.count("POST /subscriptions") == 2 && g.count("PATCH /subscriptions/sub-2") > 0
+	})
+	cancel()
+	<-managing
+
+	if n := g.count("PATCH /subscriptions/sub-1"); n != 2 {
+		t.Errorf("sub-1 renewed %d times, want 2 (one renewal, then 404)", n)
+	}
+	if n := g.count("DELETE /subscriptions/sub-2"); n != 1 {
+		t.Errorf("sub-2 deleted %d times on shutdown, want 1", n)
+	}
+	if n := g.count("DELETE /subscriptions/sub-1"); n != 0 {
+		t.Errorf("expired sub-1 deleted %d times, want 0", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, body := range created {
+		if body["notificationUrl"] != webhookEnv["WEBHOOK_URL"] || body["clientState"] != webhookEnv["WEBHOOK_CLIENT_STATE"] {
+			t.Errorf("subscription %d created with %v, want the webhook URL and clientState", i+1, body)
+		}
+		if body["resource"] != "/drives/drive/root" {
+			t.Errorf("subscription %d resource = %v, want /drives/drive/root", i+1, body["resource"])
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// runValidate checks a KPI definitions file and prints every problem found. It returns the
+// process exit code: 0 when the file is usable, 1 when it has errors, 2 on bad usage.
+func runValidate(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	strict := fs.Bool("strict", false, "treat warnings as errors")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary validate [-strict] [path/to/kpiDefinitions.json, default KPI_DEFINITIONS_PATH]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	path := config.LocalKPIDefPath()
+	if fs.NArg() > 0 {
+		path = fs.Arg(0)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+
+	defFile, err := parser.DecodeKPIDefinitionsUnchecked(data)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %s: %v\n", path, err)
+		return 1
+	}
+
+	issues := parser.ValidateKPIDefinitions(defFile)
+
+	errorCount, warningCount := 0, 0
+	for _, issue := range issues {
+		if issue.Severity == parser.SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+		fmt.Fprintf(stdout, "%s: %s\n", issue.Severity, issue.Error())
+	}
+
+	fmt.Fprintf(stdout, "%s: %d KPI definitions, %d errors, %d warnings\n", path, len(defFile.KPIs), errorCount, warningCount)
+
+	if errorCount > 0 || (*strict && warningCount > 0) {
+		return 1
+	}
+	return 0
+}
+
+// runMigrateKPIs converts a legacy KPI definitions file, a bare array of {name, category, regexps},
+// into the current versioned format, written to out or stdout. It returns the process exit code:
+// 0 on success, 1 on errors, 2 on bad usage.
+func runMigrateKPIs(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("migrate-kpis", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: parserbinary migrate-kpis path/to/legacy.json [path/to/kpiDefinitions.json]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	in := fs.Arg(0)
+
+	data, err := os.ReadFile(in)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+
+	migrated, err := parser.MigrateLegacyKPIDefinitions(data)
+	if err != nil {
+		fmt.Fprintf(stdout, "ERROR: %s: %v\n", in, err)
+		return 1
+	}
+
+	if fs.NArg() == 1 {
+		stdout.Write(migrated)
+		return 0
+	}
+
+	out := fs.Arg(1)
+	if err := os.WriteFile(out, migrated, 0o644); err != nil {
+		fmt.Fprintf(stdout, "ERROR: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "%s: migrated to version %d, written to %s\n", in, parser.KPISchemaVersion, out)
+	return 0
+}
@@ -0,0 +1,292 @@
+package walk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/graph"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// kpiState records which KPI definitions (key -> content hash) Complete packages have been scanned
+// for. It is persisted between runs at cfg.KPIStatePath.
+type kpiState struct {
+	UpdatedAt   time.Time         `json:"updatedAt"`
+	Definitions map[string]string `json:"definitions"` //the baseline, for packages not in Packages
+	//package ID -> hash of the definitions the package was last processed or backfilled with, a key of Snapshots
+	Packages  map[string]string            `json:"packages,omitempty"`
+	Snapshots map[string]map[string]string `json:"snapshots,omitempty"`
+}
+
+type backfillRun struct {
+	state  *kpiState
+	failed int
+}
+
+func newKPIState(kpiDefs []parser.KPIDefinition) *kpiState {
+	state := &kpiState{
+		UpdatedAt:   time.Now().UTC(),
+		Definitions: make(map[string]string, len(kpiDefs)),
+	}
+	for _, def := range kpiDefs {
+		state.Definitions[def.Key()] = def.ContentHash()
+	}
+	return state
+}
+
+// scannedWith returns the definitions the package was last scanned with
+func (s *kpiState) scannedWith(pkgID string) map[string]string {
+	if defs, ok := s.Snapshots[s.Packages[pkgID]]; ok {
+		return defs
+	}
+	return s.Definitions
+}
+
+// recordScan records that the package was scanned with defs, whose hash is defsHash. Snapshots no
+// package refers to any more are dropped.
+func (s *kpiState) recordScan(pkgID, defsHash string, defs map[string]string) {
+	if s.Packages == nil {
+		s.Packages = make(map[string]string)
+		s.Snapshots = make(map[string]map[string]string)
+	}
+	s.Packages[pkgID] = defsHash
+	if _, ok := s.Snapshots[defsHash]; !ok {
+		s.Snapshots[defsHash] = defs
+	}
+
+	referenced := make(map[string]bool, len(s.Snapshots))
+	for _, hash := range s.Packages {
+		referenced[hash] = true
+	}
+	for hash := range s.Snapshots {
+		if !referenced[hash] {
+			delete(s.Snapshots, hash)
+		}
+	}
+	s.UpdatedAt = time.Now().UTC()
+}
+
+// scanRecorder saves the definitions each package is scanned with to the KPI state as packages
+// finish, so a later backfill only re-scans a package for what changed since. Packages finish
+// concurrently.
+type scanRecorder struct {
+	mu       sync.Mutex
+	state    *kpiState
+	path     string
+	defsHash string
+	defs     map[string]string
+}
+
+func newScanRecorder(state *kpiState, statePath string, kpiDefs []parser.KPIDefinition) *scanRecorder {
+	return &scanRecorder{
+		state:    state,
+		path:     statePath,
+		defsHash: hashKPIDefinitions(kpiDefs),
+		defs:     newKPIState(kpiDefs).Definitions,
+	}
+}
+
+func (r *scanRecorder) packageScanned(pkgID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.state.recordScan(pkgID, r.defsHash, r.defs)
+	return saveKPIState(r.path, r.state)
+}
+
+// loadKPIState returns nil, nil when no state has been recorded yet
+func loadKPIState(statePath string) (*kpiState, error) {
+	b, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading KPI state: %w", err)
+	}
+
+	var state kpiState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("decoding KPI state %s: %w", statePath, err)
+	}
+	if state.Definitions == nil {
+		state.Definitions = make(map[string]string)
+	}
+	return &state, nil
+}
+
+func saveKPIState(statePath string, state *kpiState) error {
+	b, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(statePath), "kpiState*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing KPI state: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing KPI state: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing KPI state: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), statePath)
+}
+
+// changedKPIDefinitions returns the definitions that are new or whose content changed since scanned was recorded
+func changedKPIDefinitions(kpiDefs []parser.KPIDefinition, scanned map[string]string) []parser.KPIDefinition {
+	var changed []parser.KPIDefinition
+	for _, def := range kpiDefs {
+		hash, ok := scanned[def.Key()]
+		if !ok {
+			//state recorded before KPI definitions had stable IDs is keyed by name
+			hash = scanned[def.Name]
+		}
+		if hash != def.ContentHash() {
+			changed = append(changed, def)
+		}
+	}
+	return changed
+}
+
+func hashKPIDefinitions(kpiDefs []parser.KPIDefinition) string {
+	hashes := make([]string, 0, len(kpiDefs))
+	for _, def := range kpiDefs {
+		hashes = append(hashes, def.Key()+"="+def.ContentHash())
+	}
+	sort.Strings(hashes)
+
+	h := sha256.New()
+	for _, entry := range hashes {
+		h.Write([]byte(entry + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// initBackfill prepares walkCtx to re-scan Complete packages for the KPI definitions that changed
+// since each was last scanned. It returns false when there is nothing to backfill.
+func initBackfill(walkCtx *WalkContext, state *kpiState) bool {
+	changed := make(map[string]bool)
+	var names []string
+	for _, scanned := range append(slices.Collect(maps.Values(state.Snapshots)), state.Definitions) {
+		for _, def := range changedKPIDefinitions(walkCtx.KPIDefs, scanned) {
+			if !changed[def.Key()] {
+				changed[def.Key()] = true
+				names = append(names, def.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		walkCtx.Cfg.Logger.Info("KPI definitions unchanged since last run. Nothing to backfill")
+		return false
+	}
+
+	sort.Strings(names)
+	walkCtx.Cfg.Logger.Info("Backfilling new or changed KPI definitions", "KPIs", names)
+
+	walkCtx.backfill = &backfillRun{state: state}
+	return true
+}
+
+// finishBackfill records the current definitions as the baseline once every package was backfilled
+func finishBackfill(walkCtx *WalkContext, kpiDefs []parser.KPIDefinition) error {
+	run := walkCtx.backfill
+	if walkCtx.Cfg.DryRun {
+		walkCtx.Cfg.Logger.Info("Dry run. KPI state not updated", "Failed Packages", run.failed)
+		return nil
+	}
+	if run.failed > 0 {
+		//the packages that were backfilled are recorded, the next backfill retries the rest
+		walkCtx.Cfg.Logger.Warn("Backfill incomplete. Re-run backfill to retry the failed packages", "Failed Packages", run.failed)
+		return nil
+	}
+	if !walkCtx.Cfg.Filter.IsEmpty() {
+		//packages outside the filter still need the backfill
+		walkCtx.Cfg.Logger.Info("Backfill complete for the selected packages")
+		return nil
+	}
+
+	state := newKPIState(kpiDefs)
+	if err := saveKPIState(walkCtx.Cfg.KPIStatePath, state); err != nil {
+		return err
+	}
+	walkCtx.Cfg.Logger.Info("Backfill complete")
+	return nil
+}
+
+func backfillPackages(pkgs []graph.Package, path WalkPath, walkCtx *WalkContext) {
+	run := walkCtx.backfill
+	logger := walkCtx.Cfg.Logger.With(path.logArgs()...)
+
+	for _, pkg := range pkgs {
+		status := normalizeProcessStatus(pkg.ListItem.Fields.ProcessStatus)
+		if status != PkgStatusComplete && status != PkgStatusCompleteWithErrors {
+			walkCtx.Summary.PackagesSkipped++
+			continue
+		}
+		//packages processed or backfilled since the definitions changed need less, or nothing
+		changed := changedKPIDefinitions(walkCtx.KPIDefs, run.state.scannedWith(pkg.ID))
+		if len(changed) == 0 {
+			walkCtx.Summary.PackagesSkipped++
+			continue
+		}
+
+		logger.Info("Starting to backfill Package", "Package Name", pkg.Name, "KPIs", len(changed))
+
+		pkgCtx := *walkCtx
+		pkgCtx.KPIDefs = changed
+		pkgResult, err := ProcessRFPPackage(pkg, path, &pkgCtx)
+		if err != nil {
+			logger.Warn("Failed to backfill Package", "error", err, "Package Name", pkg.Name)
+			walkCtx.Summary.packageFailed(pkg.Name, path, err)
+			run.failed++
+			continue
+		}
+
+		//the package's ProcessStatus and failed files are left as they are, the policy only decides whether to retry
+		failedFiles := pkgResult.FailedFiles()
+		if len(failedFiles) > 0 && walkCtx.Cfg.FileFailurePolicy == config.FileFailureFail {
+			err := fmt.Errorf("%d of %d files could not be parsed", len(failedFiles), len(pkgResult.Files))
+			logger.Warn("Failed to backfill Package", "error", err, "Package Name", pkg.Name, "Failed Files", failedFiles)
+			walkCtx.Summary.packageFailed(pkg.Name, path, err)
+			run.failed++
+			continue
+		}
+
+		var rows []Row
+		if len(pkgResult.KPIResults) > 0 {
+			rows = prepareResultsForSmartsheetRows(pkgResult, walkCtx.Cfg.SmartsheetColumns, walkCtx.Levels)
+			if err := walkCtx.sink.postRows(pkg, path, rows); err != nil {
+				logger.Warn("POST request to smartsheet failed during backfill.", "error", err, "Package Name", pkg.Name)
+				walkCtx.Summary.packageFailed(pkg.Name, path, err)
+				run.failed++
+				continue
+			}
+		}
+		withErrors := len(failedFiles) > 0 && walkCtx.Cfg.FileFailurePolicy == config.FileFailureCompleteWithErrors
+		walkCtx.Summary.packageSucceeded(pkg.Name, path, len(pkgResult.KPIResults), len(rows), failedFiles, withErrors)
+
+		if walkCtx.scans != nil {
+			if err := walkCtx.scans.packageScanned(pkg.ID); err != nil {
+				walkCtx.Cfg.Logger.Warn("Unable to save backfill progress", "error", err)
+			}
+		}
+
+		logger.Info("Successfully backfilled Package", "Package Name", pkg.Name, "KPIs Found", len(pkgResult.KPIResults))
+	}
+}
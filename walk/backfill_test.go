@@ -0,0 +1,85 @@
+package walk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+func kpiDef(id, pattern string) parser.KPIDefinition {
+	return parser.KPIDefinition{ID: id, Name: id, Category: "Test", RegexStrs: []string{pattern}}
+}
+
+func changedIDs(defs []parser.KPIDefinition) []string {
+	ids := make([]string, 0, len(defs))
+	for _, def := range defs {
+		ids = append(ids, def.ID)
+	}
+	return ids
+}
+
+func TestBackfillSkipsPackagesScannedWithCurrentDefinitions(t *testing.T) {
+	v1 := []parser.KPIDefinition{kpiDef("a", "alpha"), kpiDef("b", "beta")}
+	v2 := []parser.KPIDefinition{kpiDef("a", "alpha"), kpiDef("b", "beta2"), kpiDef("c", "gamma")}
+	v3 := []parser.KPIDefinition{kpiDef("a", "alpha3"), kpiDef("b", "beta2"), kpiDef("c", "gamma")}
+
+	statePath := filepath.Join(t.TempDir(), "kpiState.json")
+	state := newKPIState(v1)
+
+	//a process run with v2 scans the new package "new"
+	if err := newScanRecorder(state, statePath, v2).packageScanned("new"); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := loadKPIState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		pkgID string
+		defs  []parser.KPIDefinition
+		want  []string
+	}{
+		{"old", v2, []string{"b", "c"}},
+		{"new", v2, []string{}},
+		{"old", v3, []string{"a", "b", "c"}},
+		{"new", v3, []string{"a"}},
+	}
+	for _, tt := range tests {
+		got := changedIDs(changedKPIDefinitions(tt.defs, state.scannedWith(tt.pkgID)))
+		if len(got) != len(tt.want) {
+			t.Errorf("package %s: changed = %v, want %v", tt.pkgID, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("package %s: changed = %v, want %v", tt.pkgID, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRecordScanDropsUnusedSnapshots(t *testing.T) {
+	v1 := []parser.KPIDefinition{kpiDef("a", "alpha")}
+	v2 := []parser.KPIDefinition{kpiDef("a", "alpha2")}
+
+	statePath := filepath.Join(t.TempDir(), "kpiState.json")
+	state := newKPIState(v1)
+
+	if err := newScanRecorder(state, statePath, v1).packageScanned("p"); err != nil {
+		t.Fatal(err)
+	}
+	if err := newScanRecorder(state, statePath, v2).packageScanned("p"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(state.Snapshots) != 1 {
+		t.Fatalf("got %d snapshots, want 1", len(state.Snapshots))
+	}
+	if _, ok := state.Snapshots[hashKPIDefinitions(v2)]; !ok {
+		t.Errorf("snapshot of the latest definitions missing")
+	}
+}
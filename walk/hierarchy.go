@@ -0,0 +1,107 @@
+package walk
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+// Level is one configured folder level of the document library
+type Level struct {
+	Name     string
+	Validate func(name string) bool //nil accepts every folder
+	Column   int64                  //Smartsheet column, 0 when the level is not reported
+	Numeric  bool
+}
+
+// levelValidators are the named validators available to config.HierarchyLevel
+var levelValidators = map[string]func(string) bool{
+	"year": isValidYear,
+}
+
+const regexValidatorPrefix = "regex:"
+
+func buildLevels(hierarchy []config.HierarchyLevel) ([]Level, error) {
+	if len(hierarchy) == 0 {
+		return nil, fmt.Errorf("at least one library level is required")
+	}
+
+	levels := make([]Level, 0, len(hierarchy))
+	for _, h := range hierarchy {
+		level := Level{Name: h.Name, Column: h.Column, Numeric: h.Numeric}
+
+		switch {
+		case h.Validator == "":
+		case strings.HasPrefix(h.Validator, regexValidatorPrefix):
+			re, err := regexp.Compile(strings.TrimPrefix(h.Validator, regexValidatorPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("level %q: invalid validator: %w", h.Name, err)
+			}
+			level.Validate = re.MatchString
+		default:
+			validate, ok := levelValidators[h.Validator]
+			if !ok {
+				return nil, fmt.Errorf("level %q: unknown validator %q", h.Name, h.Validator)
+			}
+			level.Validate = validate
+		}
+
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func (l Level) accepts(name string) bool {
+	return l.Validate == nil || l.Validate(name)
+}
+
+// WalkPath holds the folder name at each level walked so far, outermost first
+type WalkPath struct {
+	Names  []string
+	Values []string
+}
+
+// with returns a copy of p extended by one level
+func (p WalkPath) with(name, value string) WalkPath {
+	return WalkPath{
+		Names:  append(p.Names[:len(p.Names):len(p.Names)], name),
+		Values: append(p.Values[:len(p.Values):len(p.Values)], value),
+	}
+}
+
+// Levels returns the folder name for each level name
+func (p WalkPath) Levels() map[string]string {
+	levels := make(map[string]string, len(p.Names))
+	for i, name := range p.Names {
+		levels[name] = p.Values[i]
+	}
+	return levels
+}
+
+// String joins the folder names, e.g. "2026/Energy/East"
+func (p WalkPath) String() string {
+	return strings.Join(p.Values, "/")
+}
+
+// logArgs are the level names and values as slog key-value pairs, e.g. "Year", "2026"
+func (p WalkPath) logArgs() []any {
+	args := make([]any, 0, 2*len(p.Names))
+	for i, name := range p.Names {
+		args = append(args, name, p.Values[i])
+	}
+	return args
+}
+
+func isValidYear(s string) bool {
+	year, err := strconv.Atoi(s)
+	if err != nil {
+		return false
+	}
+
+	currentYear := time.Now().Year()
+	return year >= 2025 && year <= currentYear+1
+}
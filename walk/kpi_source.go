@@ -0,0 +1,290 @@
+package walk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/graph"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// KPIDefsInfo identifies the KPI definitions a run used
+type KPIDefsInfo struct {
+	Source  string //e.g. "file:./parser/kpiDefinitions.json" or "list:KPI Definitions"
+	Version int    //schema version
+	Hash    string //sha256 of the definitions as loaded
+}
+
+// ShortHash is the abbreviated hash recorded with each result row
+func (i KPIDefsInfo) ShortHash() string {
+	if len(i.Hash) > 12 {
+		return i.Hash[:12]
+	}
+	return i.Hash
+}
+
+// loadKPIDefinitions reads the KPI definitions from the configured source, validates them and
+// compiles them. Definitions with validation errors are never used.
+func loadKPIDefinitions(ctx context.Context, cfg *config.ApiConfig) (*parser.KPIDefinitionFile, KPIDefsInfo, error) {
+	data, source, err := readKPIDefinitions(ctx, cfg)
+	if err != nil {
+		return nil, KPIDefsInfo{}, fmt.Errorf("loading KPI definitions: %w", err)
+	}
+
+	defFile, err := decodeValidKPIDefinitions(data, source, cfg.Logger)
+	if err != nil {
+		return nil, KPIDefsInfo{}, err
+	}
+
+	sum := sha256.Sum256(data)
+	info := KPIDefsInfo{
+		Source:  source,
+		Version: defFile.Version,
+		Hash:    hex.EncodeToString(sum[:]),
+	}
+	cfg.Logger.Info("KPI definitions loaded", "source", info.Source, "version", info.Version, "hash", info.Hash, "KPIs", len(defFile.KPIs))
+	return defFile, info, nil
+}
+
+func readKPIDefinitions(ctx context.Context, cfg *config.ApiConfig) ([]byte, string, error) {
+	switch cfg.KPIDefSource {
+	case config.KPIDefSourceDrive:
+		source := "drive:" + cfg.KPIDefPath
+		item, err := graph.GetItemByPath(cfg.KPIDefPath, ctx, cfg)
+		if err != nil {
+			return nil, source, err
+		}
+
+		f, err := graph.GetFile(item.ID, ctx, cfg)
+		if err != nil {
+			return nil, source, err
+		}
+		defer f.Close()
+		defer os.Remove(f.Name())
+
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, source, err
+		}
+		data, err := io.ReadAll(f)
+		return data, source, err
+
+	case config.KPIDefSourceList:
+		source := "list:" + cfg.KPIDefList
+		items, err := graph.GetListItems(cfg.KPIDefList, ctx, cfg)
+		if err != nil {
+			return nil, source, err
+		}
+		data, err := listItemsToKPIDefinitions(items)
+		return data, source, err
+	}
+
+	source := "file:" + cfg.KPIDefPath
+	data, err := os.ReadFile(cfg.KPIDefPath)
+	return data, source, err
+}
+
+// LoadLocalKPIDefinitions reads, validates and compiles a local KPI definitions file the same way
+// a run does, logging every issue to logger
+func LoadLocalKPIDefinitions(path string, logger *slog.Logger) (*parser.KPIDefinitionFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("loading KPI definitions: %w", err)
+	}
+	return decodeValidKPIDefinitions(data, "file:"+path, logger)
+}
+
+// decodeValidKPIDefinitions runs the same checks as the validate command, logging every issue.
+// Any error fails the load; warnings are logged only.
+func decodeValidKPIDefinitions(data []byte, source string, logger *slog.Logger) (*parser.KPIDefinitionFile, error) {
+	unchecked, err := parser.DecodeKPIDefinitionsUnchecked(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading KPI definitions from %s: %w", source, err)
+	}
+
+	var firstErr error
+	errCount := 0
+	for _, issue := range parser.ValidateKPIDefinitions(unchecked) {
+		if issue.Severity == parser.SeverityError {
+			logger.Error("Invalid KPI definition", "source", source, "issue", issue.Error())
+			if firstErr == nil {
+				firstErr = issue
+			}
+			errCount++
+			continue
+		}
+		logger.Warn("KPI definition warning", "source", source, "issue", issue.Error())
+	}
+	if firstErr != nil {
+		return nil, fmt.Errorf("KPI definitions from %s have %d error(s): %w", source, errCount, firstErr)
+	}
+
+	defFile, err := parser.DecodeKPIDefinitions(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading KPI definitions from %s: %w", source, err)
+	}
+	if err := defFile.Compile(); err != nil {
+		return nil, fmt.Errorf("compiling KPI definitions from %s: %w", source, err)
+	}
+	return defFile, nil
+}
+
+// SharePoint list columns (internal names) holding KPI definitions, one list item per KPI.
+// Multi-line columns take one entry per line. Definition holds any further definition fields
+// (rule, fuzzy, sections, languages, examples) as a JSON object.
+const (
+	listColID            = "KPIID"
+	listColName          = "Title"
+	listColCategory      = "Category"
+	listColRegexps       = "Regexps"
+	listColExclude       = "Exclude"
+	listColEnabled       = "Enabled"
+	listColWeight        = "Weight"
+	listColEffectiveFrom = "EffectiveFrom"
+	listColDescription   = "Description"
+	listColOwner         = "Owner"
+	listColTags          = "Tags"
+	listColDefinition    = "Definition"
+)
+
+// listSettingsID is the KPIID of the optional list item whose Definition column holds the
+// file-level settings (macros, synonyms, strengthCues, scoring, context). It is not a valid KPI ID.
+const listSettingsID = "_settings"
+
+// listSettingsKeys are the top-level definitions file keys the settings item may set
+var listSettingsKeys = []string{"macros", "synonyms", "strengthCues", "scoring", "context"}
+
+var (
+	lineSeparator = regexp.MustCompile(`\r?\n`)
+	tagSeparator  = regexp.MustCompile(`\r?\n|,`)
+)
+
+// listItemsToKPIDefinitions converts SharePoint list items into a definitions file, so they are
+// decoded and validated exactly like a JSON file
+func listItemsToKPIDefinitions(items []graph.ListItem) ([]byte, error) {
+	defFile := map[string]any{"version": parser.KPISchemaVersion}
+	kpis := make([]map[string]any, 0, len(items))
+	settingsItem := ""
+
+	for _, item := range items {
+		if listString(item.Fields, listColID) == listSettingsID {
+			if settingsItem != "" {
+				return nil, fmt.Errorf("list items %s and %s both have KPIID %s, only one settings item is allowed", settingsItem, item.ID, listSettingsID)
+			}
+			settingsItem = item.ID
+			if err := listSettings(item, defFile); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		kpi, err := listItemToKPI(item)
+		if err != nil {
+			return nil, err
+		}
+		kpis = append(kpis, kpi)
+	}
+
+	defFile["kpis"] = kpis
+	return json.Marshal(defFile)
+}
+
+// listSettings copies the settings item's Definition column into defFile
+func listSettings(item graph.ListItem, defFile map[string]any) error {
+	settings := make(map[string]any)
+	if raw := listString(item.Fields, listColDefinition); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+			return fmt.Errorf("settings list item %s: %s column is not a JSON object: %w", item.ID, listColDefinition, err)
+		}
+	}
+
+	for key, value := range settings {
+		if !slices.Contains(listSettingsKeys, key) {
+			return fmt.Errorf("settings list item %s: unknown setting %q, expected one of %s", item.ID, key, strings.Join(listSettingsKeys, ", "))
+		}
+		defFile[key] = value
+	}
+	return nil
+}
+
+func listItemToKPI(item graph.ListItem) (map[string]any, error) {
+	kpi := make(map[string]any)
+
+	if raw := listString(item.Fields, listColDefinition); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &kpi); err != nil {
+			return nil, fmt.Errorf("list item %s: %s column is not a JSON object: %w", item.ID, listColDefinition, err)
+		}
+	}
+
+	for col, key := range map[string]string{
+		listColID:          "id",
+		listColName:        "name",
+		listColCategory:    "category",
+		listColDescription: "description",
+		listColOwner:       "owner",
+	} {
+		if v := listString(item.Fields, col); v != "" {
+			kpi[key] = v
+		}
+	}
+
+	if v := listString(item.Fields, listColEffectiveFrom); v != "" {
+		//date columns are returned as timestamps, e.g. 2026-01-01T08:00:00Z
+		from, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, fmt.Errorf("list item %s: %s column: %w", item.ID, listColEffectiveFrom, err)
+		}
+		kpi["effectiveFrom"] = from.UTC().Format(parser.EffectiveFromLayout)
+	}
+	if lines := listLines(item.Fields, listColRegexps, lineSeparator); len(lines) > 0 {
+		kpi["regexps"] = lines
+	}
+	if lines := listLines(item.Fields, listColExclude, lineSeparator); len(lines) > 0 {
+		kpi["exclude"] = lines
+	}
+	if tags := listLines(item.Fields, listColTags, tagSeparator); len(tags) > 0 {
+		kpi["tags"] = tags
+	}
+	if v, ok := item.Fields[listColEnabled].(bool); ok {
+		kpi["enabled"] = v
+	}
+	if v, ok := item.Fields[listColWeight].(float64); ok {
+		kpi["weight"] = v
+	}
+
+	return kpi, nil
+}
+
+func listString(fields map[string]any, col string) string {
+	v, ok := fields[col].(string)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(v)
+}
+
+// listLines splits a column into its non-empty entries
+func listLines(fields map[string]any, col string, sep *regexp.Regexp) []string {
+	raw := listString(fields, col)
+	if raw == "" {
+		return nil
+	}
+
+	var lines []string
+	for _, part := range sep.Split(raw, -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			lines = append(lines, part)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,76 @@
+package walk
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/JA50N14/rfp_parser/graph"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+func TestListItemsToKPIDefinitions(t *testing.T) {
+	items := []graph.ListItem{
+		{ID: "1", Fields: map[string]any{
+			listColID:         listSettingsID,
+			listColDefinition: `{"synonyms": {"certified": ["certified", "certification"]}, "scoring": {"categoryWeights": {"Certifications": 2}}}`,
+		}},
+		{ID: "2", Fields: map[string]any{
+			listColID:            "iso-14001",
+			listColName:          "ISO 14001",
+			listColCategory:      "Certifications",
+			listColRegexps:       "\\bISO 14001 {{certified}}\r\n\\bISO 14001\\b",
+			listColEffectiveFrom: "2026-01-01T08:00:00Z",
+			listColWeight:        1.5,
+		}},
+	}
+
+	data, err := listItemsToKPIDefinitions(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defFile, err := parser.DecodeKPIDefinitions(data)
+	if err != nil {
+		t.Fatalf("list definitions do not decode: %v\n%s", err, data)
+	}
+	if err := defFile.Compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(defFile.KPIs) != 1 {
+		t.Fatalf("got %d KPIs, want 1 (the settings item is not a KPI)", len(defFile.KPIs))
+	}
+	kpi := defFile.KPIs[0]
+	if kpi.EffectiveFrom != "2026-01-01" {
+		t.Errorf("effectiveFrom = %q, want 2026-01-01", kpi.EffectiveFrom)
+	}
+	if len(kpi.Regexps) != 2 || strings.Contains(kpi.Regexps[0].String(), "{{") {
+		t.Errorf("regexps = %q, want 2 with the synonym expanded", kpi.Regexps)
+	}
+	if defFile.Scoring == nil || defFile.Scoring.CategoryWeights["Certifications"] != 2 {
+		t.Errorf("scoring = %+v, want the settings item's category weights", defFile.Scoring)
+	}
+}
+
+func TestListItemsToKPIDefinitionsInvalid(t *testing.T) {
+	settings := func(id, definition string) graph.ListItem {
+		return graph.ListItem{ID: id, Fields: map[string]any{listColID: listSettingsID, listColDefinition: definition}}
+	}
+
+	tests := []struct {
+		name  string
+		items []graph.ListItem
+		want  string
+	}{
+		{"unknown setting", []graph.ListItem{settings("1", `{"kpis": []}`)}, `unknown setting "kpis"`},
+		{"two settings items", []graph.ListItem{settings("1", `{}`), settings("2", `{}`)}, "only one settings item"},
+		{"settings not JSON", []graph.ListItem{settings("1", `macros`)}, "not a JSON object"},
+		{"invalid date", []graph.ListItem{{ID: "3", Fields: map[string]any{listColID: "a", listColEffectiveFrom: "next week"}}}, listColEffectiveFrom},
+	}
+
+	for _, tt := range tests {
+		_, err := listItemsToKPIDefinitions(tt.items)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package walk
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// ParseLocalFile runs the parsers, KPI matching and, when extractEntities is set, entity
+// extraction on a local .docx, .xlsx or .pdf file, as a one-file package
+func ParseLocalFile(ctx context.Context, filePath string, kpiDefs []parser.KPIDefinition, extractEntities bool) (PkgResult, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	switch ext {
+	case docxExt, xlsxExt, pdfExt:
+	default:
+		return PkgResult{}, fmt.Errorf("unsupported file extension: %q", ext)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return PkgResult{}, err
+	}
+	defer f.Close()
+
+	scan := &packageScan{
+		kpiResults: parser.CreatePkgResultForRFPPackage(kpiDefs),
+	}
+	if extractEntities {
+		scan.entities = parser.NewEntityCollector()
+	}
+
+	name := filepath.Base(filePath)
+	match := func(seg parser.TextSegment) error {
+		seg.File = name
+		parser.ScanSegment(seg, scan.kpiResults, scan.entities)
+		return nil
+	}
+	detect, flush := parser.WithLanguageDetection(match)
+
+	walkCtx := &WalkContext{Ctx: ctx}
+	if err := parseFile(f, ext, detect, walkCtx); err != nil {
+		return PkgResult{}, err
+	}
+	if err := flush(); err != nil {
+		return PkgResult{}, err
+	}
+
+	kpiResults := parser.RemoveKPIResultsNotFound(scan.kpiResults)
+
+	pkgResult := PkgResult{
+		PackageName:    name,
+		DateParsed:     time.Now().Format("2006-01-02"),
+		KPIResults:     kpiResults,
+		CategoryScores: parser.CategoryScores(kpiResults),
+		Files:          []FileOutcome{{Name: name}},
+	}
+
+	if scan.entities != nil {
+		pkgResult.Entities = scan.entities.Entities()
+		parser.MarkCoveredEntities(pkgResult.Entities, kpiDefs)
+	}
+
+	return pkgResult, nil
+}
@@ -0,0 +1,99 @@
+package walk
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+// writeTestDocx writes a minimal .docx with one paragraph per entry of paragraphs
+func writeTestDocx(t *testing.T, dir string, paragraphs ...string) string {
+	t.Helper()
+
+	var document strings.Builder
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?><w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>`)
+	for _, p := range paragraphs {
+		document.WriteString(`<w:p><w:r><w:t>` + p + `</w:t></w:r></w:p>`)
+	}
+	document.WriteString(`</w:body></w:document>`)
+
+	path := filepath.Join(dir, "rfp.docx")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, document.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseLocalFileFindsKPIs(t *testing.T) {
+	dir := t.TempDir()
+	kpiPath := filepath.Join(dir, "kpiDefinitions.json")
+	err := os.WriteFile(kpiPath, []byte(`{"version": 2, "kpis": [
+		{"id": "iso-14001", "name": "ISO 14001", "category": "Certifications", "regexps": ["\\bISO 14001\\b"]},
+		{"id": "leed", "name": "LEED", "category": "Certifications", "regexps": ["\\bLEED\\b"]}
+	]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := writeTestDocx(t, dir,
+		"Scope of Work",
+		"The contractor shall maintain ISO 14001 certification for all sites.",
+	)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	defFile, err := LoadLocalKPIDefinitions(kpiPath, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ParseLocalFile(context.Background(), filePath, parser.ActiveKPIDefinitions(defFile.KPIs, time.Now()), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.KPIResults) != 1 {
+		t.Fatalf("found %d KPIs, want 1: %+v", len(result.KPIResults), result.KPIResults)
+	}
+	kpi := result.KPIResults[0]
+	if kpi.KPIDef.ID != "iso-14001" {
+		t.Errorf("found KPI %q, want %q", kpi.KPIDef.ID, "iso-14001")
+	}
+	if !strings.Contains(kpi.Sentence, "ISO 14001 certification") {
+		t.Errorf("sentence = %q, want the matching sentence", kpi.Sentence)
+	}
+}
+
+func TestLoadLocalKPIDefinitionsRejectsInvalid(t *testing.T) {
+	kpiPath := filepath.Join(t.TempDir(), "kpiDefinitions.json")
+	err := os.WriteFile(kpiPath, []byte(`{"version": 2, "kpis": [
+		{"id": "bad", "name": "Bad", "category": "Certifications", "regexps": ["(unclosed"]}
+	]}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if _, err := LoadLocalKPIDefinitions(kpiPath, logger); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
@@ -0,0 +1,175 @@
+package walk
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/graph"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+const processStatusColumn = "ProcessStatus"
+
+// topKPICount is how many KPI names the TopKPIs field lists
+const topKPICount = 5
+
+// packageFieldTypes is the list column type each metadata field must be written to
+var packageFieldTypes = map[string]string{
+	config.PackageFieldLastProcessedAt: graph.ColumnTypeDateTime,
+	config.PackageFieldRunID:           graph.ColumnTypeText,
+	config.PackageFieldKPICount:        graph.ColumnTypeNumber,
+	config.PackageFieldTopKPIs:         graph.ColumnTypeText,
+	config.PackageFieldFailedFiles:     graph.ColumnTypeText,
+	config.PackageFieldErrorMessage:    graph.ColumnTypeText,
+	config.PackageFieldCategoryScores:  graph.ColumnTypeText,
+}
+
+// validatePackageColumns checks ProcessStatus and the configured metadata columns against the
+// library's column definitions, reporting every problem at once
+func validatePackageColumns(walkCtx *WalkContext) error {
+	cfg := walkCtx.Cfg
+	defs, err := graph.GetLibraryColumns(walkCtx.Ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("listing library columns: %w", err)
+	}
+
+	columns := make(map[string]graph.ColumnDefinition, len(defs))
+	for _, def := range defs {
+		columns[def.Name] = def
+	}
+
+	var problems []error
+
+	status, ok := columns[processStatusColumn]
+	switch {
+	case !ok:
+		problems = append(problems, fmt.Errorf("column %s not found", processStatusColumn))
+	case status.Choice != nil && !status.Choice.AllowTextEntry:
+		statuses := []string{PkgStatusInProgress, PkgStatusComplete, PkgStatusFailed}
+		if cfg.FileFailurePolicy == config.FileFailureCompleteWithErrors {
+			statuses = append(statuses, PkgStatusCompleteWithErrors)
+		}
+		for _, s := range statuses {
+			if !slices.Contains(status.Choice.Choices, s) {
+				problems = append(problems, fmt.Errorf("column %s has no %q option", processStatusColumn, s))
+			}
+		}
+	}
+
+	for _, pc := range cfg.PackageColumns {
+		def, ok := columns[pc.Column]
+		if !ok {
+			problems = append(problems, fmt.Errorf("%s: column %s not found", pc.Field, pc.Column))
+			continue
+		}
+		if def.ReadOnly {
+			problems = append(problems, fmt.Errorf("%s: column %s is read-only", pc.Field, pc.Column))
+		}
+		if want := packageFieldTypes[pc.Field]; def.Type() != want {
+			problems = append(problems, fmt.Errorf("%s: column %s is of type %s, expected %s", pc.Field, pc.Column, def.Type(), want))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid package columns: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// finishPackage sets the package's final ProcessStatus and, in the same PATCH, its metadata columns.
+// pkgResult is the zero value when the package failed before it was scanned, pkgErr is nil unless
+// status is Failed. It returns false when the PATCH failed.
+func finishPackage(pkg graph.Package, path WalkPath, status string, pkgResult PkgResult, pkgErr error, logger *slog.Logger, walkCtx *WalkContext) bool {
+	fields := packageMetadata(status, pkgResult, pkgErr, walkCtx)
+	fields[processStatusColumn] = status
+
+	if err := walkCtx.sink.patchFields(pkg, path, fields); err != nil {
+		logger.Warn("PATCH request to set ProcessStatus to "+status+" failed. Need to manually set ProcessStatus to "+status+".", "error", err, "Package Name", pkg.Name)
+		return false
+	}
+	return true
+}
+
+// packageMetadata returns the configured metadata columns for a package. Fields without a value are
+// cleared so a retried package does not keep stale values from its previous run.
+func packageMetadata(status string, pkgResult PkgResult, pkgErr error, walkCtx *WalkContext) map[string]any {
+	fields := make(map[string]any, len(walkCtx.Cfg.PackageColumns)+1)
+
+	for _, pc := range walkCtx.Cfg.PackageColumns {
+		switch pc.Field {
+		case config.PackageFieldLastProcessedAt:
+			fields[pc.Column] = time.Now().UTC().Format(time.RFC3339)
+
+		case config.PackageFieldRunID:
+			fields[pc.Column] = walkCtx.Summary.RunID
+
+		case config.PackageFieldKPICount:
+			if status == PkgStatusFailed {
+				fields[pc.Column] = nil
+			} else {
+				fields[pc.Column] = len(pkgResult.KPIResults)
+			}
+
+		case config.PackageFieldTopKPIs:
+			fields[pc.Column] = strings.Join(topKPIs(pkgResult.KPIResults, topKPICount), "\n")
+
+		case config.PackageFieldFailedFiles:
+			fields[pc.Column] = strings.Join(pkgResult.FailedFiles(), "\n")
+
+		case config.PackageFieldErrorMessage:
+			msg := ""
+			if pkgErr != nil {
+				msg = pkgErr.Error()
+			}
+			fields[pc.Column] = msg
+
+		case config.PackageFieldCategoryScores:
+			fields[pc.Column] = strings.Join(categoryScoreLines(pkgResult.CategoryScores), "\n")
+		}
+	}
+
+	return fields
+}
+
+// topKPIs returns the names of the n highest scoring KPIs found
+func topKPIs(kpiResults []parser.KPIResult, n int) []string {
+	sorted := slices.Clone(kpiResults)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Score > sorted[j].Score
+	})
+
+	names := make([]string, 0, n)
+	for _, result := range sorted {
+		if len(names) == n {
+			break
+		}
+		names = append(names, result.KPIDef.Name)
+	}
+	return names
+}
+
+// categoryScoreLines formats the package's category scores as "Category: score", highest first
+func categoryScoreLines(scores map[string]float64) []string {
+	categories := make([]string, 0, len(scores))
+	for category := range scores {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool {
+		if scores[categories[i]] != scores[categories[j]] {
+			return scores[categories[i]] > scores[categories[j]]
+		}
+		return categories[i] < categories[j]
+	})
+
+	lines := make([]string, 0, len(categories))
+	for _, category := range categories {
+		lines = append(lines, fmt.Sprintf("%s: %.2f", category, roundScore(scores[category])))
+	}
+	return lines
+}
@@ -0,0 +1,169 @@
+package walk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/graph"
+)
+
+// PackageInfo describes a package found by ListPackages
+type PackageInfo struct {
+	ID     string
+	Name   string
+	Path   WalkPath
+	Status string //PkgStatusNew when never processed
+}
+
+// checkFilter reports filter levels that are not library levels and invalid package patterns
+func checkFilter(levels []Level, filter config.PackageFilter) error {
+	var problems []error
+	for name := range filter.Levels {
+		known := false
+		for _, level := range levels {
+			if strings.EqualFold(level.Name, name) {
+				known = true
+			}
+		}
+		if !known {
+			problems = append(problems, fmt.Errorf("filter level %q is not a library level", name))
+		}
+	}
+
+	if _, err := path.Match(filter.Package, ""); err != nil {
+		problems = append(problems, fmt.Errorf("package filter %q: %w", filter.Package, err))
+	}
+
+	return errors.Join(problems...)
+}
+
+// filterAllowsFolder reports whether folder may be walked at the named level. Names are compared case-insensitively.
+func filterAllowsFolder(filter config.PackageFilter, levelName, folder string) bool {
+	for name, value := range filter.Levels {
+		if strings.EqualFold(name, levelName) {
+			return strings.EqualFold(value, folder)
+		}
+	}
+	return true
+}
+
+func filterPackages(filter config.PackageFilter, pkgs []graph.Package) []graph.Package {
+	if filter.Package == "" {
+		return pkgs
+	}
+
+	matched := make([]graph.Package, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		if ok, _ := path.Match(filter.Package, pkg.Name); ok {
+			matched = append(matched, pkg)
+		}
+	}
+	return matched
+}
+
+// ListPackages returns every package selected by cfg.Filter with its ProcessStatus, without processing them
+func ListPackages(ctx context.Context, cfg *config.ApiConfig) ([]PackageInfo, error) {
+	walkCtx, err := newListingContext(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []PackageInfo
+	walkCtx.visit = func(pkgs []graph.Package, path WalkPath) error {
+		for _, pkg := range pkgs {
+			infos = append(infos, PackageInfo{
+				ID:     pkg.ID,
+				Name:   pkg.Name,
+				Path:   path,
+				Status: normalizeProcessStatus(pkg.ListItem.Fields.ProcessStatus),
+			})
+		}
+		return nil
+	}
+
+	err = walkLibrary(walkCtx)
+	return infos, err
+}
+
+// ResetPackages clears the ProcessStatus of pkgs so the next run processes them again. InProgress
+// packages may be mid-run and are left alone unless force is set. It returns the packages reset.
+func ResetPackages(ctx context.Context, cfg *config.ApiConfig, pkgs []PackageInfo, force bool) ([]PackageInfo, error) {
+	var reset []PackageInfo
+	var errs []error
+
+	for _, pkg := range pkgs {
+		if pkg.Status == PkgStatusNew {
+			continue
+		}
+		if pkg.Status == PkgStatusInProgress && !force {
+			cfg.Logger.Warn("Package is InProgress and was not reset", "Package Name", pkg.Name, "path", pkg.Path.String())
+			continue
+		}
+		if cfg.DryRun {
+			reset = append(reset, pkg)
+			continue
+		}
+
+		//a cleared status is treated as New
+		err := graph.PatchFields(pkg.ID, map[string]any{processStatusColumn: nil}, ctx, cfg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resetting %s/%s: %w", pkg.Path, pkg.Name, err))
+			continue
+		}
+		reset = append(reset, pkg)
+	}
+
+	return reset, errors.Join(errs...)
+}
+
+// CheckSetup checks everything a run depends on without processing any package: the library
+// levels and filter, the KPI definitions and the package columns. Every problem found is returned.
+func CheckSetup(ctx context.Context, cfg *config.ApiConfig) error {
+	var problems []error
+
+	walkCtx, err := newListingContext(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := checkFilter(walkCtx.Levels, cfg.Filter); err != nil {
+		problems = append(problems, err)
+	}
+
+	if _, _, err := loadKPIDefinitions(ctx, cfg); err != nil {
+		problems = append(problems, err)
+	}
+
+	if err := validatePackageColumns(walkCtx); err != nil {
+		problems = append(problems, err)
+	}
+
+	if _, err := graph.GetRootDirs(ctx, cfg); err != nil {
+		problems = append(problems, fmt.Errorf("listing library root: %w", err))
+	}
+
+	return errors.Join(problems...)
+}
+
+// newListingContext returns a WalkContext for walking the library without KPI definitions
+func newListingContext(ctx context.Context, cfg *config.ApiConfig) (*WalkContext, error) {
+	levels, err := buildLevels(cfg.HierarchyLevels)
+	if err != nil {
+		return nil, err
+	}
+
+	walkCtx := &WalkContext{
+		Cfg:     cfg,
+		Ctx:     ctx,
+		Now:     time.Now(),
+		Levels:  levels,
+		Summary: newRunSummary(cfg.RunMode, levels),
+	}
+	walkCtx.sink = liveSink{walkCtx: walkCtx}
+	return walkCtx, nil
+}
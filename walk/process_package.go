@@ -1,21 +1,53 @@
 package walk
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/JA50N14/rfp_parser/cache"
 	"github.com/JA50N14/rfp_parser/graph"
 	"github.com/JA50N14/rfp_parser/parser"
 )
 
 type PkgResult struct {
-	PackageName  string
-	DateParsed   string
-	Year         string
-	BusinessUnit string
-	Division     string
-	KPIResults   []parser.KPIResult
+	PackageName    string
+	DateParsed     string
+	Levels         map[string]string //folder name at each library level, e.g. "Year": "2026"
+	KPIResults     []parser.KPIResult
+	CategoryScores map[string]float64
+	KPIDefsHash    string //identifies the KPI definitions the package was scanned with
+	Entities       []parser.Entity
+	Files          []FileOutcome
+}
+
+// FileOutcome records whether one supported file in a package was parsed
+type FileOutcome struct {
+	Name  string //relative to the package folder
+	Error error
+}
+
+// FailedFiles returns the names of the files that could not be downloaded or parsed
+func (r PkgResult) FailedFiles() []string {
+	var failed []string
+	for _, f := range r.Files {
+		if f.Error != nil {
+			failed = append(failed, f.Name)
+		}
+	}
+	return failed
+}
+
+// packageScan accumulates the results of walking one package's files
+type packageScan struct {
+	kpiResults []parser.KPIResult
+	entities   *parser.EntityCollector
+	files      []FileOutcome
 }
 
 const (
@@ -25,7 +57,14 @@ const (
 )
 
 func ProcessRFPPackage(pkg graph.Package, path WalkPath, walkCtx *WalkContext) (PkgResult, error) {
-	kpiResults := parser.CreatePkgResultForRFPPackage(walkCtx.KPIDefs)
+	scan := &packageScan{
+		kpiResults: parser.CreatePkgResultForRFPPackage(walkCtx.KPIDefs),
+	}
+
+	//backfills only report the changed KPIs
+	if walkCtx.Cfg.ExtractEntities && walkCtx.backfill == nil {
+		scan.entities = parser.NewEntityCollector()
+	}
 
 	items, err := graph.GetItemSubDirs(pkg.ID, walkCtx.Ctx, walkCtx.Cfg)
 	if err != nil {
@@ -33,99 +72,219 @@ func ProcessRFPPackage(pkg graph.Package, path WalkPath, walkCtx *WalkContext) (
 	}
 
 	for _, item := range items {
-		if err := walkRFPPackage(item, pkg, path, kpiResults, walkCtx); err != nil {
+		if err := walkRFPPackage(item, "", pkg, path, scan, walkCtx); err != nil {
 			return PkgResult{}, err
 		}
 	}
 
-	kpiResults = parser.RemoveKPIResultsNotFound(kpiResults)
+	kpiResults := parser.RemoveKPIResultsNotFound(scan.kpiResults)
 
 	pkgResult := PkgResult{
-		PackageName:  pkg.Name,
-		DateParsed:   time.Now().Format("2006-01-02"),
-		Year:         path.Year,
-		BusinessUnit: path.BusinessUnit,
-		Division:     path.Division,
-		KPIResults:   kpiResults,
+		PackageName:    pkg.Name,
+		DateParsed:     time.Now().Format("2006-01-02"),
+		Levels:         path.Levels(),
+		KPIResults:     kpiResults,
+		CategoryScores: parser.CategoryScores(kpiResults),
+		KPIDefsHash:    walkCtx.KPIDefsInfo.ShortHash(),
+		Files:          scan.files,
+	}
+
+	if scan.entities != nil {
+		pkgResult.Entities = scan.entities.Entities()
+		parser.MarkCoveredEntities(pkgResult.Entities, walkCtx.KPIDefs)
 	}
 
 	return pkgResult, nil
 }
 
-func walkRFPPackage(item graph.Item, pkg graph.Package, path WalkPath, kpiResults []parser.KPIResult, walkCtx *WalkContext) error {
+// walkRFPPackage scans item, found in the package subfolder dir ("" at the top of the package)
+func walkRFPPackage(item graph.Item, dir string, pkg graph.Package, path WalkPath, scan *packageScan, walkCtx *WalkContext) error {
 	ext := filepath.Ext(item.Name)
+	name := item.Name
+	if dir != "" {
+		name = dir + "/" + item.Name
+	}
 
 	switch ext {
-	case docxExt:
-		f, err := graph.GetFile(item.ID, walkCtx.Ctx, walkCtx.Cfg)
-		if err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
+	case docxExt, xlsxExt, pdfExt:
+		if !walkCtx.Cfg.EnabledParsers[ext] {
 			return nil
 		}
-		defer f.Close()
-		defer os.Remove(f.Name())
 
-		info, err := f.Stat()
-		if err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
+		match := func(seg parser.TextSegment) error {
+			seg.File = name
+			parser.ScanSegment(seg, scan.kpiResults, scan.entities)
 			return nil
 		}
+		//segments are held back until the file's language is known, then released by flush
+		detect, flush := parser.WithLanguageDetection(match)
 
-		if err := parser.DocxParser(f, info.Size(), kpiResults); err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+		err := extractFile(item, ext, detect, walkCtx)
+		if err == nil {
+			err = flush()
 		}
-		return nil
-
-	case xlsxExt:
-		f, err := graph.GetFile(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+		walkCtx.Summary.fileParsed(ext, err)
+		scan.files = append(scan.files, FileOutcome{Name: name, Error: err})
 		if err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+			//the package's failure policy decides what a failed file means for the package
+			walkCtx.Cfg.Logger.With(path.logArgs()...).Warn("Unable to process file", "Package Name", pkg.Name, "File Name", name, "error", err)
 		}
-		defer f.Close()
-		defer os.Remove(f.Name())
+		return nil
 
-		info, err := f.Stat()
+	case "":
+		childItems, err := graph.GetItemSubDirs(item.ID, walkCtx.Ctx, walkCtx.Cfg)
 		if err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+			return err
 		}
 
-		if err := parser.XlsxParser(f, info.Size(), kpiResults); err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+		for _, childItem := range childItems {
+			if err := walkRFPPackage(childItem, name, pkg, path, scan, walkCtx); err != nil {
+				return err
+			}
 		}
 		return nil
+	}
 
-	case pdfExt:
-		f, err := graph.GetFile(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+	return nil
+}
+
+// extractFile streams the text segments of item to emit, replaying them from the segment cache
+// when the file's content has been extracted before.
+func extractFile(item graph.Item, ext string, emit parser.SegmentFunc, walkCtx *WalkContext) error {
+	segCache := walkCtx.Cache
+	if segCache == nil {
+		return downloadAndParse(item, ext, emit, walkCtx)
+	}
+
+	key := remoteContentKey(item)
+	if key != "" {
+		if hit, err := replayCached(segCache, key, emit); hit || err != nil {
+			return err
+		}
+	}
+
+	f, err := graph.GetFile(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	//no hash from Graph - fall back to hashing the downloaded content
+	if key == "" {
+		key, err = localContentKey(f)
 		if err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+			return err
 		}
-		defer f.Close()
-		defer os.Remove(f.Name())
+		if hit, err := replayCached(segCache, key, emit); hit || err != nil {
+			return err
+		}
+	}
 
-		if err := parser.PdfParser(walkCtx.Ctx, f, kpiResults); err != nil {
-			walkCtx.Cfg.Logger.Warn("Unable to process file", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division, "File Name", item.Name, "error", err)
-			return nil
+	w, err := segCache.NewWriter(key)
+	if err != nil {
+		walkCtx.Cfg.Logger.Warn("Unable to write to segment cache", "File Name", item.Name, "error", err)
+		return parseFile(f, ext, emit, walkCtx)
+	}
+
+	var cacheErr error
+	tee := func(seg parser.TextSegment) error {
+		if cacheErr == nil {
+			cacheErr = w.Write(seg)
 		}
+		return emit(seg)
+	}
+
+	if err := parseFile(f, ext, tee, walkCtx); err != nil {
+		w.Abort()
+		return err
+	}
+
+	if cacheErr != nil {
+		w.Abort()
+		walkCtx.Cfg.Logger.Warn("Unable to write to segment cache", "File Name", item.Name, "error", cacheErr)
 		return nil
+	}
 
-	case "":
-		childItems, err := graph.GetItemSubDirs(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+	if err := w.Commit(); err != nil {
+		walkCtx.Cfg.Logger.Warn("Unable to write to segment cache", "File Name", item.Name, "error", err)
+	}
+	return nil
+}
+
+func downloadAndParse(item graph.Item, ext string, emit parser.SegmentFunc, walkCtx *WalkContext) error {
+	f, err := graph.GetFile(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer os.Remove(f.Name())
+
+	return parseFile(f, ext, emit, walkCtx)
+}
+
+func parseFile(f *os.File, ext string, emit parser.SegmentFunc, walkCtx *WalkContext) error {
+	switch ext {
+	case docxExt:
+		info, err := f.Stat()
 		if err != nil {
 			return err
 		}
+		return parser.DocxParser(f, info.Size(), emit)
 
-		for _, childItem := range childItems {
-			if err := walkRFPPackage(childItem, pkg, path, kpiResults, walkCtx); err != nil {
-				return err
-			}
+	case xlsxExt:
+		info, err := f.Stat()
+		if err != nil {
+			return err
 		}
-		return nil
+		return parser.XlsxParser(f, info.Size(), emit)
+
+	case pdfExt:
+		return parser.PdfParser(walkCtx.Ctx, f, emit)
 	}
 
-	return nil
+	return fmt.Errorf("unsupported file extension: %s", ext)
+}
+
+// replayCached emits the cached segments for key. hit is false when the key is not cached.
+func replayCached(segCache *cache.SegmentCache, key string, emit parser.SegmentFunc) (bool, error) {
+	segs, ok, err := segCache.Get(key)
+	if err != nil || !ok {
+		//a corrupt entry is treated as a miss and overwritten
+		return false, nil
+	}
+
+	for _, seg := range segs {
+		if err := emit(seg); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func remoteContentKey(item graph.Item) string {
+	if item.File != nil {
+		if h := item.File.Hashes.QuickXorHash; h != "" {
+			return "quickXorHash:" + h
+		}
+		if h := item.File.Hashes.SHA256Hash; h != "" {
+			return "sha256:" + strings.ToLower(h)
+		}
+	}
+	if item.CTag != "" {
+		return "cTag:" + item.CTag
+	}
+	return ""
+}
+
+func localContentKey(f *os.File) (string, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hashing file: %w", err)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
 }
@@ -2,7 +2,10 @@ package walk
 
 import (
 	"fmt"
+	"math"
 	"strconv"
+
+	"github.com/JA50N14/rfp_parser/config"
 )
 
 type Cell struct {
@@ -15,66 +18,204 @@ type Row struct {
 	Cells []Cell `json:"cells"`
 }
 
-const (
-	colDateParsed     int64 = 5732040604077956
-	colYear           int64 = 6705789409120132
-	colBusinessUnit   int64 = 4453989595434884
-	colDivision       int64 = 336189612314500
-	colRFPPackageName int64 = 3480240790392708
-	colKPIName        int64 = 7983840417763204
-	colKPICategory    int64 = 665491023286148
-	colKPIContext     int64 = 4756959379804036
-)
+// resultColumnNames are the Smartsheet names of the columns of each config.ResultField
+var resultColumnNames = map[string]string{
+	config.ResultFieldDateParsed:          "Date Parsed",
+	config.ResultFieldRFPPackageName:      "RFP Package Name",
+	config.ResultFieldKPIName:             "KPI Name",
+	config.ResultFieldKPICategory:         "KPI Category",
+	config.ResultFieldKPIContext:          "KPI Context",
+	config.ResultFieldKPIID:               "KPI ID",
+	config.ResultFieldRequirementStrength: "Requirement Strength",
+	config.ResultFieldKPIScore:            "KPI Score",
+	config.ResultFieldCategoryScore:       "Category Score",
+	config.ResultFieldKPISection:          "KPI Section",
+	config.ResultFieldLanguage:            "Language",
+	config.ResultFieldKPIDefsHash:         "KPI Definitions Hash",
+}
+
+// columnNames maps the IDs of the mapped columns to their Smartsheet names, for the dry run report
+func columnNames(columns map[string]int64, levels []Level) map[int64]string {
+	names := make(map[string]int64, len(levels)+len(columns))
+	for _, level := range levels {
+		names[level.Name] = level.Column
+	}
+	for field, id := range columns {
+		names[resultColumnNames[field]] = id
+	}
+
+	byID := make(map[int64]string, len(names))
+	for name, id := range names {
+		//unmapped optional columns
+		if id != 0 {
+			byID[id] = name
+		}
+	}
+	return byID
+}
 
-func prepareResultsForSmartsheetRows(result PkgResult) []Row {
+// prepareResultsForSmartsheetRows builds a row per KPI found, with a cell for each mapped column
+// (columns is config.ApiConfig.SmartsheetColumns) and each reported library level
+func prepareResultsForSmartsheetRows(result PkgResult, columns map[string]int64, levels []Level) []Row {
 	var smartsheetRows []Row
 
 	for _, kpiResult := range result.KPIResults {
-		//convert Year to an int, else smartsheet inserts the year like this: '2026
-		yearInt, err := strconv.Atoi(result.Year)
-		if err != nil {
-			yearInt = 0
+		row := Row{
+			ToTop: true,
+			Cells: append(levelCells(result.Levels, levels), []Cell{
+				{
+					ColumnId: columns[config.ResultFieldDateParsed],
+					Value:    result.DateParsed,
+				},
+				{
+					ColumnId: columns[config.ResultFieldRFPPackageName],
+					Value:    result.PackageName,
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPIName],
+					Value:    fmt.Sprintf("%v", kpiResult.KPIDef.Name),
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPICategory],
+					Value:    fmt.Sprintf("%v", kpiResult.KPIDef.Category),
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPIContext],
+					Value:    fmt.Sprintf("%v", kpiResult.Sentence),
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPIID],
+					Value:    kpiResult.KPIDef.ID,
+				},
+				{
+					ColumnId: columns[config.ResultFieldRequirementStrength],
+					Value:    string(kpiResult.Strength),
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPISection],
+					Value:    kpiResult.Section,
+				},
+				{
+					ColumnId: columns[config.ResultFieldLanguage],
+					Value:    kpiResult.Language,
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPIDefsHash],
+					Value:    result.KPIDefsHash,
+				},
+				{
+					ColumnId: columns[config.ResultFieldKPIScore],
+					Value:    roundScore(kpiResult.Score),
+				},
+				{
+					ColumnId: columns[config.ResultFieldCategoryScore],
+					Value:    roundScore(result.CategoryScores[kpiResult.KPIDef.Category]),
+				},
+			}...),
+		}
+		row.Cells = removeUnmappedCells(row.Cells)
+		smartsheetRows = append(smartsheetRows, row)
+	}
+
+	smartsheetRows = append(smartsheetRows, prepareEntitiesForSmartsheetRows(result, columns, levels)...)
+
+	return smartsheetRows
+}
+
+// entityCategoryPrefix marks rows for discovered entities, e.g. "Discovered Standard", so they
+// can be filtered apart from KPI rows
+const entityCategoryPrefix = "Discovered "
+
+// prepareEntitiesForSmartsheetRows reports the entities not already covered by a KPI definition,
+// using the KPI columns: the normalised entity as the name and its kind as the category
+func prepareEntitiesForSmartsheetRows(result PkgResult, columns map[string]int64, levels []Level) []Row {
+	var smartsheetRows []Row
+
+	for _, entity := range result.Entities {
+		if entity.KPIID != "" {
+			continue
 		}
 
 		row := Row{
 			ToTop: true,
-			Cells: []Cell{
+			Cells: append(levelCells(result.Levels, levels), []Cell{
 				{
-					ColumnId: colDateParsed,
+					ColumnId: columns[config.ResultFieldDateParsed],
 					Value:    result.DateParsed,
 				},
 				{
-					ColumnId: colYear,
-					Value:    yearInt,
+					ColumnId: columns[config.ResultFieldRFPPackageName],
+					Value:    result.PackageName,
 				},
 				{
-					ColumnId: colBusinessUnit,
-					Value:    result.BusinessUnit,
+					ColumnId: columns[config.ResultFieldKPIName],
+					Value:    entity.ID,
 				},
 				{
-					ColumnId: colDivision,
-					Value:    result.Division,
+					ColumnId: columns[config.ResultFieldKPICategory],
+					Value:    entityCategoryPrefix + string(entity.Kind),
 				},
 				{
-					ColumnId: colRFPPackageName,
-					Value:    result.PackageName,
+					ColumnId: columns[config.ResultFieldKPIContext],
+					Value:    entity.Sentence,
 				},
 				{
-					ColumnId: colKPIName,
-					Value:    fmt.Sprintf("%v", kpiResult.KPIDef.Name),
+					ColumnId: columns[config.ResultFieldKPIID],
+					Value:    "entity:" + entity.Key(),
 				},
 				{
-					ColumnId: colKPICategory,
-					Value:    fmt.Sprintf("%v", kpiResult.KPIDef.Category),
+					ColumnId: columns[config.ResultFieldKPISection],
+					Value:    entity.Section,
 				},
 				{
-					ColumnId: colKPIContext,
-					Value:    fmt.Sprintf("%v", kpiResult.Sentence),
+					ColumnId: columns[config.ResultFieldLanguage],
+					Value:    entity.Language,
 				},
-			},
+				{
+					ColumnId: columns[config.ResultFieldKPIDefsHash],
+					Value:    result.KPIDefsHash,
+				},
+			}...),
 		}
+		row.Cells = removeUnmappedCells(row.Cells)
 		smartsheetRows = append(smartsheetRows, row)
 	}
 
 	return smartsheetRows
 }
+
+// levelCells returns a cell for each level with a column, holding the package's folder name at that level
+func levelCells(values map[string]string, levels []Level) []Cell {
+	cells := make([]Cell, 0, len(levels))
+	for _, level := range levels {
+		value, ok := values[level.Name]
+		if !ok || level.Column == 0 {
+			continue
+		}
+
+		if !level.Numeric {
+			cells = append(cells, Cell{ColumnId: level.Column, Value: value})
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			n = 0
+		}
+		cells = append(cells, Cell{ColumnId: level.Column, Value: n})
+	}
+	return cells
+}
+
+func removeUnmappedCells(cells []Cell) []Cell {
+	mapped := cells[:0]
+	for _, cell := range cells {
+		if cell.ColumnId != 0 {
+			mapped = append(mapped, cell)
+		}
+	}
+	return mapped
+}
+
+func roundScore(score float64) float64 {
+	return math.Round(score*100) / 100
+}
@@ -0,0 +1,91 @@
+package walk
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/JA50N14/rfp_parser/parser"
+)
+
+func TestResultRowsIncludeScores(t *testing.T) {
+	columns := map[string]int64{
+		config.ResultFieldKPIName:       1,
+		config.ResultFieldKPIScore:      2,
+		config.ResultFieldCategoryScore: 3,
+	}
+	certs := &parser.KPIDefinition{Name: "ISO 14001", Category: "Certifications"}
+	result := PkgResult{
+		KPIResults:     []parser.KPIResult{{KPIDef: certs, Found: true, Score: 4.256}},
+		CategoryScores: map[string]float64{"Certifications": 7.5},
+	}
+
+	rows := prepareResultsForSmartsheetRows(result, columns, nil)
+	if len(rows) != 1 {
+		t.Fatalf("got %d rows, want 1", len(rows))
+	}
+
+	want := []Cell{{ColumnId: 1, Value: "ISO 14001"}, {ColumnId: 2, Value: 4.26}, {ColumnId: 3, Value: 7.5}}
+	if !slices.Equal(rows[0].Cells, want) {
+		t.Errorf("cells = %+v, want %+v", rows[0].Cells, want)
+	}
+}
+
+func TestCategoryScoreLines(t *testing.T) {
+	got := categoryScoreLines(map[string]float64{"Policies": 1.5, "Certifications": 7.504, "Bonding": 1.5})
+	want := []string{"Certifications: 7.50", "Bonding: 1.50", "Policies: 1.50"}
+	if !slices.Equal(got, want) {
+		t.Errorf("categoryScoreLines = %q, want %q", got, want)
+	}
+}
+
+func TestResultRowsIncludeSectionWhenMapped(t *testing.T) {
+	certs := &parser.KPIDefinition{Name: "ISO 14001", Category: "Certifications"}
+	result := PkgResult{
+		KPIResults: []parser.KPIResult{{KPIDef: certs, Found: true, Section: "4 Evaluation > 4.2 Certifications"}},
+	}
+
+	rows := prepareResultsForSmartsheetRows(result, map[string]int64{config.ResultFieldKPISection: 5}, nil)
+	want := []Cell{{ColumnId: 5, Value: "4 Evaluation > 4.2 Certifications"}}
+	if !slices.Equal(rows[0].Cells, want) {
+		t.Errorf("cells = %+v, want %+v", rows[0].Cells, want)
+	}
+
+	//unmapped, the section is left out of the row
+	rows = prepareResultsForSmartsheetRows(result, map[string]int64{config.ResultFieldKPIName: 1}, nil)
+	if want := []Cell{{ColumnId: 1, Value: "ISO 14001"}}; !slices.Equal(rows[0].Cells, want) {
+		t.Errorf("cells = %+v, want %+v", rows[0].Cells, want)
+	}
+}
+
+func TestResultRowsIncludeLanguageWhenMapped(t *testing.T) {
+	certs := &parser.KPIDefinition{Name: "ISO 14001", Category: "Certifications"}
+	result := PkgResult{
+		KPIResults: []parser.KPIResult{{KPIDef: certs, Found: true, Language: "fr"}},
+		Entities:   []parser.Entity{{Kind: parser.EntityStandard, ID: "ISO 9001", Language: "en"}},
+	}
+
+	rows := prepareResultsForSmartsheetRows(result, map[string]int64{config.ResultFieldLanguage: 6}, nil)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, want a KPI row and an entity row", len(rows))
+	}
+	for i, lang := range []string{"fr", "en"} {
+		if want := []Cell{{ColumnId: 6, Value: lang}}; !slices.Equal(rows[i].Cells, want) {
+			t.Errorf("row %d cells = %+v, want %+v", i, rows[i].Cells, want)
+		}
+	}
+}
+
+func TestLevelCells(t *testing.T) {
+	levels := []Level{
+		{Name: "Year", Column: 10, Numeric: true},
+		{Name: "Business Unit", Column: 11},
+		{Name: "Division"}, //not reported
+	}
+	values := map[string]string{"Year": "2026", "Business Unit": "Facilities Management", "Division": "FM East"}
+
+	want := []Cell{{ColumnId: 10, Value: 2026}, {ColumnId: 11, Value: "Facilities Management"}}
+	if got := levelCells(values, levels); !slices.Equal(got, want) {
+		t.Errorf("levelCells = %+v, want %+v", got, want)
+	}
+}
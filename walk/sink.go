@@ -0,0 +1,131 @@
+package walk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/graph"
+)
+
+// packageSink applies the writes of a run: ProcessStatus and metadata columns on package folders,
+// and the package's Smartsheet rows
+type packageSink interface {
+	patchFields(pkg graph.Package, path WalkPath, fields map[string]any) error
+	postRows(pkg graph.Package, path WalkPath, rows []Row) error
+}
+
+// liveSink writes to SharePoint and Smartsheet
+type liveSink struct {
+	walkCtx *WalkContext
+}
+
+func (s liveSink) patchFields(pkg graph.Package, path WalkPath, fields map[string]any) error {
+	return graph.PatchFields(pkg.ID, fields, s.walkCtx.Ctx, s.walkCtx.Cfg)
+}
+
+func (s liveSink) postRows(pkg graph.Package, path WalkPath, rows []Row) error {
+	return postToSmartsheets(rows, s.walkCtx.Ctx, s.walkCtx.Cfg)
+}
+
+// dryRunRecorder records the writes a run would have made, for the dry run report
+type dryRunRecorder struct {
+	columnNames map[int64]string
+
+	mu       sync.Mutex
+	packages []*dryRunPackage
+	byID     map[string]*dryRunPackage
+}
+
+type dryRunReport struct {
+	RunID         string           `json:"runId"`
+	Mode          string           `json:"mode"`
+	GeneratedAt   time.Time        `json:"generatedAt"`
+	KPIDefsSource string           `json:"kpiDefinitionsSource"`
+	KPIDefsHash   string           `json:"kpiDefinitionsHash"`
+	Packages      []*dryRunPackage `json:"packages"`
+}
+
+type dryRunPackage struct {
+	Name          string           `json:"name"`
+	Path          string           `json:"path"`
+	StatusChanges []map[string]any `json:"statusChanges,omitempty"` //in the order they would have been patched
+	Rows          []map[string]any `json:"rows,omitempty"`          //keyed by Smartsheet column name
+}
+
+func newDryRunRecorder(columnNames map[int64]string) *dryRunRecorder {
+	return &dryRunRecorder{
+		columnNames: columnNames,
+		byID:        make(map[string]*dryRunPackage),
+	}
+}
+
+func (r *dryRunRecorder) patchFields(pkg graph.Package, path WalkPath, fields map[string]any) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.pkg(pkg, path)
+	p.StatusChanges = append(p.StatusChanges, fields)
+	return nil
+}
+
+func (r *dryRunRecorder) postRows(pkg graph.Package, path WalkPath, rows []Row) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p := r.pkg(pkg, path)
+	for _, row := range rows {
+		p.Rows = append(p.Rows, namedCells(row, r.columnNames))
+	}
+	return nil
+}
+
+func (r *dryRunRecorder) pkg(pkg graph.Package, path WalkPath) *dryRunPackage {
+	p, ok := r.byID[pkg.ID]
+	if !ok {
+		p = &dryRunPackage{Name: pkg.Name, Path: path.String()}
+		r.byID[pkg.ID] = p
+		r.packages = append(r.packages, p)
+	}
+	return p
+}
+
+// writeReport writes the recorded writes as JSON to reportPath
+func (r *dryRunRecorder) writeReport(reportPath string, walkCtx *WalkContext) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := dryRunReport{
+		RunID:         walkCtx.Summary.RunID,
+		Mode:          walkCtx.Cfg.RunMode,
+		GeneratedAt:   time.Now().UTC(),
+		KPIDefsSource: walkCtx.KPIDefsInfo.Source,
+		KPIDefsHash:   walkCtx.KPIDefsInfo.ShortHash(),
+		Packages:      r.packages,
+	}
+
+	b, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportPath, b, 0o644); err != nil {
+		return fmt.Errorf("writing dry run report: %w", err)
+	}
+	return nil
+}
+
+// namedCells keys a row's values by Smartsheet column name, falling back to the column ID
+func namedCells(row Row, columnNames map[int64]string) map[string]any {
+	cells := make(map[string]any, len(row.Cells))
+	for _, cell := range row.Cells {
+		name, ok := columnNames[cell.ColumnId]
+		if !ok {
+			name = strconv.FormatInt(cell.ColumnId, 10)
+		}
+		cells[name] = cell.Value
+	}
+	return cells
+}
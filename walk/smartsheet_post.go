@@ -13,8 +13,6 @@ import (
 	"github.com/JA50N14/rfp_parser/config"
 )
 
-const maxRetries = 5
-
 func postToSmartsheets(smartsheetRows []Row, ctx context.Context, cfg *config.ApiConfig) error {
 	payloadBytes, err := json.Marshal(smartsheetRows)
 	if err != nil {
@@ -22,8 +20,9 @@ func postToSmartsheets(smartsheetRows []Row, ctx context.Context, cfg *config.Ap
 	}
 
 	var lastErr error
+	maxAttempts := cfg.MaxRetries + 1
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
 		if ctx.Err() != nil {
 			return ctx.Err()
 		}
@@ -39,7 +38,7 @@ func postToSmartsheets(smartsheetRows []Row, ctx context.Context, cfg *config.Ap
 		resp, err := cfg.Client.Do(req)
 		if err != nil {
 			lastErr = err
-			if attempt < maxRetries {
+			if attempt < maxAttempts {
 				if err := backoff(ctx, attempt); err != nil {
 					return err
 				}
@@ -59,24 +58,27 @@ func postToSmartsheets(smartsheetRows []Row, ctx context.Context, cfg *config.Ap
 			return nil
 		}
 
+		//error bodies can echo the request, including its token
+		body := cfg.Redact(string(bodyBytes))
+
 		//Determine retryability
 		switch {
 		case resp.StatusCode == http.StatusTooManyRequests:
-			lastErr = fmt.Errorf("rate limited: %s", string(bodyBytes))
+			lastErr = fmt.Errorf("rate limited: %s", body)
 
 		case resp.StatusCode == http.StatusRequestTimeout:
-			lastErr = fmt.Errorf("request timeout: %s", string(bodyBytes))
+			lastErr = fmt.Errorf("request timeout: %s", body)
 
 		case resp.StatusCode >= 500 && resp.StatusCode <= 599:
-			lastErr = fmt.Errorf("server error %d: %s", resp.StatusCode, string(bodyBytes))
+			lastErr = fmt.Errorf("server error %d: %s", resp.StatusCode, body)
 
 		default:
 			//Non-retryable client error
-			return fmt.Errorf("non-retryable smartsheet error %d: %s", resp.StatusCode, string(bodyBytes))
+			return fmt.Errorf("non-retryable smartsheet error %d: %s", resp.StatusCode, body)
 		}
 
 		//Retry if attempts remain
-		if attempt < maxRetries {
+		if attempt < maxAttempts {
 			if err := backoff(ctx, attempt); err != nil {
 				return err
 			}
@@ -0,0 +1,209 @@
+package walk
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JA50N14/rfp_parser/config"
+	"github.com/google/uuid"
+)
+
+// Package outcomes recorded in RunSummary
+const (
+	OutcomeSucceeded           = "succeeded"
+	OutcomeCompletedWithErrors = "completed with errors" //results posted, some files not parsed
+	OutcomeFailed              = "failed"
+)
+
+// RunSummary collects the outcome of one WalkDocLibrary run
+type RunSummary struct {
+	RunID     string //written to each package's RunID column
+	Mode      string
+	StartedAt time.Time
+	Duration  time.Duration
+
+	KPIDefinitions KPIDefsInfo //the definitions the run scanned with
+
+	Levels []LevelSummary
+
+	PackagesFound      int //packages under the last library level
+	PackagesSkipped    int //already Complete or InProgress, or already backfilled
+	PackagesSucceeded  int //including those with files that could not be parsed
+	PackagesWithErrors int //succeeded with files that could not be parsed, under FILE_FAILURE_POLICY=complete-with-errors only
+	PackagesFailed     int
+	Packages           []PackageOutcome
+
+	FilesParsed map[string]int //by extension
+	FilesFailed map[string]int //by extension
+
+	KPIsFound   int
+	RowsWritten int //Smartsheet rows
+
+	mu sync.Mutex //packages are processed concurrently
+}
+
+// LevelSummary counts the folders at one library level
+type LevelSummary struct {
+	Name    string
+	Folders int //walked
+	Skipped int //failed the level's validator
+	Failed  int //could not be listed
+}
+
+// PackageOutcome is the result of processing or backfilling one package
+type PackageOutcome struct {
+	Name        string
+	Path        string
+	Outcome     string
+	Error       string   `json:",omitempty"`
+	FailedFiles []string `json:",omitempty"`
+	KPIsFound   int
+	Rows        int
+}
+
+func newRunSummary(mode string, levels []Level) *RunSummary {
+	summary := &RunSummary{
+		RunID:       uuid.NewString(),
+		Mode:        mode,
+		StartedAt:   time.Now(),
+		Levels:      make([]LevelSummary, len(levels)),
+		FilesParsed: make(map[string]int),
+		FilesFailed: make(map[string]int),
+	}
+	for i, level := range levels {
+		summary.Levels[i].Name = level.Name
+	}
+	return summary
+}
+
+// packageSucceeded records a package whose results were posted. withErrors is set when the
+// package's failed files are reported as errors, i.e. it is marked CompleteWithErrors; under
+// the complete policy they are listed on the outcome only.
+func (s *RunSummary) packageSucceeded(name string, path WalkPath, kpisFound, rows int, failedFiles []string, withErrors bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	outcome := OutcomeSucceeded
+	if withErrors {
+		outcome = OutcomeCompletedWithErrors
+		s.PackagesWithErrors++
+	}
+
+	s.PackagesSucceeded++
+	s.KPIsFound += kpisFound
+	s.RowsWritten += rows
+	s.Packages = append(s.Packages, PackageOutcome{
+		Name:        name,
+		Path:        path.String(),
+		Outcome:     outcome,
+		FailedFiles: failedFiles,
+		KPIsFound:   kpisFound,
+		Rows:        rows,
+	})
+}
+
+func (s *RunSummary) packageFailed(name string, path WalkPath, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PackagesFailed++
+	s.Packages = append(s.Packages, PackageOutcome{
+		Name:    name,
+		Path:    path.String(),
+		Outcome: OutcomeFailed,
+		Error:   err.Error(),
+	})
+}
+
+func (s *RunSummary) fileParsed(ext string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.FilesFailed[ext]++
+		return
+	}
+	s.FilesParsed[ext]++
+}
+
+func (s *RunSummary) filesFailed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for _, n := range s.FilesFailed {
+		total += n
+	}
+	return total
+}
+
+// LogValue logs the summary as a structured record without the per-package outcomes,
+// which are logged as each package finishes
+func (s *RunSummary) LogValue() slog.Value {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	levels := make([]any, 0, len(s.Levels))
+	for _, level := range s.Levels {
+		levels = append(levels, slog.Group(level.Name,
+			"folders", level.Folders,
+			"skipped", level.Skipped,
+			"failed", level.Failed,
+		))
+	}
+
+	return slog.GroupValue(
+		slog.String("runId", s.RunID),
+		slog.String("mode", s.Mode),
+		slog.Time("startedAt", s.StartedAt),
+		slog.String("duration", s.Duration.Round(time.Second).String()),
+		slog.Group("kpiDefinitions",
+			"source", s.KPIDefinitions.Source,
+			"version", s.KPIDefinitions.Version,
+			"hash", s.KPIDefinitions.Hash,
+		),
+		slog.Group("levels", levels...),
+		slog.Group("packages",
+			"found", s.PackagesFound,
+			"skipped", s.PackagesSkipped,
+			"succeeded", s.PackagesSucceeded,
+			"withErrors", s.PackagesWithErrors,
+			"failed", s.PackagesFailed,
+		),
+		slog.Any("filesParsed", s.FilesParsed),
+		slog.Any("filesFailed", s.FilesFailed),
+		slog.Int("kpisFound", s.KPIsFound),
+		slog.Int("rowsWritten", s.RowsWritten),
+	)
+}
+
+// CheckThresholds returns an error describing every configured failure threshold the run exceeded
+func (s *RunSummary) CheckThresholds(cfg *config.ApiConfig) error {
+	var exceeded []string
+
+	if cfg.MaxFailedPackages >= 0 && s.PackagesFailed > cfg.MaxFailedPackages {
+		exceeded = append(exceeded, fmt.Sprintf("%d packages failed (MAX_FAILED_PACKAGES=%d)", s.PackagesFailed, cfg.MaxFailedPackages))
+	}
+
+	if cfg.MaxFailedPackagePercent >= 0 {
+		attempted := s.PackagesSucceeded + s.PackagesFailed
+		if attempted > 0 {
+			percent := 100 * float64(s.PackagesFailed) / float64(attempted)
+			if percent > cfg.MaxFailedPackagePercent {
+				exceeded = append(exceeded, fmt.Sprintf("%.1f%% of packages failed (MAX_FAILED_PACKAGE_PERCENT=%g)", percent, cfg.MaxFailedPackagePercent))
+			}
+		}
+	}
+
+	if cfg.MaxFailedFiles >= 0 && s.filesFailed() > cfg.MaxFailedFiles {
+		exceeded = append(exceeded, fmt.Sprintf("%d files failed (MAX_FAILED_FILES=%d)", s.filesFailed(), cfg.MaxFailedFiles))
+	}
+
+	if len(exceeded) == 0 {
+		return nil
+	}
+	return fmt.Errorf("failure thresholds exceeded: %s", strings.Join(exceeded, "; "))
+}
@@ -0,0 +1,56 @@
+package walk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/JA50N14/rfp_parser/config"
+)
+
+func TestPackageSucceededCountsErrorsOnlyWhenReported(t *testing.T) {
+	summary := newRunSummary(config.RunModeProcess, nil)
+	path := WalkPath{}
+
+	summary.packageSucceeded("Complete policy", path, 2, 2, []string{"a.pdf"}, false)
+	summary.packageSucceeded("Complete with errors policy", path, 1, 1, []string{"b.pdf"}, true)
+
+	if summary.PackagesSucceeded != 2 || summary.PackagesWithErrors != 1 {
+		t.Errorf("succeeded = %d, with errors = %d, want 2 and 1", summary.PackagesSucceeded, summary.PackagesWithErrors)
+	}
+	if got := summary.Packages[0]; got.Outcome != OutcomeSucceeded || len(got.FailedFiles) != 1 {
+		t.Errorf("outcome = %+v, want succeeded with its failed file listed", got)
+	}
+	if got := summary.Packages[1].Outcome; got != OutcomeCompletedWithErrors {
+		t.Errorf("outcome = %q, want %q", got, OutcomeCompletedWithErrors)
+	}
+}
+
+func TestCheckThresholds(t *testing.T) {
+	summary := newRunSummary(config.RunModeProcess, nil)
+	summary.packageSucceeded("a", WalkPath{}, 0, 0, nil, false)
+	summary.packageFailed("b", WalkPath{}, errors.New("download failed"))
+	summary.fileParsed(".pdf", errors.New("encrypted"))
+
+	unlimited := &config.ApiConfig{MaxFailedPackages: -1, MaxFailedPackagePercent: -1, MaxFailedFiles: -1}
+	if err := summary.CheckThresholds(unlimited); err != nil {
+		t.Errorf("no thresholds set, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		cfg  *config.ApiConfig
+		fail bool
+	}{
+		{"packages within", &config.ApiConfig{MaxFailedPackages: 1, MaxFailedPackagePercent: -1, MaxFailedFiles: -1}, false},
+		{"packages exceeded", &config.ApiConfig{MaxFailedPackages: 0, MaxFailedPackagePercent: -1, MaxFailedFiles: -1}, true},
+		{"percent within", &config.ApiConfig{MaxFailedPackages: -1, MaxFailedPackagePercent: 50, MaxFailedFiles: -1}, false},
+		{"percent exceeded", &config.ApiConfig{MaxFailedPackages: -1, MaxFailedPackagePercent: 49, MaxFailedFiles: -1}, true},
+		{"files exceeded", &config.ApiConfig{MaxFailedPackages: -1, MaxFailedPackagePercent: -1, MaxFailedFiles: 0}, true},
+	}
+	for _, tt := range tests {
+		err := summary.CheckThresholds(tt.cfg)
+		if (err != nil) != tt.fail {
+			t.Errorf("%s: CheckThresholds = %v, want failure %t", tt.name, err, tt.fail)
+		}
+	}
+}
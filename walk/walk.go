@@ -2,59 +2,161 @@ package walk
 
 import (
 	"context"
-	"strconv"
+	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/JA50N14/rfp_parser/cache"
 	"github.com/JA50N14/rfp_parser/config"
 	"github.com/JA50N14/rfp_parser/graph"
 	"github.com/JA50N14/rfp_parser/parser"
 )
 
 type WalkContext struct {
-	Cfg     *config.ApiConfig
-	Ctx     context.Context
-	Now     time.Time
-	KPIDefs []parser.KPIDefinition
+	Cfg         *config.ApiConfig
+	Ctx         context.Context
+	Now         time.Time
+	KPIDefs     []parser.KPIDefinition
+	Cache       *cache.SegmentCache
+	KPIDefsInfo KPIDefsInfo
+	Levels      []Level
+	Summary     *RunSummary
+
+	backfill *backfillRun
+	scans    *scanRecorder //nil in a dry run
+	sink     packageSink
+	dryRun   *dryRunRecorder                                 //nil unless Cfg.DryRun
+	visit    func(pkgs []graph.Package, path WalkPath) error //replaces processing the packages of each last-level folder
+	workers  *packageWorkers
 }
 
-type WalkPath struct {
-	Year         string
-	BusinessUnit string
-	Division     string
-}
-
-type Level int
-
-const (
-	LevelYear Level = iota
-	LevelBusinessUnit
-	LevelDivision
-)
-
 const (
 	PkgStatusNew        = ""
 	PkgStatusInProgress = "InProgress"
 	PkgStatusComplete   = "Complete"
 	PkgStatusFailed     = "Failed"
+	//results were posted but some files could not be parsed - see PkgResult.FailedFiles
+	PkgStatusCompleteWithErrors = "CompleteWithErrors"
 )
 
-func WalkDocLibrary(ctx context.Context, cfg *config.ApiConfig) error {
-	kpiDefs, err := parser.LoadKPIDefinitions()
+// WalkDocLibrary processes (or backfills) every package in the document library. The returned summary
+// is nil only when the run failed before the library was walked; otherwise it is returned alongside
+// any error, covering the folders and packages reached.
+func WalkDocLibrary(ctx context.Context, cfg *config.ApiConfig) (*RunSummary, error) {
+	levels, err := buildLevels(cfg.HierarchyLevels)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	for _, level := range levels {
+		if level.Column == 0 {
+			cfg.Logger.Warn("Library level has no Smartsheet column and is not reported", "level", level.Name)
+		}
 	}
 
-	kpiDefs, err = parser.CompileRegexStrings(kpiDefs)
+	summary := newRunSummary(cfg.RunMode, levels)
+	defer func() {
+		summary.Duration = time.Since(summary.StartedAt)
+	}()
+
+	defFile, defsInfo, err := loadKPIDefinitions(ctx, cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	summary.KPIDefinitions = defsInfo
+
+	now := time.Now()
+	kpiDefs := parser.ActiveKPIDefinitions(defFile.KPIs, now)
 
 	walkCtx := &WalkContext{
-		Cfg:     cfg,
-		Ctx:     ctx,
-		Now:     time.Now(),
-		KPIDefs: kpiDefs,
+		Cfg:         cfg,
+		Ctx:         ctx,
+		Now:         now,
+		KPIDefs:     kpiDefs,
+		KPIDefsInfo: defsInfo,
+		Levels:      levels,
+		Summary:     summary,
+	}
+
+	walkCtx.sink = liveSink{walkCtx: walkCtx}
+	if cfg.DryRun {
+		walkCtx.dryRun = newDryRunRecorder(columnNames(cfg.SmartsheetColumns, levels))
+		walkCtx.sink = walkCtx.dryRun
+		cfg.Logger.Info("Dry run. Status changes and Smartsheet rows are written to the report only", "report", cfg.DryRunReportPath)
+	}
+
+	//backfills leave the package columns as they are, and a dry run writes none
+	if cfg.RunMode == config.RunModeProcess && !cfg.DryRun {
+		if err := validatePackageColumns(walkCtx); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.SegmentCacheDir != "" {
+		walkCtx.Cache, err = cache.NewSegmentCache(cfg.SegmentCacheDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state, err := loadKPIState(cfg.KPIStatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if state == nil {
+		//Nothing is known about which KPIs existing Complete packages were scanned for, so the current definitions become the baseline
+		cfg.Logger.Info("No KPI state found. Recording current KPI definitions as the baseline", "path", cfg.KPIStatePath)
+		state = newKPIState(kpiDefs)
+		if !cfg.DryRun {
+			if err := saveKPIState(cfg.KPIStatePath, state); err != nil {
+				return nil, err
+			}
+		}
+		if cfg.RunMode == config.RunModeBackfill {
+			return summary, nil
+		}
+	}
+	if !cfg.DryRun {
+		walkCtx.scans = newScanRecorder(state, cfg.KPIStatePath, kpiDefs)
+	}
+
+	if cfg.RunMode == config.RunModeBackfill && !initBackfill(walkCtx, state) {
+		return summary, nil
+	}
+
+	walkCtx.workers = newPackageWorkers(cfg.PackageConcurrency)
+	walkErr := walkLibrary(walkCtx)
+	walkCtx.workers.wait()
+
+	//the report covers the packages reached even when the walk failed
+	if walkCtx.dryRun != nil {
+		if err := walkCtx.dryRun.writeReport(cfg.DryRunReportPath, walkCtx); err != nil {
+			return summary, errors.Join(walkErr, err)
+		}
+		cfg.Logger.Info("Dry run report written", "report", cfg.DryRunReportPath)
+	}
+
+	if walkCtx.backfill != nil {
+		//packages in folders that could not be walked were never backfilled
+		if walkErr != nil {
+			walkCtx.backfill.failed++
+		}
+		if err := finishBackfill(walkCtx, kpiDefs); err != nil {
+			return summary, errors.Join(walkErr, err)
+		}
+	}
+
+	return summary, walkErr
+}
+
+// walkLibrary walks every root folder accepted by the first level and the filter. A folder that
+// fails is reported and its siblings are still walked.
+func walkLibrary(walkCtx *WalkContext) error {
+	if err := checkFilter(walkCtx.Levels, walkCtx.Cfg.Filter); err != nil {
+		return err
 	}
 
 	rootDirs, err := graph.GetRootDirs(walkCtx.Ctx, walkCtx.Cfg)
@@ -62,117 +164,208 @@ func WalkDocLibrary(ctx context.Context, cfg *config.ApiConfig) error {
 		return err
 	}
 
+	var errs []error
+	rootLevel := walkCtx.Levels[0]
 	for _, dir := range rootDirs {
-		ok := isValidYear(dir.Name)
-		if !ok {
-			walkCtx.Cfg.Logger.Warn("Invalid year directory at root level", "year", dir.Name)
+		if !rootLevel.accepts(dir.Name) {
+			walkCtx.Cfg.Logger.Warn("Invalid directory at root level", "level", rootLevel.Name, "directory", dir.Name)
+			walkCtx.Summary.Levels[0].Skipped++
 			continue
 		}
-
-		path := WalkPath{
-			Year: dir.Name,
+		if !filterAllowsFolder(walkCtx.Cfg.Filter, rootLevel.Name, dir.Name) {
+			continue
 		}
 
-		if err := Walk(dir, LevelYear, path, walkCtx); err != nil {
-			return err
+		path := WalkPath{}.with(rootLevel.Name, dir.Name)
+
+		if err := Walk(dir, 0, path, walkCtx); err != nil {
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
-func Walk(item graph.Item, level Level, path WalkPath, walkCtx *WalkContext) error {
-	switch level {
-	case LevelYear:
-		items, err := graph.GetItemSubDirs(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+// Walk descends from item, the folder at walkCtx.Levels[depth]. Below the last level are the packages.
+// Errors from subfolders are joined and returned once every subfolder has been walked.
+func Walk(item graph.Item, depth int, path WalkPath, walkCtx *WalkContext) error {
+	summary := walkCtx.Summary
+	summary.Levels[depth].Folders++
+
+	if depth == len(walkCtx.Levels)-1 {
+		pkgs, err := graph.GetItemSubDirsWithMetadata(item.ID, walkCtx.Ctx, walkCtx.Cfg)
 		if err != nil {
-			return err
+			summary.Levels[depth].Failed++
+			return fmt.Errorf("listing packages in %s: %w", path, err)
 		}
+		pkgs = filterPackages(walkCtx.Cfg.Filter, pkgs)
+		summary.PackagesFound += len(pkgs)
 
-		for _, item := range items {
-			nextPath := path
-			nextPath.BusinessUnit = item.Name
-			Walk(item, LevelBusinessUnit, nextPath, walkCtx)
+		if walkCtx.visit != nil {
+			return walkCtx.visit(pkgs, path)
 		}
-	case LevelBusinessUnit:
-		items, err := graph.GetItemSubDirs(item.ID, walkCtx.Ctx, walkCtx.Cfg)
-		if err != nil {
-			return err
+
+		if walkCtx.backfill != nil {
+			backfillPackages(pkgs, path, walkCtx)
+			return nil
 		}
-		for _, item := range items {
-			nextPath := path
-			nextPath.Division = item.Name
-			Walk(item, LevelDivision, nextPath, walkCtx)
+
+		unprocessed := pkgs
+		if !walkCtx.Cfg.DryRunAllPackages {
+			unprocessed, err = removeCompleteAndInProgressPackages(pkgs)
+			if err != nil {
+				return err
+			}
 		}
-	case LevelDivision:
-		pkgs, err := graph.GetItemSubDirsWithMetadata(item.ID, walkCtx.Ctx, walkCtx.Cfg)
-		if err != nil {
-			return err
+		summary.PackagesSkipped += len(pkgs) - len(unprocessed)
+
+		for _, pkg := range unprocessed {
+			walkCtx.workers.run(func() {
+				processPackage(pkg, path, walkCtx)
+			})
 		}
+		return nil
+	}
 
-		pkgs, err = removeCompleteAndInProgressPackages(pkgs)
-		if err != nil {
-			return err
+	items, err := graph.GetItemSubDirs(item.ID, walkCtx.Ctx, walkCtx.Cfg)
+	if err != nil {
+		summary.Levels[depth].Failed++
+		return fmt.Errorf("listing folders in %s: %w", path, err)
+	}
+
+	var errs []error
+	next := walkCtx.Levels[depth+1]
+	for _, item := range items {
+		if !next.accepts(item.Name) {
+			walkCtx.Cfg.Logger.With(path.logArgs()...).Warn("Invalid directory", "level", next.Name, "directory", item.Name)
+			summary.Levels[depth+1].Skipped++
+			continue
+		}
+		if !filterAllowsFolder(walkCtx.Cfg.Filter, next.Name, item.Name) {
+			continue
 		}
+		if err := Walk(item, depth+1, path.with(next.Name, item.Name), walkCtx); err != nil {
+			errs = append(errs, err)
+		}
+	}
 
-		for _, pkg := range pkgs {
-			walkCtx.Cfg.Logger.Info("Starting to process Package", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
+	return errors.Join(errs...)
+}
 
-			_, err := graph.PatchProcessStatus(pkg.ID, PkgStatusInProgress, walkCtx.Ctx, walkCtx.Cfg)
-			if err != nil {
-				walkCtx.Cfg.Logger.Warn("PATCH request to set ProcessStatus to InProgress failed. Package skipped", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				continue
-			}
+// packageWorkers runs up to Cfg.PackageConcurrency packages at once across the whole walk
+type packageWorkers struct {
+	sem chan struct{}
+	wg  sync.WaitGroup
+}
 
-			pkgResult, err := ProcessRFPPackage(pkg, path, walkCtx)
-			if err != nil {
-				walkCtx.Cfg.Logger.Warn("Failed to Process Package", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				_, err := graph.PatchProcessStatus(pkg.ID, PkgStatusFailed, walkCtx.Ctx, walkCtx.Cfg)
-				if err != nil {
-					walkCtx.Cfg.Logger.Warn("PATCH request to set ProcessStatus to Failed failed. Need to manually set ProcessStatus to Failed.", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				}
-				continue
-			}
+func newPackageWorkers(concurrency int) *packageWorkers {
+	return &packageWorkers{sem: make(chan struct{}, concurrency)}
+}
 
-			if len(pkgResult.KPIResults) == 0 {
-				_, err = graph.PatchProcessStatus(pkg.ID, PkgStatusComplete, walkCtx.Ctx, walkCtx.Cfg)
-				if err != nil {
-					walkCtx.Cfg.Logger.Warn("PATCH request to set ProcessStatus to Complete failed. Need to manually set ProcessStatus to Complete.", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				}
-				continue
-			}
+// run calls fn inline when packages are processed one at a time, otherwise on a new goroutine
+// once a worker is free
+func (w *packageWorkers) run(fn func()) {
+	if cap(w.sem) <= 1 {
+		fn()
+		return
+	}
 
-			rows := prepareResultsForSmartsheetRows(pkgResult)
+	w.sem <- struct{}{}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer func() { <-w.sem }()
+		fn()
+	}()
+}
 
-			err = postToSmartsheets(rows, walkCtx.Ctx, walkCtx.Cfg)
-			if err != nil {
-				walkCtx.Cfg.Logger.Warn("POST request to smartsheet failed.", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				_, err := graph.PatchProcessStatus(pkg.ID, PkgStatusFailed, walkCtx.Ctx, walkCtx.Cfg)
-				if err != nil {
-					walkCtx.Cfg.Logger.Warn("PATCH request to set ProcessStatus to Failed failed. Need to manually set ProcessStatus to Failed.", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				}
-				continue
-			}
+func (w *packageWorkers) wait() {
+	w.wg.Wait()
+}
 
-			_, err = graph.PatchProcessStatus(pkg.ID, PkgStatusComplete, walkCtx.Ctx, walkCtx.Cfg)
-			if err != nil {
-				walkCtx.Cfg.Logger.Warn("PATCH request to set ProcessStatus to Complete failed. Need to manually set ProcessStatus to Complete.", "error", err, "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
-				continue
-			}
+func processPackage(pkg graph.Package, path WalkPath, walkCtx *WalkContext) {
+	logger := walkCtx.Cfg.Logger.With(path.logArgs()...)
+	logger.Info("Starting to process Package", "Package Name", pkg.Name)
 
-			walkCtx.Cfg.Logger.Info("Successfully processed Package", "Package Name", pkg.Name, "Year", path.Year, "Business Unit", path.BusinessUnit, "Division", path.Division)
+	err := walkCtx.sink.patchFields(pkg, path, map[string]any{processStatusColumn: PkgStatusInProgress})
+	if err != nil {
+		logger.Warn("PATCH request to set ProcessStatus to InProgress failed. Package skipped", "error", err, "Package Name", pkg.Name)
+		walkCtx.Summary.packageFailed(pkg.Name, path, err)
+		return
+	}
+
+	pkgResult, err := ProcessRFPPackage(pkg, path, walkCtx)
+	if err != nil {
+		logger.Warn("Failed to Process Package", "error", err, "Package Name", pkg.Name)
+		walkCtx.Summary.packageFailed(pkg.Name, path, err)
+		finishPackage(pkg, path, PkgStatusFailed, PkgResult{}, err, logger, walkCtx)
+		return
+	}
+
+	failedFiles := pkgResult.FailedFiles()
+
+	completeStatus := PkgStatusComplete
+	if len(failedFiles) > 0 {
+		switch walkCtx.Cfg.FileFailurePolicy {
+		case config.FileFailureFail:
+			err := fmt.Errorf("%d of %d files could not be parsed", len(failedFiles), len(pkgResult.Files))
+			logger.Warn("Failed to Process Package", "error", err, "Package Name", pkg.Name, "Failed Files", failedFiles)
+			walkCtx.Summary.packageFailed(pkg.Name, path, err)
+			finishPackage(pkg, path, PkgStatusFailed, pkgResult, err, logger, walkCtx)
+			return
+		case config.FileFailureCompleteWithErrors:
+			completeStatus = PkgStatusCompleteWithErrors
 		}
 	}
 
-	return nil
+	rows := prepareResultsForSmartsheetRows(pkgResult, walkCtx.Cfg.SmartsheetColumns, walkCtx.Levels)
+
+	if len(rows) == 0 {
+		walkCtx.Summary.packageSucceeded(pkg.Name, path, 0, 0, failedFiles, completeStatus == PkgStatusCompleteWithErrors)
+		recordScan(pkg, logger, walkCtx)
+		finishPackage(pkg, path, completeStatus, pkgResult, nil, logger, walkCtx)
+		return
+	}
+
+	err = walkCtx.sink.postRows(pkg, path, rows)
+	if err != nil {
+		logger.Warn("POST request to smartsheet failed.", "error", err, "Package Name", pkg.Name)
+		walkCtx.Summary.packageFailed(pkg.Name, path, err)
+		finishPackage(pkg, path, PkgStatusFailed, pkgResult, fmt.Errorf("posting to Smartsheet: %w", err), logger, walkCtx)
+		return
+	}
+
+	//the rows are written, so the package counts as processed even if the status PATCH fails
+	walkCtx.Summary.packageSucceeded(pkg.Name, path, len(pkgResult.KPIResults), len(rows), failedFiles, completeStatus == PkgStatusCompleteWithErrors)
+	recordScan(pkg, logger, walkCtx)
+
+	if !finishPackage(pkg, path, completeStatus, pkgResult, nil, logger, walkCtx) {
+		return
+	}
+
+	if len(failedFiles) > 0 {
+		logger.Warn("Processed Package with files that could not be parsed", "Package Name", pkg.Name, "KPIs Found", len(pkgResult.KPIResults), "Failed Files", failedFiles)
+		return
+	}
+	logger.Info("Successfully processed Package", "Package Name", pkg.Name, "KPIs Found", len(pkgResult.KPIResults))
+}
+
+// recordScan records the definitions the package's posted results were scanned with, so backfills
+// do not append them again
+func recordScan(pkg graph.Package, logger *slog.Logger, walkCtx *WalkContext) {
+	if walkCtx.scans == nil {
+		return
+	}
+	if err := walkCtx.scans.packageScanned(pkg.ID); err != nil {
+		logger.Warn("Unable to record the KPI definitions the Package was scanned with", "error", err, "Package Name", pkg.Name)
+	}
 }
 
 func removeCompleteAndInProgressPackages(pkgs []graph.Package) ([]graph.Package, error) {
 	unprocessedPkgs := make([]graph.Package, 0)
 
 	for _, pkg := range pkgs {
-		status := extractProcessStatus(pkg.ListItem.Fields.ProcessStatus)
-		normalize := strings.TrimSpace(status)
+		normalize := normalizeProcessStatus(pkg.ListItem.Fields.ProcessStatus)
 
 		if normalize == PkgStatusNew || normalize == PkgStatusFailed {
 			unprocessedPkgs = append(unprocessedPkgs, pkg)
@@ -182,6 +375,10 @@ func removeCompleteAndInProgressPackages(pkgs []graph.Package) ([]graph.Package,
 	return unprocessedPkgs, nil
 }
 
+func normalizeProcessStatus(raw interface{}) string {
+	return strings.TrimSpace(extractProcessStatus(raw))
+}
+
 func extractProcessStatus(raw interface{}) string {
 	switch v := raw.(type) {
 	case string:
@@ -193,13 +390,3 @@ func extractProcessStatus(raw interface{}) string {
 	}
 	return ""
 }
-
-func isValidYear(s string) bool {
-	year, err := strconv.Atoi(s)
-	if err != nil {
-		return false
-	}
-
-	currentYear := time.Now().Year()
-	return year >= 2025 && year <= currentYear+1
-}